@@ -1,69 +1,171 @@
 package main
 
 import (
+    "context"
     "fmt"
     "log"
     "net/http"
+    "os"
+    "time"
     
+    "coffeeApi/services/auth"
     "coffeeApi/services/db"
+    "coffeeApi/services/geocoding"
     "coffeeApi/services/handlers"
+    "coffeeApi/services/mailer"
     "coffeeApi/services/middleware"
+    "coffeeApi/services/oidc"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
     
     "github.com/gorilla/mux"
 )
 
 func main() {
+    keys, err := auth.KeyManagerFromEnv()
+    if err != nil {
+        log.Fatal("Błąd kluczy podpisujących tokeny:", err)
+    }
+    auth.UseKeys(keys)
+    go keys.Run(context.Background(), 5*time.Minute)
+
     if err := db.Init(); err != nil {
         log.Fatal("Błąd połączenia z bazą:", err)
     }
     
+    stores := store.NewPostgresStores(db.DB)
+    geocoder, err := geocoding.New(geocoding.ConfigFromEnv(), geocoding.NewPostgresCache(db.DB))
+    if err != nil {
+        log.Fatal("Błąd konfiguracji geokodowania:", err)
+    }
+    worker := geocoding.NewWorker(stores.Geocoding, geocoder)
+    go worker.Run(context.Background())
+
+    mail, err := mailer.New(mailer.ConfigFromEnv())
+    if err != nil {
+        log.Fatal("Błąd konfiguracji poczty:", err)
+    }
+    publicURL := os.Getenv("PUBLIC_URL")
+    if publicURL == "" {
+        publicURL = "http://localhost:40331"
+    }
+
+    users := handlers.NewUserHandler(stores.Users, stores.Sessions, stores.APIKeys, stores.Logins, mail, publicURL)
+    coffees := handlers.NewCoffeeHandler(stores.Coffees)
+    shops := handlers.NewCoffeeShopHandler(stores.Shops, worker.Notify)
+    roasteries := handlers.NewRoasteryHandler(stores.Roasteries, worker.Notify)
+    reviews := handlers.NewReviewHandler(stores.Reviews, stores.Users, os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true")
+    stats := handlers.NewStatsHandler(stores)
+    jwks := handlers.NewJWKSHandler(keys)
+    search := handlers.NewSearchHandler(stores.Search)
+    docs := handlers.NewDocumentationHandler(publicURL)
+
+    apiKeys := handlers.NewAPIKeyHandler(stores.APIKeys)
+    providerConfigs, err := oidc.ConfigFromEnv()
+    if err != nil {
+        log.Fatal("Błąd konfiguracji OIDC:", err)
+    }
+    var providers []*oidc.Provider
+    for _, cfg := range providerConfigs {
+        providers = append(providers, oidc.NewProvider(cfg))
+    }
+    oidcLogin := handlers.NewOIDCHandler(users, stores.Identities, providers)
+
+    authn := middleware.NewAuthenticator(stores.Sessions, stores.APIKeys)
+    ifMatch := middleware.RequireIfMatch(os.Getenv("REQUIRE_IF_MATCH") == "true")
+
     router := mux.NewRouter()
     
     // Documentation
-    router.HandleFunc("/", handlers.GetApiDocumentationHandler).Methods("GET")
-    router.HandleFunc("/help", handlers.GetHtmlDocumentationHandler).Methods("GET")
+    router.HandleFunc("/", docs.GetApiDocumentation).Methods("GET")
+    router.HandleFunc("/help", docs.GetHtmlDocumentation).Methods("GET")
+    router.HandleFunc("/openapi.json", docs.GetOpenAPI).Methods("GET")
+    router.HandleFunc("/.well-known/jwks.json", jwks.GetJWKS).Methods("GET")
 
     // User e
-    router.HandleFunc("/register", handlers.RegisterHandler).Methods("POST")
-    router.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
-    router.HandleFunc("/users/{id}", handlers.GetUserByIdHandler).Methods("GET")
+    router.HandleFunc("/register", users.Register).Methods("POST")
+    router.HandleFunc("/login", users.Login).Methods("POST")
+    router.HandleFunc("/token/refresh", users.RefreshToken).Methods("POST")
+    router.HandleFunc("/oidc/{provider}/login", oidcLogin.Login).Methods("GET")
+    router.HandleFunc("/oidc/{provider}/callback", oidcLogin.Callback).Methods("GET")
+    router.HandleFunc("/email/verify", users.VerifyEmail).Methods("GET", "POST")
+    router.Handle("/email/verify/resend", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.ResendVerification)))).Methods("POST")
+    router.HandleFunc("/password/forgot", users.ForgotPassword).Methods("POST")
+    router.HandleFunc("/password/reset", users.ResetPassword).Methods("POST")
+    router.Handle("/logout", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.Logout)))).Methods("POST")
+    router.Handle("/logout/all", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.LogoutAll)))).Methods("POST")
+    router.Handle("/me", authn.AuthMiddleware(http.HandlerFunc(users.GetMe))).Methods("GET")
+    router.Handle("/me", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.UpdateMe)))).Methods("PUT")
+    router.Handle("/me", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.DeleteMe)))).Methods("DELETE")
+    router.Handle("/me/api-keys", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(apiKeys.GetAPIKeys)))).Methods("GET")
+    router.Handle("/me/api-keys", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(apiKeys.CreateAPIKey)))).Methods("POST")
+    router.Handle("/me/api-keys/{id}", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(apiKeys.RevokeAPIKey)))).Methods("DELETE")
+    router.Handle("/me/password", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.ChangePassword)))).Methods("PUT")
+    router.Handle("/users", authn.AuthMiddleware(middleware.Authorize(auth.Read, auth.Users)(http.HandlerFunc(users.GetUsers)))).Methods("GET")
+    router.Handle("/users/{id}", authn.OptionalAuth(http.HandlerFunc(users.GetUserById))).Methods("GET")
+    router.Handle("/users/{id}/role", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Roles)(http.HandlerFunc(users.SetRole)))).Methods("PUT")
+    router.Handle("/users/{id}/lockout", authn.AuthMiddleware(middleware.Authorize(auth.Delete, auth.Lockouts)(http.HandlerFunc(users.Unlock)))).Methods("DELETE")
 
     // Coffee 
-    router.HandleFunc("/coffees", handlers.GetCoffeesHandler).Methods("GET")
-    router.HandleFunc("/coffees/{id}", handlers.GetCoffeeHandler).Methods("GET")
-    router.Handle("/coffees", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateCoffeeHandler))).Methods("POST")
-    router.Handle("/coffees/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.UpdateCoffeeHandler))).Methods("PUT")
-    router.Handle("/coffees/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.DeleteCoffeeHandler))).Methods("DELETE")
+    router.HandleFunc("/coffees", coffees.GetCoffees).Methods("GET")
+    router.HandleFunc("/coffees/{id}", coffees.GetCoffee).Methods("GET")
+    router.Handle("/coffees", authn.AuthMiddleware(middleware.Authorize(auth.Create, auth.Coffees)(http.HandlerFunc(coffees.CreateCoffee)))).Methods("POST")
+    router.Handle("/coffees/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Coffees)(ifMatch(http.HandlerFunc(coffees.UpdateCoffee))))).Methods("PUT")
+    router.Handle("/coffees/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Coffees)(ifMatch(http.HandlerFunc(coffees.PatchCoffee))))).Methods("PATCH")
+    router.Handle("/coffees/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Delete, auth.Coffees)(ifMatch(http.HandlerFunc(coffees.DeleteCoffee))))).Methods("DELETE")
 
     // Coffee Shop 
-    router.HandleFunc("/shops", handlers.GetCoffeeShopsHandler).Methods("GET")
-    router.HandleFunc("/shops/{id}", handlers.GetCoffeeShopHandler).Methods("GET")
-    router.Handle("/shops", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateCoffeeShopHandler))).Methods("POST")
-    router.Handle("/shops/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.UpdateCoffeeShopHandler))).Methods("PUT")
-    router.Handle("/shops/{id}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(handlers.DeleteCoffeeShopHandler)))).Methods("DELETE")
+    router.HandleFunc("/shops", shops.GetCoffeeShops).Methods("GET")
+    router.HandleFunc("/shops.geojson", shops.GetCoffeeShopsGeoJSON).Methods("GET")
+    router.HandleFunc("/shops/{id}", shops.GetCoffeeShop).Methods("GET")
+    router.Handle("/shops", authn.AuthMiddleware(middleware.Authorize(auth.Create, auth.Shops)(http.HandlerFunc(shops.CreateCoffeeShop)))).Methods("POST")
+    router.Handle("/shops/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Shops)(ifMatch(http.HandlerFunc(shops.UpdateCoffeeShop))))).Methods("PUT")
+    router.Handle("/shops/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Shops)(ifMatch(http.HandlerFunc(shops.PatchCoffeeShop))))).Methods("PATCH")
+    router.Handle("/shops/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Delete, auth.Shops)(ifMatch(http.HandlerFunc(shops.DeleteCoffeeShop))))).Methods("DELETE")
 
     // Roasteries 
-    router.HandleFunc("/roasteries", handlers.GetRoasteriesHandler).Methods("GET")
-    router.HandleFunc("/roasteries/{id}", handlers.GetRoasteryHandler).Methods("GET")
-    router.Handle("/roasteries", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateRoasteryHandler))).Methods("POST")
-    router.Handle("/roasteries/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.UpdateRoasteryHandler))).Methods("PUT")
-    router.Handle("/roasteries/{id}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(handlers.DeleteRoasteryHandler)))).Methods("DELETE")
+    router.HandleFunc("/roasteries", roasteries.GetRoasteries).Methods("GET")
+    router.HandleFunc("/roasteries.geojson", roasteries.GetRoasteriesGeoJSON).Methods("GET")
+    router.HandleFunc("/roasteries/{id}", roasteries.GetRoastery).Methods("GET")
+    router.Handle("/roasteries", authn.AuthMiddleware(middleware.Authorize(auth.Create, auth.Roasteries)(http.HandlerFunc(roasteries.CreateRoastery)))).Methods("POST")
+    router.Handle("/roasteries/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Roasteries)(ifMatch(http.HandlerFunc(roasteries.UpdateRoastery))))).Methods("PUT")
+    router.Handle("/roasteries/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Update, auth.Roasteries)(ifMatch(http.HandlerFunc(roasteries.PatchRoastery))))).Methods("PATCH")
+    router.Handle("/roasteries/{id}", authn.AuthMiddleware(middleware.Authorize(auth.Delete, auth.Roasteries)(ifMatch(http.HandlerFunc(roasteries.DeleteRoastery))))).Methods("DELETE")
 
     // Reviews
-    router.HandleFunc("/reviews", handlers.GetReviewsHandler).Methods("GET")
-    router.Handle("/reviews", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateReviewHandler))).Methods("POST")
-    router.Handle("/reviews/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.UpdateReviewHandler))).Methods("PUT")
-    router.Handle("/reviews/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.DeleteReviewHandler))).Methods("DELETE")
+    router.HandleFunc("/reviews", reviews.GetReviews).Methods("GET")
+    router.HandleFunc("/reviews/{id}", reviews.GetReview).Methods("GET")
+    router.Handle("/reviews", authn.AuthMiddleware(middleware.Authorize(auth.Create, auth.Reviews)(http.HandlerFunc(reviews.CreateReview)))).Methods("POST")
+    router.Handle("/reviews/{id}", authn.AuthMiddleware(ifMatch(http.HandlerFunc(reviews.UpdateReview)))).Methods("PUT")
+    router.Handle("/reviews/{id}", authn.AuthMiddleware(ifMatch(http.HandlerFunc(reviews.PatchReview)))).Methods("PATCH")
+    router.Handle("/reviews/{id}", authn.AuthMiddleware(ifMatch(http.HandlerFunc(reviews.DeleteReview)))).Methods("DELETE")
+
+    // Search
+    router.HandleFunc("/search", search.Search).Methods("GET")
 
     // Stats
-    router.HandleFunc("/stats", handlers.GetStatsHandler).Methods("GET")
+    router.HandleFunc("/stats", stats.GetStats).Methods("GET")
+
+    router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        problem.Error(w, http.StatusNotFound, problem.NotFound, "No such endpoint, see /help")
+    })
+    router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        problem.Error(w, http.StatusMethodNotAllowed, problem.MethodNotAllowed, "Method not allowed on this endpoint")
+    })
+
+    // The documentation is built from the registered routes, so it has to
+    // come after them.
+    if err := docs.Describe(router); err != nil {
+        log.Fatal("Błąd dokumentacji API:", err)
+    }
 
     router.Use(middleware.CORSMiddleware)
+    router.Use(middleware.StripIdentityHeaders)
 
     port := ":40331"
     server := &http.Server{
         Addr:    port,
-        Handler: router,
+        Handler: middleware.RequestID(router),
     }
 
     fmt.Printf("Running on port %s\n", port)
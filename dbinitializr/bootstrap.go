@@ -0,0 +1,52 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/user"
+
+    "coffeeApi/services/db"
+    "coffeeApi/services/store"
+)
+
+// bootstrapAdmin promotes a registered user to admin. It only works while
+// there is no admin yet; after that roles are changed through
+// PUT /users/{id}/role. The change is recorded in role_changes together
+// with the operating system user who ran the command.
+func bootstrapAdmin(username string) error {
+    ctx := context.Background()
+    users := store.NewPostgresStores(db.DB).Users
+
+    admins, err := users.CountByRole(ctx, "admin")
+    if err != nil {
+        return err
+    }
+    if admins > 0 {
+        return fmt.Errorf("an admin already exists; use PUT /users/{id}/role instead")
+    }
+    u, err := users.GetByUsername(ctx, username)
+    if err == store.ErrNotFound {
+        return fmt.Errorf("user %q not found; register the account first", username)
+    } else if err != nil {
+        return err
+    }
+
+    err = users.SetRole(ctx, store.RoleChange{UserID: u.ID, Role: "admin", Source: "bootstrap", Actor: actor()})
+    if err != nil {
+        return err
+    }
+    fmt.Printf("User %s (id %d) is now an admin\n", u.Username, u.ID)
+    return nil
+}
+
+func actor() string {
+    name := "unknown"
+    if u, err := user.Current(); err == nil {
+        name = u.Username
+    }
+    if host, err := os.Hostname(); err == nil {
+        name += "@" + host
+    }
+    return name
+}
@@ -6,84 +6,15 @@ import (
     "io"
     "log"
     "os"
+    "strconv"
     "strings"
 
     "coffeeApi/services/db"
-    "coffeeApi/services/geocoding"
+    "coffeeApi/services/migrations"
     _ "github.com/lib/pq"
     "golang.org/x/crypto/bcrypt"
 )
 
-func createTables() error {
-    queries := []string{
-        `CREATE TABLE IF NOT EXISTS users(
-            id SERIAL PRIMARY KEY,
-            username TEXT NOT NULL UNIQUE,
-            password TEXT NOT NULL,
-            email TEXT NOT NULL,
-            role TEXT NOT NULL,
-            avatar_url TEXT
-        )`,
-        `CREATE TABLE IF NOT EXISTS coffees(
-            id SERIAL PRIMARY KEY,
-            name TEXT NOT NULL,
-            roastery_id INTEGER,
-            country TEXT,
-            region TEXT,
-            farm TEXT,
-            variety TEXT,
-            process TEXT,
-            roast_profile TEXT,
-            flavour_notes TEXT,
-            description TEXT,
-            image_url TEXT
-        )`,
-        `CREATE TABLE IF NOT EXISTS roasteries(
-            id SERIAL PRIMARY KEY,
-            name TEXT NOT NULL,
-            country TEXT,
-            city TEXT,
-            address TEXT,
-            website TEXT,
-            description TEXT,
-            avg_rating REAL,
-            lat REAL,
-            lon REAL,
-            image_url TEXT
-        )`,
-        `CREATE TABLE IF NOT EXISTS shops(
-            id SERIAL PRIMARY KEY,
-            name TEXT NOT NULL,
-            country TEXT,
-            city TEXT,
-            address TEXT,
-            website TEXT,
-            description TEXT,
-            avg_rating REAL,
-            lat REAL,
-            lon REAL,
-            image_url TEXT
-        )`,
-        `CREATE TABLE IF NOT EXISTS reviews(
-            id SERIAL PRIMARY KEY,
-            user_id INTEGER,
-            coffee_id INTEGER,
-            roastery_id INTEGER,
-            coffee_shop_id INTEGER,
-            rating REAL,
-            review TEXT,
-            date_of_creation TIMESTAMPTZ
-        )`,
-    }
-
-    for _, q := range queries {
-        if _, err := db.DB.Exec(q); err != nil {
-            return fmt.Errorf("error executing query: %v, error: %v", q, err)
-        }
-    }
-    return nil
-}
-
 type Data struct {
     Users      []User       `json:"users"`
     Coffees    []Coffee     `json:"coffees"`
@@ -155,6 +86,15 @@ type Review struct {
     DateOfCreation string  `json:"dateOfCreation"`
 }
 
+// nullableID maps the 0 used in data.json for "no reference" to SQL NULL,
+// which the foreign keys on coffees and reviews require.
+func nullableID(id int) interface{} {
+    if id == 0 {
+        return nil
+    }
+    return id
+}
+
 func tableIsEmpty(query string) (bool, error) {
     var count int
     err := db.DB.QueryRow(query).Scan(&count)
@@ -198,8 +138,9 @@ func seedData(filePath string) error {
                 tx.Rollback()
                 return fmt.Errorf("error hashing password for user %v: %v", u.Username, err)
             }
-            _, err = tx.Exec(`INSERT INTO users (username, password, email, role, avatar_url) 
-                              VALUES ($1, $2, $3, $4, $5)`,
+            // Konta przykładowe mają od razu zweryfikowany email
+            _, err = tx.Exec(`INSERT INTO users (username, password, email, email_verified, role, avatar_url) 
+                              VALUES ($1, $2, $3, true, $4, $5)`,
                 u.Username, string(hashedPassword), u.Email, u.Role, u.AvatarURL)
             if err != nil {
                 tx.Rollback()
@@ -208,54 +149,49 @@ func seedData(filePath string) error {
         }
     }
 
-    empty, err = tableIsEmpty("SELECT COUNT(*) FROM coffees")
+    empty, err = tableIsEmpty("SELECT COUNT(*) FROM roasteries")
     if err != nil {
         tx.Rollback()
         return err
     }
     if empty {
-        for _, c := range data.Coffees {
-            notes := ""
-            if len(c.FlavourNotes) > 0 {
-                notes = strings.Join(c.FlavourNotes, ",")
+        for _, r := range data.Roasteries {
+            // Rows without coordinates are geocoded by the API's background worker.
+            status := "resolved"
+            if r.Lat == 0 && r.Lon == 0 {
+                status = "pending"
             }
-            _, err := tx.Exec(`INSERT INTO coffees (name, roastery_id, country, region, farm, variety, process, 
-                              roast_profile, flavour_notes, description, image_url)
+            _, err := tx.Exec(`INSERT INTO roasteries (name, country, city, address, website, description, 
+                              avg_rating, lat, lon, image_url, geocode_status)
                               VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-                c.Name, c.RoasteryId, c.Country, c.Region, c.Farm, c.Variety, c.Process, 
-                c.RoastProfile, notes, c.Description, c.ImageURL)
+                r.Name, r.Country, r.City, r.Address, r.Website, r.Description, 
+                r.AvgRating, r.Lat, r.Lon, r.ImageURL, status)
             if err != nil {
                 tx.Rollback()
-                return fmt.Errorf("error inserting coffee %v: %v", c.Name, err)
+                return fmt.Errorf("error inserting roastery %v: %v", r.Name, err)
             }
         }
     }
 
-    empty, err = tableIsEmpty("SELECT COUNT(*) FROM roasteries")
+    empty, err = tableIsEmpty("SELECT COUNT(*) FROM coffees")
     if err != nil {
         tx.Rollback()
         return err
     }
     if empty {
-        for _, r := range data.Roasteries {
-            if r.Lat == 0 && r.Lon == 0 {
-                fullAddress := fmt.Sprintf("%s, %s, %s", r.Address, r.City, r.Country)
-                lat, lon, err := geocoding.GetCoordinates(fullAddress)
-                if err != nil {
-                    fmt.Printf("Warning: could not geocode roastery %s: %v\n", r.Name, err)
-                } else {
-                    r.Lat = lat
-                    r.Lon = lon
-                }
+        for _, c := range data.Coffees {
+            notes := ""
+            if len(c.FlavourNotes) > 0 {
+                notes = strings.Join(c.FlavourNotes, ",")
             }
-            _, err := tx.Exec(`INSERT INTO roasteries (name, country, city, address, website, description, 
-                              avg_rating, lat, lon, image_url)
-                              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
-                r.Name, r.Country, r.City, r.Address, r.Website, r.Description, 
-                r.AvgRating, r.Lat, r.Lon, r.ImageURL)
+            _, err := tx.Exec(`INSERT INTO coffees (name, roastery_id, country, region, farm, variety, process, 
+                              roast_profile, flavour_notes, description, image_url)
+                              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+                c.Name, nullableID(c.RoasteryId), c.Country, c.Region, c.Farm, c.Variety, canonicalProcess(c.Process), 
+                canonicalRoastProfile(c.RoastProfile), notes, c.Description, c.ImageURL)
             if err != nil {
                 tx.Rollback()
-                return fmt.Errorf("error inserting roastery %v: %v", r.Name, err)
+                return fmt.Errorf("error inserting coffee %v: %v", c.Name, err)
             }
         }
     }
@@ -267,21 +203,16 @@ func seedData(filePath string) error {
     }
     if empty {
         for _, s := range data.Shops {
+            // Rows without coordinates are geocoded by the API's background worker.
+            status := "resolved"
             if s.Lat == 0 && s.Lon == 0 {
-                fullAddress := fmt.Sprintf("%s, %s, %s", s.Address, s.City, s.Country)
-                lat, lon, err := geocoding.GetCoordinates(fullAddress)
-                if err != nil {
-                    fmt.Printf("Warning: could not geocode coffee shop %s: %v\n", s.Name, err)
-                } else {
-                    s.Lat = lat
-                    s.Lon = lon
-                }
+                status = "pending"
             }
             _, err := tx.Exec(`INSERT INTO shops (name, country, city, address, website, description, 
-                              avg_rating, lat, lon, image_url)
-                              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+                              avg_rating, lat, lon, image_url, geocode_status)
+                              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
                 s.Name, s.Country, s.City, s.Address, s.Website, s.Description, 
-                s.AvgRating, s.Lat, s.Lon, s.ImageURL)
+                s.AvgRating, s.Lat, s.Lon, s.ImageURL, status)
             if err != nil {
                 tx.Rollback()
                 return fmt.Errorf("error inserting shop %v: %v", s.Name, err)
@@ -299,7 +230,7 @@ func seedData(filePath string) error {
             _, err := tx.Exec(`INSERT INTO reviews (user_id, coffee_id, roastery_id, coffee_shop_id, 
                               rating, review, date_of_creation)
                               VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-                rev.UserId, rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId, 
+                nullableID(rev.UserId), nullableID(rev.CoffeeId), nullableID(rev.RoasteryId), nullableID(rev.CoffeeShopId),
                 rev.Rating, rev.Review, rev.DateOfCreation)
             if err != nil {
                 tx.Rollback()
@@ -315,16 +246,88 @@ func seedData(filePath string) error {
     return nil
 }
 
+const usage = `Usage:
+  dbinitializr                  apply pending migrations and seed empty tables
+  dbinitializr seed             seed empty tables
+  dbinitializr migrate up       apply all pending migrations
+  dbinitializr migrate down     roll back the latest migration
+  dbinitializr migrate to N     migrate up or down to version N
+  dbinitializr migrate status   list migrations and whether they are applied
+  dbinitializr bootstrap-admin USERNAME
+                                make the first admin out of a registered user`
+
+func runMigrate(m *migrations.Migrator, args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("missing migrate subcommand\n%s", usage)
+    }
+    switch args[0] {
+    case "up":
+        return m.Up()
+    case "down":
+        return m.Down()
+    case "to":
+        if len(args) != 2 {
+            return fmt.Errorf("migrate to requires a version\n%s", usage)
+        }
+        version, err := strconv.Atoi(args[1])
+        if err != nil || version < 0 {
+            return fmt.Errorf("invalid version %q", args[1])
+        }
+        return m.To(version)
+    case "status":
+        statuses, err := m.Status()
+        if err != nil {
+            return err
+        }
+        for _, st := range statuses {
+            applied := "pending"
+            if st.Applied {
+                applied = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+            }
+            fmt.Printf("%04d  %-30s %s\n", st.Version, st.Name, applied)
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown migrate subcommand %q\n%s", args[0], usage)
+    }
+}
+
 func main() {
     if err := db.Init(); err != nil {
         log.Fatal("Database initialization error:", err)
     }
 
-    if err := createTables(); err != nil {
-        log.Fatal("Error creating tables:", err)
+    migrator, err := migrations.New(db.DB)
+    if err != nil {
+        log.Fatal("Error loading migrations:", err)
+    }
+
+    args := os.Args[1:]
+    if len(args) == 0 {
+        if err := migrator.Up(); err != nil {
+            log.Fatal("Error applying migrations:", err)
+        }
+        if err := seedData("dbinitializr/data.json"); err != nil {
+            log.Fatal(err)
+        }
+        return
     }
 
-    if err := seedData("dbinitializr/data.json"); err != nil {
+    switch args[0] {
+    case "migrate":
+        err = runMigrate(migrator, args[1:])
+    case "seed":
+        err = seedData("dbinitializr/data.json")
+    case "bootstrap-admin":
+        if len(args) != 2 {
+            err = fmt.Errorf("bootstrap-admin requires a username\n%s", usage)
+            break
+        }
+        err = bootstrapAdmin(args[1])
+    default:
+        err = fmt.Errorf("unknown command %q\n%s", args[0], usage)
+    }
+    if err != nil {
         log.Fatal(err)
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+// The process and roast profile labels in data.json were copied from the
+// roasteries' shops. They stay as they are in the file and are translated
+// to the vocabulary the API validates while the coffees are loaded.
+
+func canonicalProcess(value string) string {
+    v := strings.ToLower(strings.TrimSpace(value))
+    switch {
+    case oneOf(v, "washed", "wet", "wet process", "wet processed", "fully washed"):
+        return "Washed"
+    case oneOf(v, "natural", "dry", "dry process", "dry processed"):
+        return "Natural"
+    case v == "honey":
+        return "Honey"
+    case v == "pulped natural":
+        return "Pulped natural"
+    case oneOf(v, "wet-hulled", "wet hulled", "giling basah"):
+        return "Wet-hulled"
+    case strings.Contains(v, "anaerobic"):
+        return "Anaerobic"
+    case v == "blend" || strings.Contains(v, "natural") && strings.Contains(v, "washed"):
+        return "Blend"
+    case v == "experimental" || strings.Contains(v, "ferment"):
+        return "Experimental"
+    }
+    return "Unknown"
+}
+
+func canonicalRoastProfile(value string) string {
+    v := strings.ToLower(strings.TrimSpace(value))
+    switch {
+    case oneOf(v, "light", "medium", "dark", "filter", "espresso", "omni", "unknown"):
+        return strings.ToUpper(v[:1]) + v[1:]
+    case oneOf(v, "medium-light", "medium light", "medium - light"):
+        return "Medium-light"
+    case oneOf(v, "medium-dark", "medium dark", "medium - dark"):
+        return "Medium-dark"
+    case oneOf(v, "filter/espresso", "espresso/filter", "omniroast"):
+        return "Omni"
+    }
+    return "Unknown"
+}
+
+func oneOf(v string, values ...string) bool {
+    for _, value := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,29 @@
+// Command jwtkeys generates a key for signing tokens in the directory the
+// API reads keys from (JWT_KEYS_DIR).
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "time"
+
+    "coffeeApi/services/auth"
+)
+
+func main() {
+    dir := flag.String("dir", os.Getenv("JWT_KEYS_DIR"), "key directory, JWT_KEYS_DIR by default")
+    alg := flag.String("alg", auth.AlgRS256, "algorithm: RS256 or EdDSA")
+    in := flag.Duration("in", 0, "start signing after this long, to publish the key first")
+    flag.Parse()
+    if *dir == "" {
+        log.Fatal("Set -dir or JWT_KEYS_DIR")
+    }
+
+    key, err := auth.GenerateKey(*dir, *alg, time.Now().Add(*in))
+    if err != nil {
+        log.Fatal("Error generating key:", err)
+    }
+    fmt.Printf("Generated %s key %s, signing from %s\n", key.Alg, key.ID, key.ActiveAt.Format(time.RFC3339))
+}
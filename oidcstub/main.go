@@ -0,0 +1,28 @@
+// Command oidcstub runs a local OpenID Connect issuer that logs in anyone,
+// so OIDC login can be tried and tested without network access.
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "net/http"
+
+    "coffeeApi/services/oidc"
+)
+
+func main() {
+    addr := flag.String("addr", "localhost:9999", "address to listen on")
+    issuer := flag.String("issuer", "", "issuer URL, http://ADDR by default")
+    flag.Parse()
+    if *issuer == "" {
+        *issuer = "http://" + *addr
+    }
+
+    stub, err := oidc.NewStub(*issuer)
+    if err != nil {
+        log.Fatal("Error creating issuer:", err)
+    }
+    fmt.Printf("OIDC stub issuer %s\n", stub.Issuer)
+    log.Fatal(http.ListenAndServe(*addr, stub))
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "errors"
+    "strconv"
+    "time"
+
+    "github.com/golang-jwt/jwt"
+)
+
+// Purposes of action tokens sent by email.
+const (
+    PurposeVerifyEmail   = "verify-email"
+    PurposeResetPassword = "reset-password"
+)
+
+const (
+    VerifyEmailTTL   = 48 * time.Hour
+    ResetPasswordTTL = time.Hour
+)
+
+var ErrInvalidActionToken = errors.New("invalid or expired token")
+
+type actionClaims struct {
+    Purpose string `json:"purpose"`
+    // State is a hash of state that the action changes: the email address
+    // for verification and the password hash for resets. Once the action
+    // is done the state no longer matches, so every token works once
+    // without being stored.
+    State string `json:"st"`
+    jwt.StandardClaims
+}
+
+func stateHash(state string) string {
+    sum := sha256.Sum256([]byte(state))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewActionToken signs a token that lets the user perform purpose until it
+// expires or state changes.
+func NewActionToken(purpose string, userID int, state string, ttl time.Duration) (string, error) {
+    now := time.Now()
+    claims := actionClaims{
+        Purpose: purpose,
+        State:   stateHash(state),
+        StandardClaims: jwt.StandardClaims{
+            Subject:   strconv.Itoa(userID),
+            IssuedAt:  now.Unix(),
+            ExpiresAt: now.Add(ttl).Unix(),
+        },
+    }
+    return signToken(claims)
+}
+
+// ActionTokenUser returns the user an action token was issued to, without
+// checking it. The caller loads that user's state and passes it to
+// VerifyActionToken.
+func ActionTokenUser(token string) (int, error) {
+    claims := &actionClaims{}
+    if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+        return 0, ErrInvalidActionToken
+    }
+    id, err := strconv.Atoi(claims.Subject)
+    if err != nil {
+        return 0, ErrInvalidActionToken
+    }
+    return id, nil
+}
+
+// VerifyActionToken checks the signature, expiry and purpose of token
+// against the user's current state.
+func VerifyActionToken(token, purpose, state string) error {
+    claims := &actionClaims{}
+    if err := parseToken(token, claims); err != nil || claims.Purpose != purpose {
+        return ErrInvalidActionToken
+    }
+    if subtle.ConstantTimeCompare([]byte(claims.State), []byte(stateHash(state))) != 1 {
+        return ErrInvalidActionToken
+    }
+    return nil
+}
@@ -0,0 +1,369 @@
+package auth
+
+import (
+    "context"
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "coffeeApi/services/jwk"
+
+    "github.com/golang-jwt/jwt"
+)
+
+// Algorithms of signing keys.
+const (
+    AlgRS256 = "RS256"
+    AlgEdDSA = "EdDSA"
+)
+
+// kidTimeLayout starts the ID of generated keys with the time the key
+// starts signing, so the schedule survives restarts without extra files.
+const kidTimeLayout = "20060102T150405Z"
+
+// SigningKey is a private key with its ID. ActiveAt is when it starts
+// signing tokens; until then it is only published, so that verifiers
+// caching the key set learn it before they see tokens signed with it.
+type SigningKey struct {
+    ID       string
+    Alg      string
+    ActiveAt time.Time
+
+    private crypto.Signer
+}
+
+func (k SigningKey) Public() crypto.PublicKey {
+    return k.private.Public()
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+    if k.Alg == AlgEdDSA {
+        return jwt.SigningMethodEdDSA
+    }
+    return jwt.SigningMethodRS256
+}
+
+// KeyManager holds the keys tokens are signed and verified with. Keys are
+// PEM files in Dir named after their key ID. Several instances may share
+// the directory: each reloads it and picks up keys the others generated.
+type KeyManager struct {
+    Dir string
+    // Alg is the algorithm of generated keys.
+    Alg string
+    // RotateEvery is how long a key signs before the next one takes over;
+    // 0 turns rotation off.
+    RotateEvery time.Duration
+    // PublishAhead is how long a generated key is published before it
+    // starts signing.
+    PublishAhead time.Duration
+    // Retain is how long a replaced key still verifies tokens. It must
+    // outlast the longest lived token signed with it.
+    Retain time.Duration
+
+    mu   sync.RWMutex
+    keys []SigningKey
+}
+
+// KeyManagerFromEnv loads the keys in JWT_KEYS_DIR. JWT_KEY_ALG (RS256 or
+// EdDSA) and JWT_KEY_ROTATION (a duration such as 720h) configure
+// rotation. It fails when no key can be loaded.
+func KeyManagerFromEnv() (*KeyManager, error) {
+    m := &KeyManager{
+        Dir:          os.Getenv("JWT_KEYS_DIR"),
+        Alg:          os.Getenv("JWT_KEY_ALG"),
+        PublishAhead: time.Hour,
+        Retain:       VerifyEmailTTL + time.Hour,
+    }
+    if m.Dir == "" {
+        return nil, errors.New("JWT_KEYS_DIR is not set")
+    }
+    if m.Alg == "" {
+        m.Alg = AlgRS256
+    }
+    if m.Alg != AlgRS256 && m.Alg != AlgEdDSA {
+        return nil, fmt.Errorf("JWT_KEY_ALG must be %s or %s", AlgRS256, AlgEdDSA)
+    }
+    if rotation := os.Getenv("JWT_KEY_ROTATION"); rotation != "" {
+        d, err := time.ParseDuration(rotation)
+        if err != nil || d <= m.PublishAhead {
+            return nil, fmt.Errorf("JWT_KEY_ROTATION must be a duration longer than %v", m.PublishAhead)
+        }
+        m.RotateEvery = d
+    }
+    if err := m.Reload(); err != nil {
+        return nil, err
+    }
+    return m, nil
+}
+
+// Reload reads the keys in Dir again. It fails, keeping the current keys,
+// when a file cannot be read or no key is left.
+func (m *KeyManager) Reload() error {
+    paths, err := filepath.Glob(filepath.Join(m.Dir, "*.pem"))
+    if err != nil {
+        return err
+    }
+    var keys []SigningKey
+    for _, path := range paths {
+        key, err := readKey(path)
+        if err != nil {
+            return fmt.Errorf("%s: %w", path, err)
+        }
+        keys = append(keys, key)
+    }
+    if len(keys) == 0 {
+        return fmt.Errorf("no signing keys in %s", m.Dir)
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i].ActiveAt.Before(keys[j].ActiveAt) })
+    m.mu.Lock()
+    m.keys = keys
+    m.mu.Unlock()
+    return nil
+}
+
+func readKey(path string) (SigningKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return SigningKey{}, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return SigningKey{}, errors.New("no PEM data")
+    }
+    var parsed interface{}
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    case "PRIVATE KEY":
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    default:
+        return SigningKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+    }
+    if err != nil {
+        return SigningKey{}, err
+    }
+    id := strings.TrimSuffix(filepath.Base(path), ".pem")
+    key := SigningKey{ID: id}
+    // Keys not named by GenerateKey have the zero ActiveAt and sign until
+    // a generated key replaces them.
+    if len(id) > len(kidTimeLayout) {
+        if at, err := time.Parse(kidTimeLayout, id[:len(kidTimeLayout)]); err == nil {
+            key.ActiveAt = at
+        }
+    }
+    switch k := parsed.(type) {
+    case *rsa.PrivateKey:
+        if k.N.BitLen() < 2048 {
+            return SigningKey{}, errors.New("RSA keys must have at least 2048 bits")
+        }
+        key.Alg, key.private = AlgRS256, k
+    case ed25519.PrivateKey:
+        key.Alg, key.private = AlgEdDSA, k
+    default:
+        return SigningKey{}, fmt.Errorf("unsupported key type %T", parsed)
+    }
+    return key, nil
+}
+
+// GenerateKey creates a key of the given algorithm in dir that starts
+// signing at activeAt.
+func GenerateKey(dir, alg string, activeAt time.Time) (SigningKey, error) {
+    var private crypto.Signer
+    var err error
+    switch alg {
+    case AlgRS256:
+        private, err = rsa.GenerateKey(rand.Reader, 2048)
+    case AlgEdDSA:
+        _, private, err = ed25519.GenerateKey(rand.Reader)
+    default:
+        err = fmt.Errorf("unsupported algorithm %q", alg)
+    }
+    if err != nil {
+        return SigningKey{}, err
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(private)
+    if err != nil {
+        return SigningKey{}, err
+    }
+    suffix := make([]byte, 4)
+    if _, err := rand.Read(suffix); err != nil {
+        return SigningKey{}, err
+    }
+    activeAt = activeAt.UTC().Truncate(time.Second)
+    key := SigningKey{
+        ID:       activeAt.Format(kidTimeLayout) + "-" + hex.EncodeToString(suffix),
+        Alg:      alg,
+        ActiveAt: activeAt,
+        private:  private,
+    }
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return SigningKey{}, err
+    }
+    // Written under a temporary name so other instances never read a
+    // partial file.
+    path := filepath.Join(dir, key.ID+".pem")
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+        return SigningKey{}, err
+    }
+    return key, os.Rename(tmp, path)
+}
+
+// signingKey returns the newest key that is already active.
+func (m *KeyManager) signingKey() (SigningKey, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    now := time.Now()
+    for i := len(m.keys) - 1; i >= 0; i-- {
+        if !m.keys[i].ActiveAt.After(now) {
+            return m.keys[i], nil
+        }
+    }
+    if len(m.keys) > 0 {
+        // Only keys scheduled for the future: use the earliest rather than
+        // refusing to sign.
+        return m.keys[0], nil
+    }
+    return SigningKey{}, errors.New("no signing keys")
+}
+
+func (m *KeyManager) verificationKey(kid string) (SigningKey, bool) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    for _, k := range m.keys {
+        if k.ID == kid {
+            return k, true
+        }
+    }
+    return SigningKey{}, false
+}
+
+// JWKS returns the public keys, including keys not yet signing.
+func (m *KeyManager) JWKS() jwk.Set {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    set := jwk.Set{Keys: []jwk.Key{}}
+    for _, k := range m.keys {
+        if key, err := jwk.New(k.ID, k.Public()); err == nil {
+            set.Keys = append(set.Keys, key)
+        }
+    }
+    return set
+}
+
+// Rotate generates the next key once the newest one has signed for
+// RotateEvery minus PublishAhead, and deletes keys replaced more than
+// Retain ago.
+func (m *KeyManager) Rotate(now time.Time) error {
+    if m.RotateEvery <= 0 {
+        return nil
+    }
+    m.mu.RLock()
+    newest := m.keys[len(m.keys)-1]
+    m.mu.RUnlock()
+    if !newest.ActiveAt.Add(m.RotateEvery - m.PublishAhead).After(now) {
+        activeAt := newest.ActiveAt.Add(m.RotateEvery)
+        if earliest := now.Add(m.PublishAhead); activeAt.Before(earliest) {
+            activeAt = earliest
+        }
+        key, err := GenerateKey(m.Dir, m.Alg, activeAt)
+        if err != nil {
+            return err
+        }
+        log.Printf("generated signing key %s, signing from %s", key.ID, key.ActiveAt.Format(time.RFC3339))
+    }
+
+    m.mu.RLock()
+    keys := m.keys
+    m.mu.RUnlock()
+    for i := 0; i+1 < len(keys); i++ {
+        // A key is replaced when the next one starts signing.
+        replacedAt := keys[i+1].ActiveAt
+        if !replacedAt.IsZero() && replacedAt.Add(m.Retain).Before(now) {
+            if err := os.Remove(filepath.Join(m.Dir, keys[i].ID+".pem")); err != nil && !os.IsNotExist(err) {
+                return err
+            }
+            log.Printf("removed signing key %s", keys[i].ID)
+        }
+    }
+    return m.Reload()
+}
+
+// Run reloads the keys and rotates them every interval until ctx is
+// cancelled.
+func (m *KeyManager) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        if err := m.Reload(); err != nil {
+            log.Printf("reloading signing keys: %v", err)
+        } else if err := m.Rotate(time.Now()); err != nil {
+            log.Printf("rotating signing keys: %v", err)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+var keys *KeyManager
+
+// UseKeys makes m sign and verify all tokens. It must be called before
+// any token is issued.
+func UseKeys(m *KeyManager) {
+    keys = m
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+    if keys == nil {
+        return "", errors.New("no signing keys configured")
+    }
+    k, err := keys.signingKey()
+    if err != nil {
+        return "", err
+    }
+    token := jwt.NewWithClaims(k.method(), claims)
+    token.Header["kid"] = k.ID
+    return token.SignedString(k.private)
+}
+
+// parseToken verifies a token signed by one of our keys. The key named by
+// kid decides the algorithm; the alg header only has to agree with it.
+func parseToken(tokenString string, claims jwt.Claims) error {
+    if keys == nil {
+        return errors.New("no signing keys configured")
+    }
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        k, ok := keys.verificationKey(kid)
+        if !ok {
+            return nil, fmt.Errorf("unknown key %q", kid)
+        }
+        if token.Method.Alg() != k.Alg {
+            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+        }
+        return k.Public(), nil
+    })
+    if err != nil {
+        return err
+    }
+    if !token.Valid {
+        return errors.New("invalid token")
+    }
+    return nil
+}
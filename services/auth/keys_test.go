@@ -0,0 +1,59 @@
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+func TestRotate(t *testing.T) {
+    start := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+    m := &KeyManager{Dir: t.TempDir(), Alg: AlgEdDSA, RotateEvery: 720 * time.Hour, PublishAhead: time.Hour, Retain: 2 * time.Hour}
+    first, err := GenerateKey(m.Dir, m.Alg, start)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := m.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    UseKeys(m)
+    token, err := NewAccessToken(1, RoleUser, "session")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The steps run in order on the same directory, each at the given time
+    // after the first key started signing.
+    steps := []struct {
+        name string
+        at   time.Duration
+        keys int
+        // firstValid is whether tokens signed with the first key still
+        // verify.
+        firstValid bool
+    }{
+        {"young key", 24 * time.Hour, 1, true},
+        {"next key published ahead", 719 * time.Hour, 2, true},
+        {"published key not generated again", 719*time.Hour + 30*time.Minute, 2, true},
+        {"replaced key retained", 721 * time.Hour, 2, true},
+        {"replaced key removed after Retain", 723 * time.Hour, 1, false},
+    }
+    for _, step := range steps {
+        if err := m.Rotate(start.Add(step.at)); err != nil {
+            t.Fatalf("%s: %v", step.name, err)
+        }
+        if n := len(m.JWKS().Keys); n != step.keys {
+            t.Errorf("%s: %d keys published, want %d", step.name, n, step.keys)
+        }
+        _, err := ParseAccessToken(token)
+        if valid := err == nil; valid != step.firstValid {
+            t.Errorf("%s: token of the first key valid = %v (%v), want %v", step.name, valid, err, step.firstValid)
+        }
+    }
+
+    if _, ok := m.verificationKey(first.ID); ok {
+        t.Errorf("key %s still loaded", first.ID)
+    }
+    if next := m.keys[0]; !next.ActiveAt.Equal(start.Add(720 * time.Hour)) {
+        t.Errorf("next key signs from %v, want %v", next.ActiveAt, start.Add(720*time.Hour))
+    }
+}
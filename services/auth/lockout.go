@@ -0,0 +1,76 @@
+package auth
+
+import (
+    "net"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// LockoutPolicy decides how long logins are refused after consecutive
+// failures. The first FreeAttempts failures cost nothing, each further one
+// doubles the wait from BaseDelay up to MaxDelay, and LockAfter failures
+// lock the key for LockFor. Failures more than Window apart start over.
+type LockoutPolicy struct {
+    FreeAttempts int
+    BaseDelay    time.Duration
+    MaxDelay     time.Duration
+    LockAfter    int
+    LockFor      time.Duration
+    Window       time.Duration
+}
+
+// UsernameLockout protects a single account. ClientLockout is looser
+// because many users can share one address behind NAT.
+var (
+    UsernameLockout = LockoutPolicy{
+        FreeAttempts: 3,
+        BaseDelay:    time.Second,
+        MaxDelay:     time.Minute,
+        LockAfter:    10,
+        LockFor:      15 * time.Minute,
+        Window:       time.Hour,
+    }
+    ClientLockout = LockoutPolicy{
+        FreeAttempts: 20,
+        BaseDelay:    time.Second,
+        MaxDelay:     time.Minute,
+        LockAfter:    100,
+        LockFor:      15 * time.Minute,
+        Window:       time.Hour,
+    }
+)
+
+// Delay returns how long to refuse logins after failures consecutive
+// failures.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+    if failures >= p.LockAfter {
+        return p.LockFor
+    }
+    if failures <= p.FreeAttempts {
+        return 0
+    }
+    d := p.BaseDelay
+    for i := p.FreeAttempts + 1; i < failures && d < p.MaxDelay; i++ {
+        d *= 2
+    }
+    if d > p.MaxDelay {
+        d = p.MaxDelay
+    }
+    return d
+}
+
+// UsernameKey and ClientKey name the counters of failed logins. Usernames
+// are counted whether or not the account exists, so lockouts do not reveal
+// which accounts do.
+func UsernameKey(username string) string {
+    return "user:" + strings.ToLower(username)
+}
+
+func ClientKey(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    return "ip:" + host
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+func TestLockoutDelay(t *testing.T) {
+    tests := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {0, 0},
+        {3, 0},
+        {4, time.Second},
+        {5, 2 * time.Second},
+        {9, 32 * time.Second},
+        {10, 15 * time.Minute},
+        {50, 15 * time.Minute},
+    }
+    for _, tt := range tests {
+        if got := UsernameLockout.Delay(tt.failures); got != tt.want {
+            t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+        }
+    }
+    capped := LockoutPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, LockAfter: 100}
+    if got := capped.Delay(20); got != 5*time.Second {
+        t.Errorf("Delay past MaxDelay = %v, want 5s", got)
+    }
+}
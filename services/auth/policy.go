@@ -0,0 +1,61 @@
+package auth
+
+type Action string
+
+const (
+    Read   Action = "read"
+    Create Action = "create"
+    Update Action = "update"
+    Delete Action = "delete"
+)
+
+// Resource kinds known to the policy.
+const (
+    Coffees    = "coffees"
+    Roasteries = "roasteries"
+    Shops      = "shops"
+    Reviews    = "reviews"
+    // Users covers the private fields of an account, such as its email.
+    Users = "users"
+    Roles = "roles"
+    // Lockouts are the login lockouts of accounts.
+    Lockouts = "lockouts"
+)
+
+// Resource is what an action is performed on. OwnerID is the user the
+// resource belongs to, or 0 when ownership does not apply.
+type Resource struct {
+    Kind    string
+    OwnerID int
+}
+
+type rule func(p Principal, r Resource) bool
+
+func anyone(p Principal, r Resource) bool        { return true }
+func authenticated(p Principal, r Resource) bool { return p.Authenticated() }
+func owner(p Principal, r Resource) bool         { return p.Authenticated() && p.UserID == r.OwnerID }
+func adminOnly(p Principal, r Resource) bool     { return false }
+
+// rules lists what non-admin callers may do; admins may do everything.
+var rules = map[string]map[Action]rule{
+    Coffees:    {Read: anyone, Create: authenticated, Update: authenticated, Delete: authenticated},
+    Roasteries: {Read: anyone, Create: authenticated, Update: authenticated, Delete: adminOnly},
+    Shops:      {Read: anyone, Create: authenticated, Update: authenticated, Delete: adminOnly},
+    Reviews:    {Read: anyone, Create: authenticated, Update: owner, Delete: owner},
+    Users:      {Read: owner, Update: owner, Delete: owner},
+    Roles:      {Update: adminOnly},
+    Lockouts:   {Delete: adminOnly},
+}
+
+// Can reports whether p may perform action on resource. Unknown kinds and
+// actions are denied, and so is anything outside the scopes of an API key.
+func Can(p Principal, action Action, resource Resource) bool {
+    if !p.HasScope(action, resource.Kind) {
+        return false
+    }
+    if p.Authenticated() && p.IsAdmin() {
+        return true
+    }
+    allowed, ok := rules[resource.Kind][action]
+    return ok && allowed(p, resource)
+}
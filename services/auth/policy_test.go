@@ -0,0 +1,43 @@
+package auth
+
+import "testing"
+
+func TestCan(t *testing.T) {
+    anonymous := Principal{}
+    user := Principal{UserID: 1, Role: RoleUser}
+    other := Principal{UserID: 2, Role: RoleUser}
+    admin := Principal{UserID: 3, Role: RoleAdmin}
+    tests := []struct {
+        name     string
+        p        Principal
+        action   Action
+        resource Resource
+        want     bool
+    }{
+        {"anyone reads coffees", anonymous, Read, Resource{Kind: Coffees}, true},
+        {"anonymous cannot create coffees", anonymous, Create, Resource{Kind: Coffees}, false},
+        {"users create coffees", user, Create, Resource{Kind: Coffees}, true},
+        {"users cannot delete shops", user, Delete, Resource{Kind: Shops}, false},
+        {"admins delete shops", admin, Delete, Resource{Kind: Shops}, true},
+        {"users cannot delete roasteries", user, Delete, Resource{Kind: Roasteries}, false},
+        {"owners update their reviews", user, Update, Resource{Kind: Reviews, OwnerID: 1}, true},
+        {"others cannot update a review", other, Update, Resource{Kind: Reviews, OwnerID: 1}, false},
+        {"anonymous cannot own an ownerless review", anonymous, Delete, Resource{Kind: Reviews}, false},
+        {"admins delete any review", admin, Delete, Resource{Kind: Reviews, OwnerID: 1}, true},
+        {"users read their own account", user, Read, Resource{Kind: Users, OwnerID: 1}, true},
+        {"users cannot read other accounts", other, Read, Resource{Kind: Users, OwnerID: 1}, false},
+        {"users cannot change roles", user, Update, Resource{Kind: Roles, OwnerID: 1}, false},
+        {"admins change roles", admin, Update, Resource{Kind: Roles}, true},
+        {"users cannot lift lockouts", user, Delete, Resource{Kind: Lockouts}, false},
+        {"unknown kinds are denied", user, Read, Resource{Kind: "payments"}, false},
+        {"unlisted actions are denied", user, Create, Resource{Kind: Roles}, false},
+        {"a role claim without a user is not an admin", Principal{Role: RoleAdmin}, Delete, Resource{Kind: Shops}, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := Can(tt.p, tt.action, tt.resource); got != tt.want {
+                t.Errorf("Can(%+v, %s, %+v) = %v, want %v", tt.p, tt.action, tt.resource, got, tt.want)
+            }
+        })
+    }
+}
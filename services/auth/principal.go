@@ -0,0 +1,57 @@
+package auth
+
+import "context"
+
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+// Principal is the authenticated caller of a request, taken from the
+// signed claims of its access token or from its API key.
+type Principal struct {
+    UserID    int
+    Role      string
+    SessionID string
+    // APIKeyID and Scopes are set for callers using an API key, who may
+    // only do what both their role and the scopes allow. Scopes is nil for
+    // access tokens.
+    APIKeyID int
+    Scopes   []string
+}
+
+func (p Principal) Authenticated() bool {
+    return p.UserID != 0
+}
+
+func (p Principal) IsAdmin() bool {
+    return p.Role == RoleAdmin
+}
+
+// HasScope reports whether the caller may perform action on kind. Callers
+// with an access token have every scope.
+func (p Principal) HasScope(action Action, kind string) bool {
+    if p.Scopes == nil {
+        return true
+    }
+    want := Scope(action, kind)
+    for _, s := range p.Scopes {
+        if s == want {
+            return true
+        }
+    }
+    return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+    return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller stored by the authentication middleware,
+// or the zero Principal for anonymous requests.
+func PrincipalFrom(ctx context.Context) Principal {
+    p, _ := ctx.Value(principalKey{}).(Principal)
+    return p
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "time"
+
+    "github.com/golang-jwt/jwt"
+)
+
+const (
+    // AccessTokenTTL is short because access tokens are only checked
+    // against their session, not individually revoked.
+    AccessTokenTTL  = 15 * time.Minute
+    RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Claims are the claims of an access token. Id (jti) identifies the token
+// and SessionID the session, i.e. the refresh token family, it belongs to.
+type Claims struct {
+    UserID    int    `json:"userId"`
+    Role      string `json:"role"`
+    SessionID string `json:"sid"`
+    jwt.StandardClaims
+}
+
+func (c *Claims) Principal() Principal {
+    return Principal{UserID: c.UserID, Role: c.Role, SessionID: c.SessionID}
+}
+
+// NewAccessToken signs a short-lived access token for the session. The role
+// is copied into the token, so a role change applies from the next refresh.
+func NewAccessToken(userID int, role, sessionID string) (string, error) {
+    jti, err := randomID()
+    if err != nil {
+        return "", err
+    }
+    now := time.Now()
+    claims := Claims{
+        UserID:    userID,
+        Role:      role,
+        SessionID: sessionID,
+        StandardClaims: jwt.StandardClaims{
+            Id:        jti,
+            IssuedAt:  now.Unix(),
+            ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+        },
+    }
+    return signToken(claims)
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token.
+func ParseAccessToken(tokenString string) (*Claims, error) {
+    claims := &Claims{}
+    if err := parseToken(tokenString, claims); err != nil {
+        return nil, err
+    }
+    if claims.UserID == 0 || claims.SessionID == "" {
+        return nil, errors.New("invalid token claims")
+    }
+    return claims, nil
+}
+
+// NewSessionID returns a random identifier for a new session.
+func NewSessionID() (string, error) {
+    return randomID()
+}
+
+// NewRefreshToken returns a random refresh token and the hash under which
+// it is stored.
+func NewRefreshToken() (token, hash string, err error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", err
+    }
+    token = base64.RawURLEncoding.EncodeToString(b)
+    return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+func randomID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+package geocoding
+
+import (
+    "context"
+    "database/sql"
+    "sync"
+)
+
+// Cache stores resolved coordinates by normalized address.
+type Cache interface {
+    Get(ctx context.Context, key string) (Coordinates, bool, error)
+    Put(ctx context.Context, key string, c Coordinates) error
+}
+
+// Cached consults Cache before asking Geocoder and remembers its answers.
+// Cache failures are not fatal; the address is geocoded again.
+type Cached struct {
+    Geocoder Geocoder
+    Cache    Cache
+}
+
+func (c *Cached) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    key := NormalizeAddress(address)
+    if coords, ok, err := c.Cache.Get(ctx, key); err == nil && ok {
+        return coords, nil
+    }
+    coords, err := c.Geocoder.Geocode(ctx, address)
+    if err != nil {
+        return coords, err
+    }
+    c.Cache.Put(ctx, key, coords)
+    return coords, nil
+}
+
+// Reverse is not cached; map pins rarely repeat exactly.
+func (c *Cached) Reverse(ctx context.Context, coords Coordinates) (Place, error) {
+    return c.Geocoder.Reverse(ctx, coords)
+}
+
+// PostgresCache keeps results in the geocode_cache table, so they survive
+// restarts and are shared with dbinitializr.
+type PostgresCache struct {
+    db *sql.DB
+}
+
+func NewPostgresCache(db *sql.DB) *PostgresCache {
+    return &PostgresCache{db: db}
+}
+
+func (p *PostgresCache) Get(ctx context.Context, key string) (Coordinates, bool, error) {
+    var c Coordinates
+    err := p.db.QueryRowContext(ctx, `SELECT lat, lon FROM geocode_cache WHERE address_key = $1`, key).Scan(&c.Lat, &c.Lon)
+    if err == sql.ErrNoRows {
+        return c, false, nil
+    }
+    return c, err == nil, err
+}
+
+func (p *PostgresCache) Put(ctx context.Context, key string, c Coordinates) error {
+    _, err := p.db.ExecContext(ctx, `
+        INSERT INTO geocode_cache (address_key, lat, lon) VALUES ($1, $2, $3)
+        ON CONFLICT (address_key) DO UPDATE SET lat = EXCLUDED.lat, lon = EXCLUDED.lon, created_at = now()`,
+        key, c.Lat, c.Lon)
+    return err
+}
+
+type MemoryCache struct {
+    mu      sync.RWMutex
+    entries map[string]Coordinates
+}
+
+func NewMemoryCache() *MemoryCache {
+    return &MemoryCache{entries: map[string]Coordinates{}}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (Coordinates, bool, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    c, ok := m.entries[key]
+    return c, ok, nil
+}
+
+func (m *MemoryCache) Put(ctx context.Context, key string, c Coordinates) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.entries[key] = c
+    return nil
+}
@@ -0,0 +1,56 @@
+package geocoding
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+// Chain tries its geocoders in order and returns the first result.
+type Chain []Geocoder
+
+func (c Chain) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    var errs []error
+    for _, g := range c {
+        coords, err := g.Geocode(ctx, address)
+        if err == nil {
+            return coords, nil
+        }
+        if ctx.Err() != nil {
+            return Coordinates{}, ctx.Err()
+        }
+        errs = append(errs, err)
+    }
+    return Coordinates{}, chainError(errs)
+}
+
+func (c Chain) Reverse(ctx context.Context, coords Coordinates) (Place, error) {
+    var errs []error
+    for _, g := range c {
+        place, err := g.Reverse(ctx, coords)
+        if err == nil {
+            return place, nil
+        }
+        if ctx.Err() != nil {
+            return Place{}, ctx.Err()
+        }
+        errs = append(errs, err)
+    }
+    return Place{}, chainError(errs)
+}
+
+// chainError reports ErrNoResults when every provider simply found nothing.
+// Otherwise it wraps only the failures, so the place is looked up again
+// later rather than given up on.
+func chainError(errs []error) error {
+    var failures []error
+    for _, err := range errs {
+        if !errors.Is(err, ErrNoResults) {
+            failures = append(failures, err)
+        }
+    }
+    if len(errs) > 0 && len(failures) == 0 {
+        return ErrNoResults
+    }
+    return fmt.Errorf("all geocoding attempts failed: %w", errors.Join(failures...))
+}
@@ -1,27 +1,169 @@
 package geocoding
 
 import (
-    "encoding/json"
+    "context"
     "errors"
     "fmt"
-    "net/http"
-    "net/url"
-    "strconv"
+    "os"
     "strings"
-    "time"
 )
 
-type NominatimResponse []struct {
-    Lat string `json:"lat"`
-    Lon string `json:"lon"`
+// ErrNoResults is returned when a provider knows no place for the address.
+var ErrNoResults = errors.New("no results found for the address")
+
+// ErrRateLimited is returned when a provider turns requests away with 429.
+var ErrRateLimited = errors.New("rate limited by the geocoding provider")
+
+// Codes the worker stores in geocodeError. Provider errors can hold URLs,
+// addresses of internal hosts and response bodies, so they are only logged.
+const (
+    ErrorNotFound            = "not_found"
+    ErrorRateLimited         = "rate_limited"
+    ErrorUpstreamUnavailable = "upstream_unavailable"
+)
+
+// ErrorCode is the code stored in geocodeError for err.
+func ErrorCode(err error) string {
+    switch {
+    case errors.Is(err, ErrNoResults):
+        return ErrorNotFound
+    case errors.Is(err, ErrRateLimited):
+        return ErrorRateLimited
+    default:
+        return ErrorUpstreamUnavailable
+    }
+}
+
+type Coordinates struct {
+    Lat float64 `json:"lat"`
+    Lon float64 `json:"lon"`
+}
+
+// Place is what reverse geocoding knows about a point. Address holds the
+// street and house number.
+type Place struct {
+    Address string
+    City    string
+    Country string
+}
+
+// Geocoder turns a free-form address into coordinates and coordinates
+// back into a place.
+type Geocoder interface {
+    Geocode(ctx context.Context, address string) (Coordinates, error)
+    Reverse(ctx context.Context, c Coordinates) (Place, error)
+}
+
+const (
+    defaultNominatimURL = "https://nominatim.openstreetmap.org"
+    defaultPhotonURL    = "https://photon.komoot.io"
+    defaultUserAgent    = "CoffeeApiGeocoder/1.0"
+)
+
+// Config selects and configures the providers New chains together.
+type Config struct {
+    // Providers are tried in order: "static", "nominatim" and "photon".
+    Providers    []string
+    NominatimURL string
+    PhotonURL    string
+    UserAgent    string
+    // StaticFile is the JSON file read by the static provider.
+    StaticFile string
+}
+
+// ConfigFromEnv reads GEOCODER_PROVIDERS (comma separated), NOMINATIM_URL,
+// PHOTON_URL, GEOCODER_USER_AGENT and GEOCODER_STATIC_FILE. Unset values
+// keep the public services, preceded by the static file when one is given.
+func ConfigFromEnv() Config {
+    cfg := Config{
+        NominatimURL: orDefault(os.Getenv("NOMINATIM_URL"), defaultNominatimURL),
+        PhotonURL:    orDefault(os.Getenv("PHOTON_URL"), defaultPhotonURL),
+        UserAgent:    orDefault(os.Getenv("GEOCODER_USER_AGENT"), defaultUserAgent),
+        StaticFile:   os.Getenv("GEOCODER_STATIC_FILE"),
+    }
+    if providers := os.Getenv("GEOCODER_PROVIDERS"); providers != "" {
+        for _, p := range strings.Split(providers, ",") {
+            cfg.Providers = append(cfg.Providers, strings.TrimSpace(p))
+        }
+    } else {
+        if cfg.StaticFile != "" {
+            cfg.Providers = append(cfg.Providers, "static")
+        }
+        cfg.Providers = append(cfg.Providers, "nominatim", "photon")
+    }
+    return cfg
+}
+
+// New builds the chain of providers described by cfg. When cache is not
+// nil, results are looked up in and saved to it.
+func New(cfg Config, cache Cache) (Geocoder, error) {
+    var chain Chain
+    for _, name := range cfg.Providers {
+        switch name {
+        case "static":
+            static, err := LoadStatic(cfg.StaticFile)
+            if err != nil {
+                return nil, err
+            }
+            chain = append(chain, static)
+        case "nominatim":
+            chain = append(chain, NewNominatim(orDefault(cfg.NominatimURL, defaultNominatimURL), orDefault(cfg.UserAgent, defaultUserAgent)))
+        case "photon":
+            chain = append(chain, NewPhoton(orDefault(cfg.PhotonURL, defaultPhotonURL)))
+        default:
+            return nil, fmt.Errorf("unknown geocoding provider %q", name)
+        }
+    }
+    if len(chain) == 0 {
+        return nil, errors.New("no geocoding providers configured")
+    }
+    var g Geocoder = chain
+    if len(chain) == 1 {
+        g = chain[0]
+    }
+    if cache != nil {
+        g = &Cached{Geocoder: g, Cache: cache}
+    }
+    return g, nil
+}
+
+func orDefault(value, fallback string) string {
+    if value == "" {
+        return fallback
+    }
+    return value
 }
 
-type PhotonResponse struct {
-    Features []struct {
-        Geometry struct {
-            Coordinates []float64 `json:"coordinates"` // [lon, lat]
-        } `json:"geometry"`
-    } `json:"features"`
+func joinNonEmpty(sep string, parts ...string) string {
+    var kept []string
+    for _, p := range parts {
+        if p != "" {
+            kept = append(kept, p)
+        }
+    }
+    return strings.Join(kept, sep)
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// NormalizeAddress is the cache key of an address: lower case, ASCII
+// letters in place of Polish ones and single spaces around commas.
+func NormalizeAddress(address string) string {
+    parts := strings.Split(strings.ToLower(translatePolishChars(address)), ",")
+    var kept []string
+    for _, p := range parts {
+        if p = strings.Join(strings.Fields(p), " "); p != "" {
+            kept = append(kept, p)
+        }
+    }
+    return strings.Join(kept, ", ")
 }
 
 func translatePolishChars(s string) string {
@@ -47,84 +189,3 @@ func removeStreetPrefixes(address string) string {
     }
     return address
 }
-
-func getNominatimCoordinates(address string) (float64, float64, error) {
-    encodedAddress := url.QueryEscape(address)
-    requestURL := fmt.Sprintf("https://nominatim.openstreetmap.org/search?format=json&q=%s", encodedAddress)
-    client := &http.Client{Timeout: 10 * time.Second}
-    req, err := http.NewRequest("GET", requestURL, nil)
-    if err != nil {
-        return 0, 0, err
-    }
-    req.Header.Set("User-Agent", "CoffeeApiGeocoder/1.0")
-    resp, err := client.Do(req)
-    if err != nil {
-        return 0, 0, err
-    }
-    defer resp.Body.Close()
-    if resp.StatusCode != http.StatusOK {
-        return 0, 0, errors.New("geocoding API request failed")
-    }
-    var results NominatimResponse
-    if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
-        return 0, 0, err
-    }
-    if len(results) == 0 {
-        return 0, 0, errors.New("no results found for the address")
-    }
-    lat, err := strconv.ParseFloat(results[0].Lat, 64)
-    if err != nil {
-        return 0, 0, err
-    }
-    lon, err := strconv.ParseFloat(results[0].Lon, 64)
-    if err != nil {
-        return 0, 0, err
-    }
-    return lat, lon, nil
-}
-
-func getPhotonCoordinates(address string) (float64, float64, error) {
-    encodedAddress := url.QueryEscape(address)
-    requestURL := fmt.Sprintf("https://photon.komoot.io/api/?q=%s&limit=1", encodedAddress)
-    client := &http.Client{Timeout: 10 * time.Second}
-    resp, err := client.Get(requestURL)
-    if err != nil {
-        return 0, 0, err
-    }
-    defer resp.Body.Close()
-    if resp.StatusCode != http.StatusOK {
-        return 0, 0, fmt.Errorf("photon API request failed with status: %d", resp.StatusCode)
-    }
-    var pr PhotonResponse
-    if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
-        return 0, 0, err
-    }
-    if len(pr.Features) == 0 || len(pr.Features[0].Geometry.Coordinates) < 2 {
-        return 0, 0, errors.New("photon: no results found for the address")
-    }
-    coords := pr.Features[0].Geometry.Coordinates
-    return coords[1], coords[0], nil
-}
-
-func GetCoordinates(address string) (float64, float64, error) {
-    address = translatePolishChars(address)
-    fmt.Println("Address:", address)
-    lat, lon, err := getNominatimCoordinates(address)
-    if err == nil {
-        return lat, lon, nil
-    }
-    if strings.Contains(err.Error(), "no results") {
-        modifiedAddress := removeStreetPrefixes(address)
-        fmt.Println("Retrying with modified address:", modifiedAddress)
-        lat, lon, err = getNominatimCoordinates(modifiedAddress)
-        if err == nil {
-            return lat, lon, nil
-        }
-    }
-    fmt.Println("Using Photon fallback for address:", address)
-    lat, lon, err = getPhotonCoordinates(address)
-    if err == nil {
-        return lat, lon, nil
-    }
-    return 0, 0, fmt.Errorf("all geocoding attempts failed: %v", err)
-}
\ No newline at end of file
@@ -0,0 +1,147 @@
+package geocoding
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type NominatimResponse []struct {
+    Lat string `json:"lat"`
+    Lon string `json:"lon"`
+}
+
+type NominatimReverseResponse struct {
+    Error   string `json:"error"`
+    Address struct {
+        Road        string `json:"road"`
+        HouseNumber string `json:"house_number"`
+        City        string `json:"city"`
+        Town        string `json:"town"`
+        Village     string `json:"village"`
+        Country     string `json:"country"`
+    } `json:"address"`
+}
+
+// Nominatim queries a Nominatim server. Requests are spaced at least
+// MinInterval apart, as the public instance's usage policy allows one
+// request per second.
+type Nominatim struct {
+    BaseURL     string
+    UserAgent   string
+    Client      *http.Client
+    MinInterval time.Duration
+
+    mu   sync.Mutex
+    next time.Time
+}
+
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+    return &Nominatim{
+        BaseURL:     strings.TrimSuffix(baseURL, "/"),
+        UserAgent:   userAgent,
+        Client:      &http.Client{Timeout: 10 * time.Second},
+        MinInterval: time.Second,
+    }
+}
+
+// wait blocks until the next request may be sent.
+func (n *Nominatim) wait(ctx context.Context) error {
+    n.mu.Lock()
+    at := n.next
+    if now := time.Now(); at.Before(now) {
+        at = now
+    }
+    n.next = at.Add(n.MinInterval)
+    n.mu.Unlock()
+
+    timer := time.NewTimer(time.Until(at))
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+// Geocode retries without street prefixes such as "ul." when the full
+// address is not found.
+func (n *Nominatim) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    address = translatePolishChars(address)
+    c, err := n.search(ctx, address)
+    if errors.Is(err, ErrNoResults) {
+        if modified := removeStreetPrefixes(address); modified != address {
+            return n.search(ctx, modified)
+        }
+    }
+    return c, err
+}
+
+// get sends a rate limited request and decodes the JSON response into v.
+func (n *Nominatim) get(ctx context.Context, requestURL string, v interface{}) error {
+    if err := n.wait(ctx); err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("User-Agent", n.UserAgent)
+    resp, err := n.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusTooManyRequests {
+        return fmt.Errorf("nominatim API request failed with status: %d: %w", resp.StatusCode, ErrRateLimited)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("nominatim API request failed with status: %d", resp.StatusCode)
+    }
+    return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (n *Nominatim) search(ctx context.Context, address string) (Coordinates, error) {
+    var results NominatimResponse
+    if err := n.get(ctx, fmt.Sprintf("%s/search?format=json&limit=1&q=%s", n.BaseURL, url.QueryEscape(address)), &results); err != nil {
+        return Coordinates{}, err
+    }
+    if len(results) == 0 {
+        return Coordinates{}, ErrNoResults
+    }
+    lat, err := strconv.ParseFloat(results[0].Lat, 64)
+    if err != nil {
+        return Coordinates{}, err
+    }
+    lon, err := strconv.ParseFloat(results[0].Lon, 64)
+    if err != nil {
+        return Coordinates{}, err
+    }
+    return Coordinates{Lat: lat, Lon: lon}, nil
+}
+
+func (n *Nominatim) Reverse(ctx context.Context, c Coordinates) (Place, error) {
+    var result NominatimReverseResponse
+    requestURL := fmt.Sprintf("%s/reverse?format=json&lat=%s&lon=%s", n.BaseURL,
+        strconv.FormatFloat(c.Lat, 'f', -1, 64), strconv.FormatFloat(c.Lon, 'f', -1, 64))
+    if err := n.get(ctx, requestURL, &result); err != nil {
+        return Place{}, err
+    }
+    if result.Error != "" {
+        return Place{}, ErrNoResults
+    }
+    a := result.Address
+    return Place{
+        Address: joinNonEmpty(" ", a.Road, a.HouseNumber),
+        City:    firstNonEmpty(a.City, a.Town, a.Village),
+        Country: a.Country,
+    }, nil
+}
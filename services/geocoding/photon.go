@@ -0,0 +1,84 @@
+package geocoding
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type PhotonResponse struct {
+    Features []struct {
+        Geometry struct {
+            Coordinates []float64 `json:"coordinates"` // [lon, lat]
+        } `json:"geometry"`
+        Properties struct {
+            Street      string `json:"street"`
+            HouseNumber string `json:"housenumber"`
+            City        string `json:"city"`
+            Country     string `json:"country"`
+        } `json:"properties"`
+    } `json:"features"`
+}
+
+type Photon struct {
+    BaseURL string
+    Client  *http.Client
+}
+
+func NewPhoton(baseURL string) *Photon {
+    return &Photon{
+        BaseURL: strings.TrimSuffix(baseURL, "/"),
+        Client:  &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+func (p *Photon) get(ctx context.Context, requestURL string) (PhotonResponse, error) {
+    var pr PhotonResponse
+    req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+    if err != nil {
+        return pr, err
+    }
+    resp, err := p.Client.Do(req)
+    if err != nil {
+        return pr, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusTooManyRequests {
+        return pr, fmt.Errorf("photon API request failed with status: %d: %w", resp.StatusCode, ErrRateLimited)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return pr, fmt.Errorf("photon API request failed with status: %d", resp.StatusCode)
+    }
+    err = json.NewDecoder(resp.Body).Decode(&pr)
+    return pr, err
+}
+
+func (p *Photon) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    pr, err := p.get(ctx, fmt.Sprintf("%s/api/?q=%s&limit=1", p.BaseURL, url.QueryEscape(translatePolishChars(address))))
+    if err != nil {
+        return Coordinates{}, err
+    }
+    if len(pr.Features) == 0 || len(pr.Features[0].Geometry.Coordinates) < 2 {
+        return Coordinates{}, ErrNoResults
+    }
+    coords := pr.Features[0].Geometry.Coordinates
+    return Coordinates{Lat: coords[1], Lon: coords[0]}, nil
+}
+
+func (p *Photon) Reverse(ctx context.Context, c Coordinates) (Place, error) {
+    pr, err := p.get(ctx, fmt.Sprintf("%s/reverse?lat=%s&lon=%s&limit=1", p.BaseURL,
+        strconv.FormatFloat(c.Lat, 'f', -1, 64), strconv.FormatFloat(c.Lon, 'f', -1, 64)))
+    if err != nil {
+        return Place{}, err
+    }
+    if len(pr.Features) == 0 {
+        return Place{}, ErrNoResults
+    }
+    props := pr.Features[0].Properties
+    return Place{Address: joinNonEmpty(" ", props.Street, props.HouseNumber), City: props.City, Country: props.Country}, nil
+}
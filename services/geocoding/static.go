@@ -0,0 +1,90 @@
+package geocoding
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math"
+    "os"
+    "strings"
+)
+
+// staticReverseRadiusKm is how close a point must be to a known address
+// for Static to reverse geocode it.
+const staticReverseRadiusKm = 0.1
+
+type staticEntry struct {
+    address string
+    coords  Coordinates
+}
+
+// Static answers from a fixed table of addresses and works without network
+// access. Addresses are matched by NormalizeAddress.
+type Static struct {
+    entries map[string]staticEntry
+}
+
+// LoadStatic reads a JSON object mapping addresses, written as
+// "street, city, country", to {"lat": ..., "lon": ...}.
+func LoadStatic(path string) (*Static, error) {
+    if path == "" {
+        return nil, fmt.Errorf("static geocoding provider needs GEOCODER_STATIC_FILE")
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var entries map[string]Coordinates
+    if err := json.Unmarshal(data, &entries); err != nil {
+        return nil, fmt.Errorf("reading %s: %w", path, err)
+    }
+    return NewStatic(entries), nil
+}
+
+func NewStatic(entries map[string]Coordinates) *Static {
+    s := &Static{entries: map[string]staticEntry{}}
+    for address, c := range entries {
+        s.entries[NormalizeAddress(address)] = staticEntry{address: address, coords: c}
+    }
+    return s
+}
+
+func (s *Static) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    if e, ok := s.entries[NormalizeAddress(address)]; ok {
+        return e.coords, nil
+    }
+    return Coordinates{}, ErrNoResults
+}
+
+// Reverse returns the nearest known address within staticReverseRadiusKm.
+func (s *Static) Reverse(ctx context.Context, c Coordinates) (Place, error) {
+    best, bestDistance := "", math.Inf(1)
+    for _, e := range s.entries {
+        if d := distanceKm(c, e.coords); d < bestDistance {
+            best, bestDistance = e.address, d
+        }
+    }
+    if bestDistance > staticReverseRadiusKm {
+        return Place{}, ErrNoResults
+    }
+    parts := strings.Split(best, ",")
+    for i := range parts {
+        parts[i] = strings.TrimSpace(parts[i])
+    }
+    place := Place{Country: parts[len(parts)-1]}
+    if len(parts) > 1 {
+        place.City = parts[len(parts)-2]
+    }
+    if len(parts) > 2 {
+        place.Address = strings.Join(parts[:len(parts)-2], ", ")
+    }
+    return place, nil
+}
+
+func distanceKm(a, b Coordinates) float64 {
+    rad := math.Pi / 180
+    dLat := (b.Lat - a.Lat) * rad
+    dLon := (b.Lon - a.Lon) * rad
+    h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Pow(math.Sin(dLon/2), 2)
+    return 2 * 6371 * math.Asin(math.Sqrt(math.Min(1, h)))
+}
@@ -0,0 +1,145 @@
+package geocoding
+
+import (
+    "context"
+    "errors"
+    "log"
+    "sync"
+    "time"
+
+    "coffeeApi/services/store"
+)
+
+// Worker resolves the coordinates of pending shops and roasteries, and the
+// address of map pins saved without one, in the background, so creating
+// them never waits for the geocoding providers.
+type Worker struct {
+    Queue    store.GeocodeQueue
+    Geocoder Geocoder
+
+    Workers      int
+    MaxAttempts  int
+    BaseBackoff  time.Duration
+    MaxBackoff   time.Duration
+    PollInterval time.Duration
+    // Lease is how long a claimed job is hidden from other workers; it must
+    // outlast one geocoding attempt.
+    Lease time.Duration
+
+    wake chan struct{}
+}
+
+func NewWorker(queue store.GeocodeQueue, geocoder Geocoder) *Worker {
+    return &Worker{
+        Queue:        queue,
+        Geocoder:     geocoder,
+        Workers:      2,
+        MaxAttempts:  5,
+        BaseBackoff:  30 * time.Second,
+        MaxBackoff:   time.Hour,
+        PollInterval: 30 * time.Second,
+        Lease:        5 * time.Minute,
+        wake:         make(chan struct{}, 1),
+    }
+}
+
+// Notify tells the worker that new jobs are waiting. It never blocks.
+func (w *Worker) Notify() {
+    select {
+    case w.wake <- struct{}{}:
+    default:
+    }
+}
+
+// Run claims and processes jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+    jobs := make(chan store.GeocodeJob)
+    var wg sync.WaitGroup
+    for i := 0; i < w.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for job := range jobs {
+                w.process(ctx, job)
+            }
+        }()
+    }
+    defer func() {
+        close(jobs)
+        wg.Wait()
+    }()
+
+    for {
+        claimed, err := w.Queue.Claim(ctx, w.Workers, w.Lease)
+        if err != nil && ctx.Err() == nil {
+            log.Printf("geocoding worker: claiming jobs: %v", err)
+        }
+        for _, job := range claimed {
+            select {
+            case jobs <- job:
+            case <-ctx.Done():
+                return
+            }
+        }
+        // A full batch suggests more jobs are due right away.
+        if len(claimed) == w.Workers {
+            continue
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-w.wake:
+        case <-time.After(w.PollInterval):
+        }
+    }
+}
+
+func (w *Worker) process(ctx context.Context, job store.GeocodeJob) {
+    resolve, err := w.lookup(ctx, job)
+    if ctx.Err() != nil {
+        // The lease runs out and the job is claimed again after a restart.
+        return
+    }
+    if err != nil {
+        log.Printf("geocoding worker: %s %d, attempt %d: %v", job.Kind, job.ID, job.Attempts+1, err)
+    }
+    switch {
+    case err == nil:
+        err = resolve()
+    case errors.Is(err, ErrNoResults) || job.Attempts+1 >= w.MaxAttempts:
+        // A place no provider knows will not be found by retrying.
+        err = w.Queue.Fail(ctx, job, ErrorCode(err))
+    default:
+        err = w.Queue.Retry(ctx, job, ErrorCode(err), time.Now().Add(w.backoff(job.Attempts)))
+    }
+    if err != nil {
+        log.Printf("geocoding worker: %s %d: %v", job.Kind, job.ID, err)
+    }
+}
+
+// lookup asks the providers for the coordinates of the job's address, or
+// the address of its pin, and returns how to store the answer.
+func (w *Worker) lookup(ctx context.Context, job store.GeocodeJob) (func() error, error) {
+    if job.Reverse {
+        place, err := w.Geocoder.Reverse(ctx, Coordinates{Lat: job.Lat, Lon: job.Lon})
+        return func() error {
+            return w.Queue.ResolveAddress(ctx, job, place.Address, place.City, place.Country)
+        }, err
+    }
+    coords, err := w.Geocoder.Geocode(ctx, job.Address)
+    return func() error {
+        return w.Queue.Resolve(ctx, job, coords.Lat, coords.Lon)
+    }, err
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+    d := w.BaseBackoff
+    for i := 0; i < attempts && d < w.MaxBackoff; i++ {
+        d *= 2
+    }
+    if d > w.MaxBackoff {
+        d = w.MaxBackoff
+    }
+    return d
+}
@@ -0,0 +1,155 @@
+package geocoding
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "testing"
+    "time"
+
+    "coffeeApi/services/models"
+    "coffeeApi/services/store"
+)
+
+var florianska = Coordinates{Lat: 50.0625, Lon: 19.9395}
+
+// runOnce processes every job that is due.
+func runOnce(t *testing.T, w *Worker) {
+    t.Helper()
+    jobs, err := w.Queue.Claim(context.Background(), 10, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, job := range jobs {
+        w.process(context.Background(), job)
+    }
+}
+
+func TestWorkerLocatesShops(t *testing.T) {
+    tests := []struct {
+        name string
+        shop models.CoffeeShop
+        want models.CoffeeShop
+    }{
+        {
+            name: "address",
+            shop: models.CoffeeShop{Address: "ul. Floriańska 1", City: "Kraków", Country: "Poland", GeocodeStatus: store.GeocodePending},
+            want: models.CoffeeShop{Address: "ul. Floriańska 1", City: "Kraków", Country: "Poland", Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved},
+        },
+        {
+            name: "unknown address",
+            shop: models.CoffeeShop{Address: "Nowhere 1", City: "Kraków", Country: "Poland", GeocodeStatus: store.GeocodePending},
+            want: models.CoffeeShop{Address: "Nowhere 1", City: "Kraków", Country: "Poland", GeocodeStatus: store.GeocodeFailed, GeocodeError: ErrorNotFound},
+        },
+        {
+            name: "pin",
+            shop: models.CoffeeShop{Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved, AddressPending: true},
+            want: models.CoffeeShop{Address: "ul. Floriańska 1", City: "Kraków", Country: "Poland", Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved},
+        },
+        {
+            name: "pin with a city",
+            shop: models.CoffeeShop{City: "Cracow", Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved, AddressPending: true},
+            want: models.CoffeeShop{Address: "ul. Floriańska 1", City: "Cracow", Country: "Poland", Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved},
+        },
+        {
+            name: "pin at sea",
+            shop: models.CoffeeShop{Lat: 55, Lon: 18, GeocodeStatus: store.GeocodeResolved, AddressPending: true},
+            want: models.CoffeeShop{Lat: 55, Lon: 18, GeocodeStatus: store.GeocodeResolved, GeocodeError: ErrorNotFound},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            stores := store.NewMemoryStores()
+            w := NewWorker(stores.Geocoding, NewStatic(map[string]Coordinates{"ul. Floriańska 1, Kraków, Poland": florianska}))
+            shop := tt.shop
+            shop.Name = "Test"
+            if err := stores.Shops.Create(context.Background(), &shop); err != nil {
+                t.Fatal(err)
+            }
+
+            runOnce(t, w)
+
+            got, err := stores.Shops.Get(context.Background(), shop.ID)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got.Address != tt.want.Address || got.City != tt.want.City || got.Country != tt.want.Country ||
+                got.Lat != tt.want.Lat || got.Lon != tt.want.Lon || got.GeocodeStatus != tt.want.GeocodeStatus ||
+                got.GeocodeError != tt.want.GeocodeError || got.AddressPending {
+                t.Errorf("shop = %+v, want %+v", got, tt.want)
+            }
+            if got.Version != shop.Version+1 {
+                t.Errorf("version = %d, want %d", got.Version, shop.Version+1)
+            }
+        })
+    }
+}
+
+func TestWorkerDropsResultsForMovedPins(t *testing.T) {
+    stores := store.NewMemoryStores()
+    w := NewWorker(stores.Geocoding, NewStatic(map[string]Coordinates{"ul. Floriańska 1, Kraków, Poland": florianska}))
+    shop := models.CoffeeShop{Name: "Test", Lat: florianska.Lat, Lon: florianska.Lon, GeocodeStatus: store.GeocodeResolved, AddressPending: true}
+    if err := stores.Shops.Create(context.Background(), &shop); err != nil {
+        t.Fatal(err)
+    }
+    jobs, err := w.Queue.Claim(context.Background(), 10, time.Minute)
+    if err != nil || len(jobs) != 1 || !jobs[0].Reverse {
+        t.Fatalf("claimed %+v, %v", jobs, err)
+    }
+
+    shop.Lat, shop.Lon = 55, 18
+    if err := stores.Shops.Update(context.Background(), &shop); err != nil {
+        t.Fatal(err)
+    }
+    w.process(context.Background(), jobs[0])
+
+    got, _ := stores.Shops.Get(context.Background(), shop.ID)
+    if got.Address != "" || !got.AddressPending {
+        t.Errorf("address of the old pin stored: %+v", got)
+    }
+}
+
+// failing answers every request with err.
+type failing struct{ err error }
+
+func (f failing) Geocode(ctx context.Context, address string) (Coordinates, error) {
+    return Coordinates{}, f.err
+}
+
+func (f failing) Reverse(ctx context.Context, c Coordinates) (Place, error) {
+    return Place{}, f.err
+}
+
+func TestWorkerStoresErrorCodes(t *testing.T) {
+    tests := []struct {
+        name        string
+        err         error
+        maxAttempts int
+        status      string
+        code        string
+    }{
+        {"network error", errors.New(`Get "http://10.0.0.7/search?q=secret": dial tcp: connection refused`), 5, store.GeocodePending, ErrorUpstreamUnavailable},
+        {"rate limited", fmt.Errorf("nominatim API request failed with status: 429: %w", ErrRateLimited), 5, store.GeocodePending, ErrorRateLimited},
+        {"last attempt", errors.New("photon API request failed with status: 503"), 1, store.GeocodeFailed, ErrorUpstreamUnavailable},
+        {"one provider found nothing", chainError([]error{ErrNoResults, fmt.Errorf("status: 429: %w", ErrRateLimited)}), 5, store.GeocodePending, ErrorRateLimited},
+        {"no provider found anything", chainError([]error{ErrNoResults, ErrNoResults}), 5, store.GeocodeFailed, ErrorNotFound},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            stores := store.NewMemoryStores()
+            w := NewWorker(stores.Geocoding, failing{tt.err})
+            w.MaxAttempts = tt.maxAttempts
+            shop := models.CoffeeShop{Name: "Test", Address: "Floriańska 1", City: "Kraków", Country: "Poland", GeocodeStatus: store.GeocodePending}
+            if err := stores.Shops.Create(context.Background(), &shop); err != nil {
+                t.Fatal(err)
+            }
+
+            runOnce(t, w)
+
+            got, _ := stores.Shops.Get(context.Background(), shop.ID)
+            if got.GeocodeStatus != tt.status || got.GeocodeError != tt.code {
+                t.Errorf("status %q, error %q; want %q, %q", got.GeocodeStatus, got.GeocodeError, tt.status, tt.code)
+            }
+        })
+    }
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/mailer"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+const mailTimeout = 30 * time.Second
+
+// verificationState ties a verification token to the address it was sent
+// to and to the account still being unverified.
+func verificationState(u models.User) string {
+    return strings.ToLower(u.Email) + "|" + strconv.FormatBool(u.EmailVerified)
+}
+
+// sendMail delivers m in the background, so a slow mail server neither
+// delays the response nor reveals whether an account exists.
+func (h *UserHandler) sendMail(m mailer.Message) {
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+        defer cancel()
+        if err := h.mailer.Send(ctx, m); err != nil {
+            log.Printf("sending %q to %s: %v", m.Subject, m.To, err)
+        }
+    }()
+}
+
+func (h *UserHandler) sendVerification(user models.User) {
+    token, err := auth.NewActionToken(auth.PurposeVerifyEmail, user.ID, verificationState(user), auth.VerifyEmailTTL)
+    if err != nil {
+        log.Printf("verification token for user %d: %v", user.ID, err)
+        return
+    }
+    link := h.publicURL + "/email/verify?token=" + url.QueryEscape(token)
+    h.sendMail(mailer.Message{
+        To:      user.Email,
+        Subject: "Confirm your email address",
+        Body: fmt.Sprintf("Hi %s,\n\nconfirm your email address by opening this link within %d hours:\n\n%s\n",
+            user.Username, int(auth.VerifyEmailTTL.Hours()), link),
+    })
+}
+
+type tokenRequest struct {
+    Token string `json:"token" validate:"required"`
+}
+
+// actionToken reads the token from the query string or the JSON body. It
+// answers 400 and returns false when there is none.
+func actionToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+    if token := r.URL.Query().Get("token"); token != "" {
+        return token, true
+    }
+    var body tokenRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return "", false
+    }
+    return body.Token, valid(w, &body, errs)
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified. A token stops working once it is used or the address changes.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+    token, ok := actionToken(w, r)
+    if !ok {
+        return
+    }
+    user, ok := h.actionTokenUser(w, r, token)
+    if !ok {
+        return
+    }
+    if err := auth.VerifyActionToken(token, auth.PurposeVerifyEmail, verificationState(user)); err != nil {
+        problem.Error(w, http.StatusBadRequest, problem.InvalidToken, err.Error())
+        return
+    }
+    if err := h.users.SetEmailVerified(r.Context(), user.ID); err != nil {
+        writeStoreError(w, err, "User not found", "Database update error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification sends a new verification email to the caller.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.currentUser(w, r)
+    if !ok {
+        return
+    }
+    if user.EmailVerified {
+        problem.Error(w, http.StatusConflict, problem.Conflict, "Email is already verified")
+        return
+    }
+    h.sendVerification(user)
+    w.WriteHeader(http.StatusAccepted)
+}
+
+type forgotPasswordRequest struct {
+    Email string `json:"email"`
+}
+
+// ForgotPassword emails a password reset token. It answers 202 whether or
+// not the address belongs to an account.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+    var body forgotPasswordRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+    user, err := h.users.GetByEmail(r.Context(), strings.TrimSpace(body.Email))
+    if err == nil {
+        h.sendPasswordReset(user)
+    } else if err != store.ErrNotFound {
+        log.Printf("password reset for %s: %v", body.Email, err)
+    }
+    w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *UserHandler) sendPasswordReset(user models.User) {
+    // The token is bound to the current password hash, so it is spent as
+    // soon as the password changes.
+    token, err := auth.NewActionToken(auth.PurposeResetPassword, user.ID, user.Password, auth.ResetPasswordTTL)
+    if err != nil {
+        log.Printf("password reset token for user %d: %v", user.ID, err)
+        return
+    }
+    h.sendMail(mailer.Message{
+        To:      user.Email,
+        Subject: "Reset your password",
+        Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset your password. To choose a new one within the next hour, "+
+            "send this token with the new password to POST %s/password/reset:\n\n%s\n\nIf it was not you, ignore this email.\n",
+            user.Username, h.publicURL, token),
+    })
+}
+
+type resetPasswordRequest struct {
+    Token       string `json:"token" validate:"required"`
+    NewPassword string `json:"newPassword"`
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// revokes every session of the user.
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+    var body resetPasswordRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if err := validatePassword(body.NewPassword); err != nil {
+        errs = append(errs, fieldError("newPassword", err))
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+    user, ok := h.actionTokenUser(w, r, body.Token)
+    if !ok {
+        return
+    }
+    if err := auth.VerifyActionToken(body.Token, auth.PurposeResetPassword, user.Password); err != nil {
+        problem.Error(w, http.StatusBadRequest, problem.InvalidToken, err.Error())
+        return
+    }
+
+    hashed, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("hashing password: %w", err))
+        return
+    }
+    if err := h.users.SetPassword(r.Context(), user.ID, string(hashed)); err != nil {
+        writeStoreError(w, err, "User not found", "Database update error")
+        return
+    }
+    if err := h.revokeCredentials(r, user.ID); err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeCredentials ends every session of the user and deletes their API
+// keys, so whoever knew the old password loses access.
+func (h *UserHandler) revokeCredentials(r *http.Request, userID int) error {
+    if err := h.sessions.RevokeUser(r.Context(), userID); err != nil {
+        return err
+    }
+    return h.apiKeys.RevokeUser(r.Context(), userID)
+}
+
+// actionTokenUser loads the user an action token names. Tokens for unknown
+// users get the same answer as any other invalid token.
+func (h *UserHandler) actionTokenUser(w http.ResponseWriter, r *http.Request, token string) (models.User, bool) {
+    id, err := auth.ActionTokenUser(token)
+    if err != nil {
+        problem.Error(w, http.StatusBadRequest, problem.InvalidToken, err.Error())
+        return models.User{}, false
+    }
+    user, err := h.users.Get(r.Context(), id)
+    if err == store.ErrNotFound {
+        problem.Error(w, http.StatusBadRequest, problem.InvalidToken, auth.ErrInvalidActionToken.Error())
+        return user, false
+    } else if err != nil {
+        problem.Internal(w, err)
+        return user, false
+    }
+    return user, true
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+)
+
+const maxAPIKeysPerUser = 20
+
+type APIKeyHandler struct {
+    keys store.APIKeyStore
+}
+
+func NewAPIKeyHandler(keys store.APIKeyStore) *APIKeyHandler {
+    return &APIKeyHandler{keys: keys}
+}
+
+type apiKeyRequest struct {
+    Name   string   `json:"name" validate:"required,max=64"`
+    Scopes []string `json:"scopes" validate:"required"`
+}
+
+// createdAPIKey is an API key with the key itself, which is shown once.
+type createdAPIKey struct {
+    models.APIKey
+    Key string `json:"key"`
+}
+
+// CreateAPIKey creates a key for the caller. The key itself is only part of
+// this response; afterwards it is identified by its prefix.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+    var body apiKeyRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    body.Name = strings.TrimSpace(body.Name)
+    scopes := []string{}
+    seen := map[string]bool{}
+    for _, scope := range body.Scopes {
+        if !auth.ValidScope(scope) {
+            errs = append(errs, problem.FieldError{Field: "scopes", Code: "invalid_choice", Message: "Unknown scope: " + scope})
+            break
+        }
+        if !seen[scope] {
+            seen[scope] = true
+            scopes = append(scopes, scope)
+        }
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+
+    userID := auth.PrincipalFrom(r.Context()).UserID
+    existing, err := h.keys.List(r.Context(), userID)
+    if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    if len(existing) >= maxAPIKeysPerUser {
+        problem.Error(w, http.StatusConflict, problem.Conflict, "Too many API keys, revoke one first")
+        return
+    }
+
+    key, prefix, hash, err := auth.NewAPIKey()
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("generating API key: %w", err))
+        return
+    }
+    created := models.APIKey{UserID: userID, Name: body.Name, Prefix: prefix, Hash: hash, Scopes: scopes}
+    if err := h.keys.Create(r.Context(), &created); err != nil {
+        writeStoreError(w, err, "User not found", "Database insert error")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(createdAPIKey{created, key})
+}
+
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+    keys, err := h.keys.List(r.Context(), auth.PrincipalFrom(r.Context()).UserID)
+    if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(keys)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        badRequest(w, "Invalid API key ID")
+        return
+    }
+    if err := h.keys.Revoke(r.Context(), auth.PrincipalFrom(r.Context()).UserID, id); err != nil {
+        writeStoreError(w, err, "API key not found", "Database delete error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
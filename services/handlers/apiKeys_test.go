@@ -0,0 +1,65 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/middleware"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+    tests := []struct {
+        name   string
+        scopes string
+        method string
+        target string
+        body   string
+        status int
+    }{
+        {"write scope creates coffees", `["coffees:write"]`, "POST", "/coffees", coffeeBody, http.StatusOK},
+        {"read scope cannot create coffees", `["coffees:read"]`, "POST", "/coffees", coffeeBody, http.StatusForbidden},
+        {"scope of another kind", `["shops:write"]`, "POST", "/coffees", coffeeBody, http.StatusForbidden},
+        {"keys cannot make keys", `["coffees:write"]`, "POST", "/me/api-keys", `{"name": "more", "scopes": ["coffees:write"]}`, http.StatusForbidden},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            router, stores, authn := newAccountRouter(t)
+            keys := NewAPIKeyHandler(stores.APIKeys)
+            coffees := NewCoffeeHandler(stores.Coffees)
+            router.Handle("/me/api-keys", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(keys.CreateAPIKey)))).Methods("POST")
+            router.Handle("/coffees", authn.AuthMiddleware(middleware.Authorize(auth.Create, auth.Coffees)(http.HandlerFunc(coffees.CreateCoffee)))).Methods("POST")
+            addUser(t, stores.Users, "ana", "correct horse battery")
+            tokens := login(t, router, "ana", "correct horse battery")
+
+            rec := serveAs(router, "POST", "/me/api-keys", "Bearer "+tokens.Token, `{"name": "test", "scopes": `+tt.scopes+`}`)
+            if rec.Code != http.StatusCreated {
+                t.Fatalf("creating key: status = %d, body %s", rec.Code, rec.Body)
+            }
+            var key createdAPIKey
+            decodeBody(t, rec, &key)
+
+            if rec := serveAs(router, tt.method, tt.target, "ApiKey "+key.Key, tt.body); rec.Code != tt.status {
+                t.Errorf("status = %d, want %d, body %s", rec.Code, tt.status, rec.Body)
+            }
+        })
+    }
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+    router, stores, authn := newAccountRouter(t)
+    keys := NewAPIKeyHandler(stores.APIKeys)
+    router.Handle("/me/api-keys", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(keys.CreateAPIKey)))).Methods("POST")
+    addUser(t, stores.Users, "ana", "correct horse battery")
+    tokens := login(t, router, "ana", "correct horse battery")
+
+    for _, scopes := range []string{`["coffees:admin"]`, `[]`} {
+        rec := serveAs(router, "POST", "/me/api-keys", "Bearer "+tokens.Token, `{"name": "test", "scopes": `+scopes+`}`)
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("scopes %s: status = %d, want 400", scopes, rec.Code)
+        }
+    }
+    if rec := serveAs(router, "POST", "/logout", "ApiKey cdb_00000000_forged", ""); rec.Code != http.StatusUnauthorized {
+        t.Errorf("unknown key: status = %d, want 401", rec.Code)
+    }
+}
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+    "reflect"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/jwk"
+    "coffeeApi/services/models"
+    "coffeeApi/services/openapi"
+)
+
+// Descriptions of the routes registered in main, for the OpenAPI document.
+// The router must have exactly these routes; see openapi.Spec.Build.
+
+func query(name, typ, description string) openapi.Param {
+    return openapi.Param{Name: name, Type: typ, Description: description}
+}
+
+func params(lists ...[]openapi.Param) []openapi.Param {
+    var all []openapi.Param
+    for _, list := range lists {
+        all = append(all, list...)
+    }
+    return all
+}
+
+func listParams(sortKeys string) []openapi.Param {
+    return pagedParams("Page size, 100 by default and at most 500", sortKeys)
+}
+
+// wholeListParams describes the lists that return every match unless the
+// client asks for a page.
+func wholeListParams(sortKeys string) []openapi.Param {
+    return pagedParams("Page size, at most 500; 100 with only offset or cursor. Without limit, offset and cursor every match is returned", sortKeys)
+}
+
+func pagedParams(limit, sortKeys string) []openapi.Param {
+    return []openapi.Param{
+        query("limit", "integer", limit),
+        query("offset", "integer", "Number of matches to skip; cannot be combined with cursor"),
+        query("cursor", "string", "Opaque cursor from the next link of the previous page"),
+        query("sort", "string", "Comma separated fields, \"-\" before a field for descending order: "+sortKeys),
+    }
+}
+
+var (
+    geoParams = []openapi.Param{
+        query("near", "string", "lat,lon to sort by and report distance from"),
+        query("radius", "number", "Kilometres from near"),
+        query("bbox", "string", "minLon,minLat,maxLon,maxLat"),
+        {Name: "geocodeStatus", Type: "string", Enum: []string{"pending", "resolved", "failed"}},
+    }
+    locatedParams = []openapi.Param{
+        query("name", "string", ""),
+        query("country", "string", ""),
+        query("city", "string", ""),
+        query("address", "string", ""),
+        query("website", "string", ""),
+    }
+    ifNoneMatch = []openapi.Param{
+        {Name: "If-None-Match", In: "header", Type: "string", Description: "ETag of a cached copy; answered 304 when it is current"},
+    }
+    ifMatch = []openapi.Param{
+        {Name: "If-Match", In: "header", Type: "string", Description: "ETag of the version being changed; 412 when it is stale. Required when the server runs with REQUIRE_IF_MATCH=true"},
+    }
+)
+
+const geoJSONDescription = "With Accept: application/geo+json the matches are returned as a GeoJSON FeatureCollection, as from the .geojson route."
+
+var apiSpec = openapi.Spec{
+    Info: openapi.Info{
+        Title:       "CoffeeDB API",
+        Description: "REST API for managing coffee data, including coffees, roasteries, coffee shops, and reviews. Errors are RFC 7807 problem details.",
+        Version:     "1.0.0",
+    },
+    Tags: []openapi.Tag{
+        {Name: "Documentation"},
+        {Name: "Authorization", Description: "Accounts, logins and sessions"},
+        {Name: "Users", Description: "Profiles, API keys and user administration"},
+        {Name: "Coffees"},
+        {Name: "Coffee Shops"},
+        {Name: "Roasteries"},
+        {Name: "Reviews"},
+        {Name: "Search"},
+    },
+    Writable: map[reflect.Type][]string{
+        reflect.TypeOf(models.Coffee{}):     coffeeWritable,
+        reflect.TypeOf(models.CoffeeShop{}): locatedWritable,
+        reflect.TypeOf(models.Roastery{}):   locatedWritable,
+        reflect.TypeOf(models.Review{}):     append([]string{"coffeeId", "roasteryId", "coffeeShopId"}, reviewWritable...),
+        reflect.TypeOf(models.User{}):       {"username", "password", "email", "avatarUrl"},
+    },
+    Routes: map[string]openapi.Route{
+        // Documentation
+        "GET /": {
+            Tag: "Documentation", Summary: "Summary of the endpoints",
+            Response: ApiDocumentation{},
+        },
+        "GET /help": {
+            Tag: "Documentation", Summary: "This page",
+            ResponseType: "text/html",
+        },
+        "GET /openapi.json": {
+            Tag: "Documentation", Summary: "OpenAPI 3.1 description of the API",
+        },
+        "GET /.well-known/jwks.json": {
+            Tag: "Documentation", Summary: "Public keys that verify access tokens",
+            Response: jwk.Set{},
+        },
+
+        // Authorization
+        "POST /register": {
+            Tag: "Authorization", Summary: "Register a new user",
+            Description: "New users always get the user role. A verification email is sent to the address.",
+            Body: models.User{}, Response: models.User{},
+        },
+        "POST /login": {
+            Tag: "Authorization", Summary: "Log in and start a session",
+            Description: "Repeated failures lock the account and the client out for a while.",
+            Body: loginRequest{}, Response: tokenResponse{},
+        },
+        "POST /token/refresh": {
+            Tag: "Authorization", Summary: "Exchange a refresh token for new tokens",
+            Description: "Every refresh token works once; using one again revokes its session.",
+            Body: refreshRequest{}, Response: tokenResponse{},
+        },
+        "GET /oidc/{provider}/login": {
+            Tag: "Authorization", Summary: "Log in with an OpenID Connect provider",
+            Params: []openapi.Param{
+                {Name: "provider", In: "path", Type: "string", Description: "Name of a configured provider"},
+                query("login_hint", "string", "Passed on to the provider"),
+            },
+            Status: 302,
+        },
+        "GET /oidc/{provider}/callback": {
+            Tag: "Authorization", Summary: "Finish an OpenID Connect login",
+            Params: []openapi.Param{
+                {Name: "provider", In: "path", Type: "string", Description: "Name of a configured provider"},
+                query("code", "string", ""),
+                query("state", "string", ""),
+            },
+            Response: tokenResponse{},
+        },
+        "GET /email/verify": {
+            Tag: "Authorization", Summary: "Verify an email address",
+            Params: []openapi.Param{{Name: "token", Type: "string", Required: true, Description: "Token from the verification email"}},
+            Status: 204,
+        },
+        "POST /email/verify": {
+            Tag: "Authorization", Summary: "Verify an email address",
+            Body: tokenRequest{}, Status: 204,
+        },
+        "POST /email/verify/resend": {
+            Tag: "Authorization", Summary: "Send the verification email again",
+            Access: openapi.Session, Status: 202,
+        },
+        "POST /password/forgot": {
+            Tag: "Authorization", Summary: "Email a password reset token",
+            Description: "Answered 202 whether or not the address belongs to an account.",
+            Body: forgotPasswordRequest{}, Status: 202,
+        },
+        "POST /password/reset": {
+            Tag: "Authorization", Summary: "Set a new password with a reset token",
+            Description: "Every session and API key of the user is revoked.",
+            Body: resetPasswordRequest{}, Status: 204,
+        },
+        "POST /logout": {
+            Tag: "Authorization", Summary: "End the current session",
+            Access: openapi.Session, Status: 204,
+        },
+        "POST /logout/all": {
+            Tag: "Authorization", Summary: "End every session of the caller",
+            Access: openapi.Session, Status: 204,
+        },
+
+        // Users
+        "GET /me": {
+            Tag: "Users", Summary: "Profile of the caller",
+            Access: openapi.Authenticated, Response: models.User{},
+        },
+        "PUT /me": {
+            Tag: "Users", Summary: "Change the username, email or avatar of the caller",
+            Description: "Fields left out keep their values. A new email has to be verified again.",
+            Access: openapi.Session, Body: updateMeRequest{}, Response: models.User{},
+        },
+        "DELETE /me": {
+            Tag: "Users", Summary: "Delete the caller's account",
+            Access: openapi.Session, Body: deleteMeRequest{}, Status: 204,
+            Params: []openapi.Param{
+                {Name: "reviews", Type: "string", Required: true, Enum: []string{"anonymize", "delete"}, Description: "What happens to the user's reviews"},
+            },
+        },
+        "PUT /me/password": {
+            Tag: "Users", Summary: "Change the caller's password",
+            Description: "Every session and API key is revoked; the response holds tokens of a new session.",
+            Access: openapi.Session, Body: changePasswordRequest{}, Response: tokenResponse{},
+        },
+        "GET /me/api-keys": {
+            Tag: "Users", Summary: "API keys of the caller",
+            Access: openapi.Session, Response: []models.APIKey{},
+        },
+        "POST /me/api-keys": {
+            Tag: "Users", Summary: "Create an API key",
+            Description: "The key is only part of this response. Scopes are kind:read or kind:write, e.g. coffees:write.",
+            Access: openapi.Session, Body: apiKeyRequest{}, Status: 201, Response: createdAPIKey{},
+        },
+        "DELETE /me/api-keys/{id}": {
+            Tag: "Users", Summary: "Revoke an API key",
+            Access: openapi.Session, Status: 204,
+        },
+        "GET /users": {
+            Tag: "Users", Summary: "List users",
+            Access: openapi.Admin, Scope: auth.Scope(auth.Read, auth.Users),
+            Params: params([]openapi.Param{
+                query("username", "string", ""),
+                query("email", "string", ""),
+                query("role", "string", ""),
+            }, listParams("id, username, email, role")),
+            Response: models.User{}, List: true,
+        },
+        "GET /users/{id}": {
+            Tag: "Users", Summary: "Get a user",
+            Description: "Email and role are only shown to the user and admins.",
+            Access: openapi.Optional, Response: userResponse{},
+        },
+        "PUT /users/{id}/role": {
+            Tag: "Users", Summary: "Change the role of a user",
+            Description: "The user's sessions are revoked, so the role applies from their next login.",
+            Access: openapi.Admin, Scope: auth.Scope(auth.Update, auth.Roles),
+            Body: roleRequest{}, Response: models.User{},
+        },
+        "DELETE /users/{id}/lockout": {
+            Tag: "Users", Summary: "Lift the login lockout of a user",
+            Access: openapi.Admin, Scope: auth.Scope(auth.Delete, auth.Lockouts), Status: 204,
+        },
+
+        // Coffees
+        "GET /coffees": {
+            Tag: "Coffees", Summary: "List coffees",
+            Params: params([]openapi.Param{
+                query("name", "string", ""),
+                query("country", "string", ""),
+                query("region", "string", ""),
+                query("farm", "string", ""),
+                query("variety", "string", ""),
+                query("process", "string", ""),
+                query("roastProfile", "string", ""),
+                query("flavour", "string", "One of the flavour notes"),
+                query("roasteryId", "integer", ""),
+            }, wholeListParams("id, name, country, region, process, roastProfile, avgRating")),
+            Response: models.Coffee{}, List: true,
+        },
+        "GET /coffees/{id}": {
+            Tag: "Coffees", Summary: "Get a coffee",
+            Params: ifNoneMatch, Response: models.Coffee{},
+        },
+        "POST /coffees": {
+            Tag: "Coffees", Summary: "Add a coffee",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Create, auth.Coffees),
+            Body: models.Coffee{}, Response: models.Coffee{},
+        },
+        "PUT /coffees/{id}": {
+            Tag: "Coffees", Summary: "Replace a coffee",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Coffees),
+            Params: ifMatch, Body: models.Coffee{}, Response: models.Coffee{},
+        },
+        "PATCH /coffees/{id}": {
+            Tag: "Coffees", Summary: "Change some fields of a coffee",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Coffees),
+            Params: ifMatch, Body: models.Coffee{}, Patch: true, Response: models.Coffee{},
+        },
+        "DELETE /coffees/{id}": {
+            Tag: "Coffees", Summary: "Delete a coffee",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Delete, auth.Coffees),
+            Params: ifMatch, Status: 204,
+        },
+
+        // Coffee Shops
+        "GET /shops": {
+            Tag: "Coffee Shops", Summary: "List coffee shops",
+            Description: geoJSONDescription,
+            Params: params(locatedParams, geoParams, wholeListParams("id, name, country, city, avgRating, distance")),
+            Response: models.CoffeeShop{}, List: true,
+        },
+        "GET /shops.geojson": {
+            Tag: "Coffee Shops", Summary: "Coffee shops as GeoJSON",
+            Description: "Takes the filters of GET /shops. Without limit, offset or cursor every match is returned.",
+            Params: params(locatedParams, geoParams, wholeListParams("id, name, country, city, avgRating, distance")),
+            Response: geoJSONFeatureCollection{}, ResponseType: geoJSONType,
+        },
+        "GET /shops/{id}": {
+            Tag: "Coffee Shops", Summary: "Get a coffee shop",
+            Params: ifNoneMatch, Response: models.CoffeeShop{},
+        },
+        "POST /shops": {
+            Tag: "Coffee Shops", Summary: "Add a coffee shop",
+            Description: "Without lat and lon the address is geocoded in the background and geocodeStatus is pending until then. A pin without a full address gets the rest from reverse geocoding, with addressPending set until then.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Create, auth.Shops),
+            Body: models.CoffeeShop{}, Response: models.CoffeeShop{},
+        },
+        "PUT /shops/{id}": {
+            Tag: "Coffee Shops", Summary: "Replace a coffee shop",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Shops),
+            Params: ifMatch, Body: models.CoffeeShop{}, Response: models.CoffeeShop{},
+        },
+        "PATCH /shops/{id}": {
+            Tag: "Coffee Shops", Summary: "Change some fields of a coffee shop",
+            Description: "The address is geocoded again only when address, city or country change.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Shops),
+            Params: ifMatch, Body: models.CoffeeShop{}, Patch: true, Response: models.CoffeeShop{},
+        },
+        "DELETE /shops/{id}": {
+            Tag: "Coffee Shops", Summary: "Delete a coffee shop",
+            Access: openapi.Admin, Scope: auth.Scope(auth.Delete, auth.Shops),
+            Params: ifMatch, Status: 204,
+        },
+
+        // Roasteries
+        "GET /roasteries": {
+            Tag: "Roasteries", Summary: "List roasteries",
+            Description: geoJSONDescription,
+            Params: params(locatedParams, []openapi.Param{
+                query("description", "string", ""),
+                query("minRating", "number", ""),
+                query("maxRating", "number", ""),
+            }, geoParams, wholeListParams("id, name, country, city, avgRating, distance")),
+            Response: models.Roastery{}, List: true,
+        },
+        "GET /roasteries.geojson": {
+            Tag: "Roasteries", Summary: "Roasteries as GeoJSON",
+            Description: "Takes the filters of GET /roasteries. Without limit, offset or cursor every match is returned.",
+            Params: params(locatedParams, geoParams, wholeListParams("id, name, country, city, avgRating, distance")),
+            Response: geoJSONFeatureCollection{}, ResponseType: geoJSONType,
+        },
+        "GET /roasteries/{id}": {
+            Tag: "Roasteries", Summary: "Get a roastery",
+            Params: ifNoneMatch, Response: models.Roastery{},
+        },
+        "POST /roasteries": {
+            Tag: "Roasteries", Summary: "Add a roastery",
+            Description: "Without lat and lon the address is geocoded in the background and geocodeStatus is pending until then. A pin without a full address gets the rest from reverse geocoding, with addressPending set until then.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Create, auth.Roasteries),
+            Body: models.Roastery{}, Response: models.Roastery{},
+        },
+        "PUT /roasteries/{id}": {
+            Tag: "Roasteries", Summary: "Replace a roastery",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Roasteries),
+            Params: ifMatch, Body: models.Roastery{}, Response: models.Roastery{},
+        },
+        "PATCH /roasteries/{id}": {
+            Tag: "Roasteries", Summary: "Change some fields of a roastery",
+            Description: "The address is geocoded again only when address, city or country change.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Roasteries),
+            Params: ifMatch, Body: models.Roastery{}, Patch: true, Response: models.Roastery{},
+        },
+        "DELETE /roasteries/{id}": {
+            Tag: "Roasteries", Summary: "Delete a roastery",
+            Description: "Roasteries that still have coffees cannot be deleted.",
+            Access: openapi.Admin, Scope: auth.Scope(auth.Delete, auth.Roasteries),
+            Params: ifMatch, Status: 204,
+        },
+
+        // Reviews
+        "GET /reviews": {
+            Tag: "Reviews", Summary: "List reviews",
+            Params: params([]openapi.Param{
+                query("userId", "integer", ""),
+                query("coffeeId", "integer", ""),
+                query("roasteryId", "integer", ""),
+                query("coffeeShopId", "integer", ""),
+                query("minRating", "number", ""),
+                query("maxRating", "number", ""),
+                query("fromDate", "string", "YYYY-MM-DD"),
+                query("toDate", "string", "YYYY-MM-DD"),
+                query("coffeeCountry", "string", ""),
+                query("coffeeProcess", "string", ""),
+                query("coffeeRoastProfile", "string", ""),
+                query("coffeeFlavour", "string", ""),
+                query("roasteryCountry", "string", ""),
+                query("roasteryCity", "string", ""),
+                query("shopCountry", "string", ""),
+                query("shopCity", "string", ""),
+            }, wholeListParams("id, rating, dateOfCreation")),
+            Response: models.ReviewResponse{}, List: true,
+        },
+        "GET /reviews/{id}": {
+            Tag: "Reviews", Summary: "Get a review",
+            Params: ifNoneMatch, Response: models.ReviewResponse{},
+        },
+        "POST /reviews": {
+            Tag: "Reviews", Summary: "Review a coffee, roastery or coffee shop",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Create, auth.Reviews),
+            Body: models.Review{}, Response: models.ReviewResponse{},
+        },
+        "PUT /reviews/{id}": {
+            Tag: "Reviews", Summary: "Replace a review",
+            Description: "Only the author and admins may change a review. Its target stays the same.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Reviews),
+            Params: ifMatch, Body: models.Review{}, Response: models.ReviewResponse{},
+        },
+        "PATCH /reviews/{id}": {
+            Tag: "Reviews", Summary: "Change the rating or text of a review",
+            Description: "Only the author and admins may change a review.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Update, auth.Reviews),
+            Params: ifMatch, Body: models.Review{}, Patch: true, Response: models.ReviewResponse{},
+        },
+        "DELETE /reviews/{id}": {
+            Tag: "Reviews", Summary: "Delete a review",
+            Description: "Only the author and admins may delete a review.",
+            Access: openapi.Authenticated, Scope: auth.Scope(auth.Delete, auth.Reviews),
+            Params: ifMatch, Status: 204,
+        },
+
+        // Search
+        "GET /search": {
+            Tag: "Search", Summary: "Full-text search across coffees, roasteries and coffee shops",
+            Params: params([]openapi.Param{
+                {Name: "q", Type: "string", Required: true, Description: "Words to search for"},
+                {Name: "lang", Type: "string", Enum: []string{"simple", "polish", "english"}, Description: "Text search configuration"},
+                query("types", "string", "Comma separated coffee, roastery, shop"),
+            }, listParams("id, type, score")),
+            Response: models.SearchResult{}, List: true,
+        },
+        "GET /stats": {
+            Tag: "Search", Summary: "Number of users, coffees, roasteries, shops and reviews",
+            Response: Stats{},
+        },
+    },
+}
@@ -1,211 +1,259 @@
 package handlers
 
 import (
-    "database/sql"
-    "encoding/json"
-    "fmt"
     "net/http"
+    "net/url"
     "strconv"
-    "strings"
 
-    "coffeeApi/services/db"
-    "coffeeApi/services/geocoding"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
     "github.com/gorilla/mux"
 )
 
-type CoffeeShop struct {
-    ID          int     `json:"id"`
-    Name        string  `json:"name"`
-    Country     string  `json:"country"`
-    City        string  `json:"city"`
-    Address     string  `json:"address"`
-    Website     string  `json:"website"`
-    Description string  `json:"description"`
-    AvgRating   float32 `json:"avgRating"`
-    Lat         float64 `json:"lat"`
-    Lon         float64 `json:"lon"`
+type CoffeeShopHandler struct {
+    shops store.ShopStore
+    // wake tells the geocoding worker that a pending row was saved.
+    wake func()
+}
+
+func NewCoffeeShopHandler(shops store.ShopStore, wake func()) *CoffeeShopHandler {
+    return &CoffeeShopHandler{shops: shops, wake: wake}
+}
+
+func shopLocation(s *models.CoffeeShop) location {
+    return location{Address: &s.Address, City: &s.City, Country: &s.Country, Lat: &s.Lat, Lon: &s.Lon, Status: &s.GeocodeStatus, AddressPending: &s.AddressPending}
+}
+
+func shopFilter(q url.Values) (store.ShopFilter, error) {
+    filter := store.ShopFilter{
+        Name:    q.Get("name"),
+        Country: q.Get("country"),
+        City:    q.Get("city"),
+        Address: q.Get("address"),
+        Website: q.Get("website"),
+    }
+    status, err := parseGeocodeStatus(q)
+    if err != nil {
+        return filter, err
+    }
+    filter.GeocodeStatus = status
+
+    geo, err := parseGeoFilter(q)
+    filter.GeoFilter = geo
+    return filter, err
 }
 
-func GetCoffeeShopsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *CoffeeShopHandler) GetCoffeeShops(w http.ResponseWriter, r *http.Request) {
+    w.Header().Add("Vary", "Accept")
+    if wantsGeoJSON(r) {
+        h.GetCoffeeShopsGeoJSON(w, r)
+        return
+    }
+
     q := r.URL.Query()
-    name := q.Get("name")
-    country := q.Get("country")
-    city := q.Get("city")
-    address := q.Get("address")
-    website := q.Get("website")
-    
-    baseQuery := `SELECT id, name, country, city, address, website, description, avg_rating, lat, lon FROM shops`
-    conditions := []string{}
-    args := []interface{}{}
-    argIdx := 1
-
-    if name != "" {
-        conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", argIdx))
-        args = append(args, "%"+name+"%")
-        argIdx++
-    }
-    if country != "" {
-        conditions = append(conditions, fmt.Sprintf("country ILIKE $%d", argIdx))
-        args = append(args, "%"+country+"%")
-        argIdx++
-    }
-    if city != "" {
-        conditions = append(conditions, fmt.Sprintf("city ILIKE $%d", argIdx))
-        args = append(args, "%"+city+"%")
-        argIdx++
-    }
-    if address != "" {
-        conditions = append(conditions, fmt.Sprintf("address ILIKE $%d", argIdx))
-        args = append(args, "%"+address+"%")
-        argIdx++
-    }
-    if website != "" {
-        conditions = append(conditions, fmt.Sprintf("website ILIKE $%d", argIdx))
-        args = append(args, "%"+website+"%")
-        argIdx++
-    }
-    
-    if len(conditions) > 0 {
-        baseQuery += " WHERE " + strings.Join(conditions, " AND ")
-    }
-
-    rows, err := db.DB.Query(baseQuery, args...)
-    if err != nil {
-        http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var shops []CoffeeShop
-    for rows.Next() {
-        var shop CoffeeShop
-        if err := rows.Scan(&shop.ID, &shop.Name, &shop.Country, &shop.City, &shop.Address, &shop.Website, &shop.Description, &shop.AvgRating, &shop.Lat, &shop.Lon); err != nil {
-            http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
-            return
-        }
-        shops = append(shops, shop)
-    }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(shops)
+    filter, err := shopFilter(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    opts, err := parseListOptions(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    page, err := listUnlessPaged(q, opts, func(opts store.ListOptions) (store.Page[models.CoffeeShop], error) {
+        return h.shops.List(r.Context(), filter, opts)
+    })
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+    writeList(w, r, page, opts)
 }
 
-func GetCoffeeShopHandler(w http.ResponseWriter, r *http.Request) {
+// GetCoffeeShopsGeoJSON returns the shops matching the list filters as a
+// FeatureCollection.
+func (h *CoffeeShopHandler) GetCoffeeShopsGeoJSON(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    filter, err := shopFilter(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    opts, err := parseListOptions(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    page, err := listUnlessPaged(q, opts, func(opts store.ListOptions) (store.Page[models.CoffeeShop], error) {
+        return h.shops.List(r.Context(), filter, opts)
+    })
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+
+    features := make([]geoJSONFeature, len(page.Items))
+    for i, shop := range page.Items {
+        features[i] = newFeature(shop.ID, shop.Lat, shop.Lon, geoJSONProperties{
+            Name: shop.Name, City: shop.City, AvgRating: shop.AvgRating, Website: shop.Website, DistanceKm: shop.DistanceKm,
+        })
+    }
+    writeFeatureCollection(w, r, page, opts, features)
+}
+
+func (h *CoffeeShopHandler) GetCoffeeShop(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     shopID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+        badRequest(w, "Invalid shop ID")
         return
     }
 
-    var shop CoffeeShop
-    err = db.DB.QueryRow(`
-        SELECT id, name, country, city, address, website, description, avg_rating, lat, lon
-        FROM shops WHERE id = $1`, shopID).
-        Scan(&shop.ID, &shop.Name, &shop.Country, &shop.City, &shop.Address, &shop.Website, &shop.Description, &shop.AvgRating, &shop.Lat, &shop.Lon)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Coffee shop not found", http.StatusNotFound)
-        return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+    shop, err := h.shops.Get(r.Context(), shopID)
+    if err != nil {
+        writeStoreError(w, err, "Coffee shop not found", "Database error")
         return
     }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(shop)
+    writeResource(w, r, shop)
 }
 
-func CreateCoffeeShopHandler(w http.ResponseWriter, r *http.Request) {
-    var shop CoffeeShop
-    if err := json.NewDecoder(r.Body).Decode(&shop); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+func (h *CoffeeShopHandler) CreateCoffeeShop(w http.ResponseWriter, r *http.Request) {
+    var shop models.CoffeeShop
+    pinned, errs, err := decodeLocated(r, &shop)
+    if err != nil {
+        problem.WriteError(w, err)
         return
     }
-    if shop.Name == "" || shop.Country == "" || shop.City == "" || shop.Address == "" {
-        http.Error(w, "Missing required fields", http.StatusBadRequest)
+    if !valid(w, &shop, append(errs, addressFields(shopLocation(&shop), !pinned)...)) {
+        return
+    }
+
+    locate(shopLocation(&shop), pinned, nil)
+
+    if err := h.shops.Create(r.Context(), &shop); err != nil {
+        writeStoreError(w, err, "Coffee shop not found", "Database insert error")
+        return
+    }
+    if shopLocation(&shop).waiting() {
+        h.wake()
+    }
+    writeResource(w, r, shop)
+}
+
+func (h *CoffeeShopHandler) UpdateCoffeeShop(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    shopID, err := strconv.Atoi(params["id"])
+    if err != nil {
+        badRequest(w, "Invalid shop ID")
         return
     }
 
-    fullAddress := fmt.Sprintf("%s, %s, %s", shop.Address, shop.City, shop.Country)
-    lat, lon, err := geocoding.GetCoordinates(fullAddress)
+    prev, err := h.shops.Get(r.Context(), shopID)
     if err != nil {
-        http.Error(w, "Geocoding error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Coffee shop not found", "Database error")
         return
     }
-    shop.Lat = lat
-    shop.Lon = lon
 
-    err = db.DB.QueryRow(`
-        INSERT INTO shops (name, country, city, address, website, description, avg_rating, lat, lon)
-        VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8) RETURNING id`,
-        shop.Name, shop.Country, shop.City, shop.Address, shop.Website, shop.Description, shop.Lat, shop.Lon).
-        Scan(&shop.ID)
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
+        return
+    }
+
+    var shop models.CoffeeShop
+    pinned, errs, err := decodeLocated(r, &shop)
     if err != nil {
-        http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
+        problem.WriteError(w, err)
         return
     }
-    shop.AvgRating = 0
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(shop)
+    shop.ID, shop.Version = shopID, version
+    h.save(w, r, &shop, prev, pinned, true, nil, errs)
 }
 
-func UpdateCoffeeShopHandler(w http.ResponseWriter, r *http.Request) {
+// PatchCoffeeShop applies a merge patch or JSON patch to the shop. Its address is
+// geocoded again only when address, city or country change.
+func (h *CoffeeShopHandler) PatchCoffeeShop(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     shopID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+        badRequest(w, "Invalid shop ID")
         return
     }
 
-    var shop CoffeeShop
-    if err := json.NewDecoder(r.Body).Decode(&shop); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+    prev, err := h.shops.Get(r.Context(), shopID)
+    if err != nil {
+        writeStoreError(w, err, "Coffee shop not found", "Database error")
         return
     }
 
-    fullAddress := fmt.Sprintf("%s, %s, %s", shop.Address, shop.City, shop.Country)
-    lat, lon, err := geocoding.GetCoordinates(fullAddress)
-    if err != nil {
-        http.Error(w, "Geocoding error: "+err.Error(), http.StatusInternalServerError)
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    shop.Lat = lat
-    shop.Lon = lon
 
-    result, err := db.DB.Exec(`
-        UPDATE shops
-        SET name=$1, country=$2, city=$3, address=$4, website=$5, description=$6, lat=$7, lon=$8
-        WHERE id=$9`,
-        shop.Name, shop.Country, shop.City, shop.Address, shop.Website, shop.Description, shop.Lat, shop.Lon, shopID)
+    var shop models.CoffeeShop
+    fields, err := applyPatch(r, prev, &shop, locatedWritable)
     if err != nil {
-        http.Error(w, "Database update error: "+err.Error(), http.StatusInternalServerError)
+        writePatchError(w, err)
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Coffee shop not found", http.StatusNotFound)
+    var errs []problem.FieldError
+    pinned := fields.present["lat"] || fields.present["lon"]
+    // A pin on a shop that has no coordinates yet needs both of them.
+    if pinned && prev.GeocodeStatus != store.GeocodeResolved && fields.present["lat"] != fields.present["lon"] {
+        errs = append(errs, missingCoordinate(fields.present["lat"]))
+    }
+    moved := pinned || fields.changed["address"] || fields.changed["city"] || fields.changed["country"]
+    shop.ID, shop.Version = shopID, version
+    h.save(w, r, &shop, prev, pinned, moved, fields.changed, errs)
+}
+
+// save validates and stores an updated shop, reporting errs, the fields
+// found invalid while decoding it, with the rest. When changed is not nil
+// only the fields in it are validated. Unless moved, its coordinates and
+// geocoding status are kept as they are.
+func (h *CoffeeShopHandler) save(w http.ResponseWriter, r *http.Request, shop *models.CoffeeShop, prev models.CoffeeShop, pinned, moved bool, changed map[string]bool, errs []problem.FieldError) {
+    if !validChanged(w, shop, changed, append(errs, addressFields(shopLocation(shop), moved && !pinned)...)) {
         return
     }
-    shop.ID = shopID
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(shop)
+
+    if moved {
+        prevLocation := shopLocation(&prev)
+        locate(shopLocation(shop), pinned, &prevLocation)
+    }
+
+    if err := h.shops.Update(r.Context(), shop); err != nil {
+        writeStoreError(w, err, "Coffee shop not found", "Database update error")
+        return
+    }
+    if shopLocation(shop).waiting() {
+        h.wake()
+    }
+    writeResource(w, r, shop)
 }
 
-func DeleteCoffeeShopHandler(w http.ResponseWriter, r *http.Request) {
+func (h *CoffeeShopHandler) DeleteCoffeeShop(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     shopID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+        badRequest(w, "Invalid shop ID")
         return
     }
 
-    result, err := db.DB.Exec(`DELETE FROM shops WHERE id = $1`, shopID)
+    prev, err := h.shops.Get(r.Context(), shopID)
     if err != nil {
-        http.Error(w, "Database delete error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Coffee shop not found", "Database error")
+        return
+    }
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Coffee shop not found", http.StatusNotFound)
+    if err := h.shops.Delete(r.Context(), shopID, version); err != nil {
+        writeStoreError(w, err, "Coffee shop not found", "Database delete error")
         return
     }
     w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
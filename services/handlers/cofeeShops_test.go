@@ -0,0 +1,96 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "coffeeApi/services/models"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+)
+
+func newShopRouter(t *testing.T) (*mux.Router, store.Stores) {
+    t.Helper()
+    stores := store.NewMemoryStores()
+    h := NewCoffeeShopHandler(stores.Shops, func() {})
+    router := mux.NewRouter()
+    router.HandleFunc("/shops/{id}", h.GetCoffeeShop).Methods("GET")
+    router.HandleFunc("/shops/{id}", h.UpdateCoffeeShop).Methods("PUT")
+    router.HandleFunc("/shops/{id}", h.PatchCoffeeShop).Methods("PATCH")
+    router.HandleFunc("/shops/{id}", h.DeleteCoffeeShop).Methods("DELETE")
+    return router, stores
+}
+
+func TestShopWritesCheckIfMatch(t *testing.T) {
+    const shopBody = `{"name": "Karma", "address": "ul. Krupnicza 12", "city": "Kraków", "country": "Poland"}`
+    // Changes made by someone else between reading the shop and writing it.
+    edit := func(stores store.Stores, shop models.CoffeeShop) error {
+        shop.Description = "Edited meanwhile"
+        return stores.Shops.Update(context.Background(), &shop)
+    }
+    geocode := func(stores store.Stores, shop models.CoffeeShop) error {
+        jobs, err := stores.Geocoding.Claim(context.Background(), 1, time.Minute)
+        if err != nil || len(jobs) != 1 {
+            return fmt.Errorf("claimed %+v, %v", jobs, err)
+        }
+        return stores.Geocoding.Resolve(context.Background(), jobs[0], 50.06, 19.93)
+    }
+    tests := []struct {
+        name        string
+        method      string
+        contentType string
+        body        string
+        meanwhile   func(store.Stores, models.CoffeeShop) error
+        status      int
+    }{
+        {"PUT with a current ETag", "PUT", "application/json", shopBody, nil, http.StatusOK},
+        {"PUT after an edit", "PUT", "application/json", shopBody, edit, http.StatusPreconditionFailed},
+        {"PUT after geocoding", "PUT", "application/json", shopBody, geocode, http.StatusPreconditionFailed},
+        {"PATCH with a current ETag", "PATCH", mergePatchType, `{"website": "https://karma.example"}`, nil, http.StatusOK},
+        {"PATCH after an edit", "PATCH", mergePatchType, `{"website": "https://karma.example"}`, edit, http.StatusPreconditionFailed},
+        {"PATCH after geocoding", "PATCH", jsonPatchType, `[{"op": "add", "path": "/website", "value": "https://karma.example"}]`, geocode, http.StatusPreconditionFailed},
+        {"DELETE with a current ETag", "DELETE", "", "", nil, http.StatusNoContent},
+        {"DELETE after an edit", "DELETE", "", "", edit, http.StatusPreconditionFailed},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            router, stores := newShopRouter(t)
+            shop := models.CoffeeShop{Name: "Karma", Address: "ul. Krupnicza 12", City: "Kraków", Country: "Poland", GeocodeStatus: store.GeocodePending}
+            if err := stores.Shops.Create(context.Background(), &shop); err != nil {
+                t.Fatal(err)
+            }
+            target := "/shops/" + strconv.Itoa(shop.ID)
+            tag := serve(router, "GET", target, "", "").Header().Get("ETag")
+            if tt.meanwhile != nil {
+                if err := tt.meanwhile(stores, shop); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            before, _ := stores.Shops.Get(context.Background(), shop.ID)
+
+            req := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+            req.Header.Set("If-Match", tag)
+            if tt.contentType != "" {
+                req.Header.Set("Content-Type", tt.contentType)
+            }
+            rec := httptest.NewRecorder()
+            router.ServeHTTP(rec, req)
+
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.status == http.StatusPreconditionFailed {
+                if after, err := stores.Shops.Get(context.Background(), shop.ID); err != nil || after.Version != before.Version {
+                    t.Errorf("shop written despite the stale ETag: %+v, %v", after, err)
+                }
+            }
+        })
+    }
+}
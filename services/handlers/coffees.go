@@ -1,212 +1,174 @@
 package handlers
 
 import (
-    "database/sql"
-    "encoding/json"
-    "fmt"
     "net/http"
     "strconv"
-    "strings"
 
-    "coffeeApi/services/db"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
 
     "github.com/gorilla/mux"
 )
 
-type Coffee struct {
-    ID           int      `json:"id"`
-    Name         string   `json:"name"`
-    RoasteryId   int      `json:"roasteryId"`
-    Country      string   `json:"country"`
-    Region       string   `json:"region"`
-    Farm         string   `json:"farm"`
-    Variety      string   `json:"variety"`
-    Process      string   `json:"process"`
-    RoastProfile string   `json:"roastProfile"`
-    FlavourNotes []string `json:"flavourNotes"`
-    Description  string   `json:"description"`
+type CoffeeHandler struct {
+    coffees store.CoffeeStore
 }
 
-func GetCoffeesHandler(w http.ResponseWriter, r *http.Request) {
+func NewCoffeeHandler(coffees store.CoffeeStore) *CoffeeHandler {
+    return &CoffeeHandler{coffees: coffees}
+}
+
+func (h *CoffeeHandler) GetCoffees(w http.ResponseWriter, r *http.Request) {
     q := r.URL.Query()
-    name := q.Get("name")
-    roasteryId := q.Get("roasteryId")
-    country := q.Get("country")
-    region := q.Get("region")
-    farm := q.Get("farm")
-    variety := q.Get("variety")
-    process := q.Get("process")
-    roastProfile := q.Get("roastProfile")
-    flavour := q.Get("flavour")
-    baseQuery := `SELECT id, name, roastery_id, country, region, farm, variety, process, roast_profile, flavour_notes, description FROM coffees`
-    conditions := []string{}
-    args := []interface{}{}
-    argIdx := 1
+    filter := store.CoffeeFilter{
+        Name:         q.Get("name"),
+        Country:      q.Get("country"),
+        Region:       q.Get("region"),
+        Farm:         q.Get("farm"),
+        Variety:      q.Get("variety"),
+        Process:      q.Get("process"),
+        RoastProfile: q.Get("roastProfile"),
+        Flavour:      q.Get("flavour"),
+    }
+    if id, err := strconv.Atoi(q.Get("roasteryId")); err == nil {
+        filter.RoasteryID = id
+    }
 
-    if name != "" {
-        conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", argIdx))
-        args = append(args, "%"+name+"%")
-        argIdx++
-    }
-    if roasteryId != "" {
-        if id, err := strconv.Atoi(roasteryId); err == nil {
-            conditions = append(conditions, fmt.Sprintf("roastery_id = $%d", argIdx))
-            args = append(args, id)
-            argIdx++
-        }
-    }
-    if country != "" {
-        conditions = append(conditions, fmt.Sprintf("country ILIKE $%d", argIdx))
-        args = append(args, "%"+country+"%")
-        argIdx++
-    }
-    if region != "" {
-        conditions = append(conditions, fmt.Sprintf("region ILIKE $%d", argIdx))
-        args = append(args, "%"+region+"%")
-        argIdx++
-    }
-    if farm != "" {
-        conditions = append(conditions, fmt.Sprintf("farm ILIKE $%d", argIdx))
-        args = append(args, "%"+farm+"%")
-        argIdx++
-    }
-    if variety != "" {
-        conditions = append(conditions, fmt.Sprintf("variety ILIKE $%d", argIdx))
-        args = append(args, "%"+variety+"%")
-        argIdx++
-    }
-    if process != "" {
-        conditions = append(conditions, fmt.Sprintf("process ILIKE $%d", argIdx))
-        args = append(args, "%"+process+"%")
-        argIdx++
-    }
-    if roastProfile != "" {
-        conditions = append(conditions, fmt.Sprintf("roast_profile ILIKE $%d", argIdx))
-        args = append(args, "%"+roastProfile+"%")
-        argIdx++
-    }
-    if flavour != "" {
-        conditions = append(conditions, fmt.Sprintf("flavour_notes ILIKE $%d", argIdx))
-        args = append(args, "%"+flavour+"%")
-        argIdx++
-    }
-    if len(conditions) > 0 {
-        baseQuery += " WHERE " + strings.Join(conditions, " AND ")
-    }
-    rows, err := db.DB.Query(baseQuery, args...)
+    opts, err := parseListOptions(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    page, err := listUnlessPaged(q, opts, func(opts store.ListOptions) (store.Page[models.Coffee], error) {
+        return h.coffees.List(r.Context(), filter, opts)
+    })
     if err != nil {
-        http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-    var coffees []Coffee
-    for rows.Next() {
-        var c Coffee
-        var notes string
-        if err := rows.Scan(&c.ID, &c.Name, &c.RoasteryId, &c.Country, &c.Region, &c.Farm, &c.Variety, &c.Process, &c.RoastProfile, &notes, &c.Description); err != nil {
-            http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
-            return
-        }
-        if notes != "" {
-            c.FlavourNotes = strings.Split(notes, ",")
-        }
-        coffees = append(coffees, c)
-    }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(coffees)
+        writeListError(w, err)
+        return
+    }
+    writeList(w, r, page, opts)
 }
 
-func GetCoffeeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *CoffeeHandler) GetCoffee(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     coffeeID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid coffee ID", http.StatusBadRequest)
+        badRequest(w, "Invalid coffee ID")
         return
     }
-    var c Coffee
-    var notes string
-    err = db.DB.QueryRow(`SELECT id, name, roastery_id, country, region, farm, variety, process, roast_profile, flavour_notes, description FROM coffees WHERE id = $1`, coffeeID).
-        Scan(&c.ID, &c.Name, &c.RoasteryId, &c.Country, &c.Region, &c.Farm, &c.Variety, &c.Process, &c.RoastProfile, &notes, &c.Description)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Coffee not found", http.StatusNotFound)
+    c, err := h.coffees.Get(r.Context(), coffeeID)
+    if err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database error")
+        return
+    }
+    writeResource(w, r, c)
+}
+
+func (h *CoffeeHandler) CreateCoffee(w http.ResponseWriter, r *http.Request) {
+    var c models.Coffee
+    errs, err := decodeJSON(r, &c)
+    if err != nil {
+        problem.WriteError(w, err)
         return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+    }
+    if !valid(w, &c, errs) {
         return
     }
-    if notes != "" {
-        c.FlavourNotes = strings.Split(notes, ",")
+    if err := h.coffees.Create(r.Context(), &c); err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database insert error")
+        return
     }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(c)
+    writeResource(w, r, c)
 }
 
-func CreateCoffeeHandler(w http.ResponseWriter, r *http.Request) {
-    var c Coffee
-    if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+func (h *CoffeeHandler) UpdateCoffee(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    coffeeID, err := strconv.Atoi(params["id"])
+    if err != nil {
+        badRequest(w, "Invalid coffee ID")
+        return
+    }
+    prev, err := h.coffees.Get(r.Context(), coffeeID)
+    if err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database error")
         return
     }
-    if c.Name == "" || c.Country == "" || c.Process == "" || c.RoastProfile == "" {
-        http.Error(w, "Missing required fields", http.StatusBadRequest)
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    notes := strings.Join(c.FlavourNotes, ",")
-    err := db.DB.QueryRow(`INSERT INTO coffees (name, roastery_id, country, region, farm, variety, process, roast_profile, flavour_notes, description) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id`,
-        c.Name, c.RoasteryId, c.Country, c.Region, c.Farm, c.Variety, c.Process, c.RoastProfile, notes, c.Description).Scan(&c.ID)
+    var c models.Coffee
+    errs, err := decodeJSON(r, &c)
     if err != nil {
-        http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
+        problem.WriteError(w, err)
         return
     }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(c)
+    c.ID, c.Version = coffeeID, version
+    h.save(w, r, &c, nil, errs)
 }
 
-func UpdateCoffeeHandler(w http.ResponseWriter, r *http.Request) {
+// PatchCoffee applies a merge patch or JSON patch to the coffee, leaving
+// the fields it does not mention as they are.
+func (h *CoffeeHandler) PatchCoffee(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     coffeeID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid coffee ID", http.StatusBadRequest)
+        badRequest(w, "Invalid coffee ID")
+        return
+    }
+    prev, err := h.coffees.Get(r.Context(), coffeeID)
+    if err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database error")
         return
     }
-    var c Coffee
-    if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    notes := strings.Join(c.FlavourNotes, ",")
-    result, err := db.DB.Exec(`UPDATE coffees SET name=$1, roastery_id=$2, country=$3, region=$4, farm=$5, variety=$6, process=$7, roast_profile=$8, flavour_notes=$9, description=$10 WHERE id=$11`,
-        c.Name, c.RoasteryId, c.Country, c.Region, c.Farm, c.Variety, c.Process, c.RoastProfile, notes, c.Description, coffeeID)
+    var c models.Coffee
+    fields, err := applyPatch(r, prev, &c, coffeeWritable)
     if err != nil {
-        http.Error(w, "Database update error: "+err.Error(), http.StatusInternalServerError)
+        writePatchError(w, err)
+        return
+    }
+    c.ID, c.Version = coffeeID, version
+    h.save(w, r, &c, fields.changed, nil)
+}
+
+// save validates and stores an updated coffee, reporting errs, the fields
+// found invalid while decoding it, with the rest. When changed is not nil
+// only the fields in it are validated.
+func (h *CoffeeHandler) save(w http.ResponseWriter, r *http.Request, c *models.Coffee, changed map[string]bool, errs []problem.FieldError) {
+    if !validChanged(w, c, changed, errs) {
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Coffee not found", http.StatusNotFound)
+    if err := h.coffees.Update(r.Context(), c); err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database update error")
         return
     }
-    c.ID = coffeeID
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(c)
+    writeResource(w, r, c)
 }
 
-func DeleteCoffeeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *CoffeeHandler) DeleteCoffee(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     coffeeID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid coffee ID", http.StatusBadRequest)
+        badRequest(w, "Invalid coffee ID")
         return
     }
-    result, err := db.DB.Exec(`DELETE FROM coffees WHERE id = $1`, coffeeID)
+    prev, err := h.coffees.Get(r.Context(), coffeeID)
     if err != nil {
-        http.Error(w, "Database delete error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Coffee not found", "Database error")
+        return
+    }
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Coffee not found", http.StatusNotFound)
+    if err := h.coffees.Delete(r.Context(), coffeeID, version); err != nil {
+        writeStoreError(w, err, "Coffee not found", "Database delete error")
         return
     }
     w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+
+    "coffeeApi/services/models"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+)
+
+// newCoffeeRouter serves the coffee handlers on an in-memory store,
+// without the authentication middleware of the real routes.
+func newCoffeeRouter(t *testing.T) (*mux.Router, store.CoffeeStore) {
+    t.Helper()
+    coffees := store.NewMemoryStores().Coffees
+    h := NewCoffeeHandler(coffees)
+    router := mux.NewRouter()
+    router.HandleFunc("/coffees", h.GetCoffees).Methods("GET")
+    router.HandleFunc("/coffees/{id}", h.GetCoffee).Methods("GET")
+    router.HandleFunc("/coffees", h.CreateCoffee).Methods("POST")
+    router.HandleFunc("/coffees/{id}", h.UpdateCoffee).Methods("PUT")
+    router.HandleFunc("/coffees/{id}", h.PatchCoffee).Methods("PATCH")
+    return router, coffees
+}
+
+func serve(router http.Handler, method, target, contentType, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, target, strings.NewReader(body))
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+    return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+    t.Helper()
+    if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+        t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+    }
+}
+
+func addCoffee(t *testing.T, coffees store.CoffeeStore, c models.Coffee) models.Coffee {
+    t.Helper()
+    if err := coffees.Create(context.Background(), &c); err != nil {
+        t.Fatalf("creating coffee: %v", err)
+    }
+    return c
+}
+
+const coffeeBody = `{"name": "Kenya AA", "country": "Kenya", "process": "washed", "roastProfile": "Light",
+    "flavourNotes": ["blackcurrant"], "imageUrl": "https://example.com/kenya.jpg"}`
+
+func TestCreateCoffee(t *testing.T) {
+    router, coffees := newCoffeeRouter(t)
+
+    rec := serve(router, "POST", "/coffees", "application/json", coffeeBody)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    var created models.Coffee
+    decodeBody(t, rec, &created)
+    if created.ID == 0 || created.Name != "Kenya AA" {
+        t.Errorf("created = %+v", created)
+    }
+    if created.Process != "Washed" {
+        t.Errorf("process = %q, want the listed spelling Washed", created.Process)
+    }
+    if rec.Header().Get("ETag") == "" {
+        t.Error("no ETag")
+    }
+    if _, err := coffees.Get(context.Background(), created.ID); err != nil {
+        t.Errorf("coffee not stored: %v", err)
+    }
+}
+
+func TestCreateCoffeeInvalid(t *testing.T) {
+    router, _ := newCoffeeRouter(t)
+
+    rec := serve(router, "POST", "/coffees", "application/json", `{"name": "", "process": "Boiled", "colour": "brown"}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    var p struct {
+        Code   string `json:"code"`
+        Errors []struct {
+            Field string `json:"field"`
+            Code  string `json:"code"`
+        } `json:"errors"`
+    }
+    decodeBody(t, rec, &p)
+    got := map[string]string{}
+    for _, e := range p.Errors {
+        got[e.Field] = e.Code
+    }
+    want := map[string]string{"name": "required", "country": "required", "process": "invalid_choice", "roastProfile": "required", "colour": "unknown"}
+    for field, code := range want {
+        if got[field] != code {
+            t.Errorf("error of %s = %q, want %q (all: %v)", field, got[field], code, got)
+        }
+    }
+}
+
+func TestGetCoffee(t *testing.T) {
+    router, coffees := newCoffeeRouter(t)
+    c := addCoffee(t, coffees, models.Coffee{Name: "Ethiopia Guji", Country: "Ethiopia", Process: "Natural", RoastProfile: "Filter"})
+
+    rec := serve(router, "GET", "/coffees/"+strconv.Itoa(c.ID), "", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    var got models.Coffee
+    decodeBody(t, rec, &got)
+    if got.Name != c.Name {
+        t.Errorf("name = %q, want %q", got.Name, c.Name)
+    }
+
+    tag := rec.Header().Get("ETag")
+    req := httptest.NewRequest("GET", "/coffees/"+strconv.Itoa(c.ID), nil)
+    req.Header.Set("If-None-Match", tag)
+    cached := httptest.NewRecorder()
+    router.ServeHTTP(cached, req)
+    if cached.Code != http.StatusNotModified {
+        t.Errorf("status with If-None-Match = %d, want 304", cached.Code)
+    }
+
+    if rec := serve(router, "GET", "/coffees/999", "", ""); rec.Code != http.StatusNotFound {
+        t.Errorf("status of a missing coffee = %d, want 404", rec.Code)
+    }
+}
+
+func TestGetCoffees(t *testing.T) {
+    router, coffees := newCoffeeRouter(t)
+    for _, name := range []string{"Brazil Cerrado", "Colombia Huila", "Brazil Mogiana"} {
+        addCoffee(t, coffees, models.Coffee{Name: name, Country: "Brazil", Process: "Natural", RoastProfile: "Espresso"})
+    }
+
+    rec := serve(router, "GET", "/coffees?name=brazil&sort=-name", "", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    var list []models.Coffee
+    decodeBody(t, rec, &list)
+    if len(list) != 2 || list[0].Name != "Brazil Mogiana" || list[1].Name != "Brazil Cerrado" {
+        t.Errorf("list = %+v", list)
+    }
+    if total := rec.Header().Get("X-Total-Count"); total != "2" {
+        t.Errorf("X-Total-Count = %q, want 2", total)
+    }
+    if link := rec.Header().Get("Link"); link != "" {
+        t.Errorf("Link = %q for the whole list", link)
+    }
+
+    rec = serve(router, "GET", "/coffees?limit=1", "", "")
+    decodeBody(t, rec, &list)
+    if len(list) != 1 || rec.Header().Get("X-Total-Count") != "3" || !strings.Contains(rec.Header().Get("Link"), `rel="next"`) {
+        t.Errorf("first page = %+v, headers %v", list, rec.Header())
+    }
+}
+
+func TestUpdateCoffee(t *testing.T) {
+    router, coffees := newCoffeeRouter(t)
+    c := addCoffee(t, coffees, models.Coffee{Name: "Kenya AA", Country: "Kenya", Process: "Washed", RoastProfile: "Light"})
+    target := "/coffees/" + strconv.Itoa(c.ID)
+
+    rec := serve(router, "PUT", target, "application/json", `{"name": "Kenya AB", "country": "Kenya", "process": "Washed", "roastProfile": "Filter"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    stored, _ := coffees.Get(context.Background(), c.ID)
+    if stored.Name != "Kenya AB" || stored.RoastProfile != "Filter" || stored.Version != c.Version+1 {
+        t.Errorf("stored = %+v", stored)
+    }
+
+    rec = serve(router, "PUT", target, "application/json", `{"name": "Kenya AB"}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("status of an incomplete update = %d, want 400", rec.Code)
+    }
+
+    req := httptest.NewRequest("PUT", target, strings.NewReader(coffeeBody))
+    req.Header.Set("If-Match", `"stale"`)
+    stale := httptest.NewRecorder()
+    router.ServeHTTP(stale, req)
+    if stale.Code != http.StatusPreconditionFailed {
+        t.Errorf("status with a stale If-Match = %d, want 412", stale.Code)
+    }
+}
+
+func TestPatchCoffeeKeepsStoredValues(t *testing.T) {
+    router, coffees := newCoffeeRouter(t)
+    // Stored before process was validated.
+    c := addCoffee(t, coffees, models.Coffee{Name: "Old Blend", Country: "Brazil", Process: "Natural (Brazil), Washed (India)", RoastProfile: "Espresso"})
+    target := "/coffees/" + strconv.Itoa(c.ID)
+
+    rec := serve(router, "PATCH", target, mergePatchType, `{"description": "Chocolate and nuts"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+    }
+    stored, _ := coffees.Get(context.Background(), c.ID)
+    if stored.Description != "Chocolate and nuts" || stored.Process != c.Process {
+        t.Errorf("stored = %+v", stored)
+    }
+
+    rec = serve(router, "PATCH", target, jsonPatchType, `[{"op": "replace", "path": "/roastProfile", "value": "Burnt"}]`)
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "roastProfile") || strings.Contains(rec.Body.String(), `"process"`) {
+        t.Errorf("status = %d, body %s; want 400 naming only roastProfile", rec.Code, rec.Body)
+    }
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "reflect"
+    "sort"
+    "strings"
+
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/validation"
+)
+
+// maxBodyBytes limits the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+func readBody(r *http.Request) ([]byte, error) {
+    body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+    if err != nil {
+        return nil, problem.New(http.StatusBadRequest, problem.InvalidRequest, "Could not read the request body")
+    }
+    if len(body) > maxBodyBytes {
+        return nil, problem.Newf(http.StatusRequestEntityTooLarge, problem.RequestTooLarge, "Request body must not be larger than %d bytes", maxBodyBytes)
+    }
+    return body, nil
+}
+
+// readObject reads the body of r, which must be a single JSON object.
+func readObject(r *http.Request) (map[string]json.RawMessage, error) {
+    body, err := readBody(r)
+    if err != nil {
+        return nil, err
+    }
+    var obj map[string]json.RawMessage
+    if err := json.Unmarshal(body, &obj); err != nil || obj == nil {
+        var syntaxErr *json.SyntaxError
+        if errors.As(err, &syntaxErr) {
+            return nil, problem.Newf(http.StatusBadRequest, problem.InvalidRequest, "Invalid request payload: %s", err)
+        }
+        return nil, problem.New(http.StatusBadRequest, problem.InvalidRequest, "Invalid request payload: the body must be a JSON object")
+    }
+    return obj, nil
+}
+
+// ignoredFields are fields that clients have always sent and the API has
+// never stored, by the type they are decoded into. Strict decoding accepts
+// and drops them instead of reporting them as unknown.
+var ignoredFields = map[reflect.Type][]string{
+    reflect.TypeOf(models.Coffee{}):     {"imageUrl"},
+    reflect.TypeOf(models.CoffeeShop{}): {"imageUrl"},
+    reflect.TypeOf(models.Roastery{}):   {"imageUrl"},
+}
+
+// dropIgnored removes the ignored fields of the struct v points to from
+// obj. Like encoding/json, it matches names ignoring case.
+func dropIgnored[T any](obj map[string]T, v interface{}) {
+    ignored := ignoredFields[reflect.TypeOf(v).Elem()]
+    for key := range obj {
+        for _, name := range ignored {
+            if strings.EqualFold(key, name) {
+                delete(obj, key)
+            }
+        }
+    }
+}
+
+// decodeObject decodes obj into the struct v points to one field at a
+// time, so that every unknown field and every value of the wrong type is
+// reported, not only the first.
+func decodeObject(obj map[string]json.RawMessage, v interface{}) []problem.FieldError {
+    dropIgnored(obj, v)
+    keys := make([]string, 0, len(obj))
+    for key := range obj {
+        keys = append(keys, key)
+    }
+    errs := validation.Unknown(v, keys)
+    unknown := map[string]bool{}
+    for _, e := range errs {
+        unknown[e.Field] = true
+    }
+
+    sort.Strings(keys)
+    for _, key := range keys {
+        if unknown[key] {
+            continue
+        }
+        field, _ := json.Marshal(map[string]json.RawMessage{key: obj[key]})
+        if err := json.Unmarshal(field, v); err != nil {
+            errs = append(errs, typeError(key, err))
+        }
+    }
+    return errs
+}
+
+func typeError(field string, err error) problem.FieldError {
+    var typeErr *json.UnmarshalTypeError
+    if !errors.As(err, &typeErr) {
+        return problem.FieldError{Field: field, Code: "invalid", Message: field + " is not valid"}
+    }
+    var want string
+    switch typeErr.Type.Kind() {
+    case reflect.String:
+        want = "a string"
+    case reflect.Bool:
+        want = "true or false"
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+        want = "a number"
+    case reflect.Slice, reflect.Array:
+        want = "an array"
+    default:
+        want = "an object"
+    }
+    return problem.FieldError{Field: field, Code: "invalid_type", Message: fmt.Sprintf("%s must be %s", field, want)}
+}
+
+// decodeJSON strictly decodes the JSON object in the body of r into v. A
+// body that cannot be read or parsed is returned as the error; unknown
+// fields and values of the wrong type are returned as field errors, to be
+// reported together with the rest of the validation.
+func decodeJSON(r *http.Request, v interface{}) ([]problem.FieldError, error) {
+    obj, err := readObject(r)
+    if err != nil {
+        return nil, err
+    }
+    return decodeObject(obj, v), nil
+}
+
+// valid checks v against its validate tags and answers 400 with errs and
+// every violation when there are any. A field already in errs is not
+// checked again.
+func valid(w http.ResponseWriter, v interface{}, errs []problem.FieldError) bool {
+    return validChanged(w, v, nil, errs)
+}
+
+// validChanged is valid for a patched resource: only the fields in changed
+// are checked, so that a value stored before its rule existed does not
+// block edits to the other fields. A nil changed checks every field.
+func validChanged(w http.ResponseWriter, v interface{}, changed map[string]bool, errs []problem.FieldError) bool {
+    reported := map[string]bool{}
+    for _, e := range errs {
+        reported[e.Field] = true
+    }
+    for _, e := range validation.Struct(v) {
+        if !reported[e.Field] && (changed == nil || changed[e.Field]) {
+            errs = append(errs, e)
+        }
+    }
+    if len(errs) > 0 {
+        problem.Invalid(w, errs)
+        return false
+    }
+    return true
+}
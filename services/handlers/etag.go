@@ -0,0 +1,85 @@
+package handlers
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "coffeeApi/services/problem"
+)
+
+// etag is a strong entity tag for a JSON representation. It is a hash of
+// the bytes sent, so it changes with derived fields such as avgRating too.
+func etag(body []byte) string {
+    sum := sha256.Sum256(body)
+    return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+func encodeResource(v interface{}) ([]byte, error) {
+    var body bytes.Buffer
+    err := json.NewEncoder(&body).Encode(v)
+    return body.Bytes(), err
+}
+
+// etagMatches reports whether tag is listed in an If-Match or If-None-Match
+// header. Weak comparison also accepts W/ tags, strong comparison skips them.
+func etagMatches(header, tag string, weak bool) bool {
+    if strings.TrimSpace(header) == "*" {
+        return true
+    }
+    for _, t := range strings.Split(header, ",") {
+        t = strings.TrimSpace(t)
+        if strings.HasPrefix(t, "W/") {
+            if !weak {
+                continue
+            }
+            t = strings.TrimPrefix(t, "W/")
+        }
+        if t == tag {
+            return true
+        }
+    }
+    return false
+}
+
+// writeResource writes a single resource with its ETag, or only 304 Not
+// Modified when a GET's If-None-Match already names it.
+func writeResource(w http.ResponseWriter, r *http.Request, v interface{}) {
+    body, err := encodeResource(v)
+    if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    tag := etag(body)
+    w.Header().Set("ETag", tag)
+    if (r.Method == http.MethodGet || r.Method == http.MethodHead) && etagMatches(r.Header.Get("If-None-Match"), tag, true) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(body)
+}
+
+// checkIfMatch compares the If-Match header of a write with the ETag of
+// current, the resource as stored at version. It returns the version the
+// write must still find, 0 when there is no If-Match, and answers 412 and
+// returns false when the client's copy is out of date.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current interface{}, version int) (int, bool) {
+    header := r.Header.Get("If-Match")
+    if header == "" {
+        return 0, true
+    }
+    body, err := encodeResource(current)
+    if err != nil {
+        problem.Internal(w, err)
+        return 0, false
+    }
+    if !etagMatches(header, etag(body), false) {
+        problem.Error(w, http.StatusPreconditionFailed, problem.PreconditionFailed, "Resource has changed since it was read, fetch it again")
+        return 0, false
+    }
+    return version, true
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+    "errors"
+    "net/url"
+    "strconv"
+    "strings"
+
+    "coffeeApi/services/store"
+)
+
+func parseFloats(value string, n int) ([]float64, bool) {
+    parts := strings.Split(value, ",")
+    if len(parts) != n {
+        return nil, false
+    }
+    values := make([]float64, n)
+    for i, p := range parts {
+        v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+        if err != nil {
+            return nil, false
+        }
+        values[i] = v
+    }
+    return values, true
+}
+
+func validLatLon(lat, lon float64) bool {
+    return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// parseGeoFilter reads near=lat,lon, radius=km and
+// bbox=minLon,minLat,maxLon,maxLat from the query string.
+func parseGeoFilter(q url.Values) (store.GeoFilter, error) {
+    var f store.GeoFilter
+    if v := q.Get("near"); v != "" {
+        p, ok := parseFloats(v, 2)
+        if !ok || !validLatLon(p[0], p[1]) {
+            return f, errors.New("near must be lat,lon")
+        }
+        f.Near = &store.GeoPoint{Lat: p[0], Lon: p[1]}
+    }
+    if v := q.Get("radius"); v != "" {
+        radius, err := strconv.ParseFloat(v, 64)
+        if err != nil || radius <= 0 {
+            return f, errors.New("radius must be a positive number of kilometres")
+        }
+        if f.Near == nil {
+            return f, errors.New("radius requires near")
+        }
+        f.RadiusKm = radius
+    }
+    if v := q.Get("bbox"); v != "" {
+        b, ok := parseFloats(v, 4)
+        if !ok || !validLatLon(b[1], b[0]) || !validLatLon(b[3], b[2]) || b[1] > b[3] {
+            return f, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+        }
+        f.BBox = &store.BoundingBox{MinLon: b[0], MinLat: b[1], MaxLon: b[2], MaxLat: b[3]}
+    }
+    return f, nil
+}
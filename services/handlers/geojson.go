@@ -0,0 +1,61 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "coffeeApi/services/store"
+)
+
+const geoJSONType = "application/geo+json"
+
+type geoJSONPoint struct {
+    Type        string     `json:"type"`
+    Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONProperties struct {
+    Name       string   `json:"name"`
+    City       string   `json:"city"`
+    AvgRating  float32  `json:"avgRating"`
+    Website    string   `json:"website"`
+    DistanceKm *float64 `json:"distanceKm,omitempty"`
+}
+
+type geoJSONFeature struct {
+    Type       string            `json:"type"`
+    ID         int               `json:"id"`
+    Geometry   *geoJSONPoint     `json:"geometry"`
+    Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+    Type     string           `json:"type"`
+    Features []geoJSONFeature `json:"features"`
+}
+
+// newFeature builds a Point feature. Rows that were never geocoded keep the
+// 0,0 placeholder and get a null geometry instead.
+func newFeature(id int, lat, lon float64, props geoJSONProperties) geoJSONFeature {
+    f := geoJSONFeature{Type: "Feature", ID: id, Properties: props}
+    if lat != 0 || lon != 0 {
+        f.Geometry = &geoJSONPoint{Type: "Point", Coordinates: [2]float64{lon, lat}}
+    }
+    return f
+}
+
+func wantsGeoJSON(r *http.Request) bool {
+    return strings.Contains(r.Header.Get("Accept"), geoJSONType)
+}
+
+func writeFeatureCollection[T any](w http.ResponseWriter, r *http.Request, page store.Page[T], opts store.ListOptions, features []geoJSONFeature) {
+    if len(page.Items) < page.Total {
+        writePageHeaders(w, r, page, opts)
+    } else {
+        w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+    }
+    w.Header().Set("Content-Type", geoJSONType)
+    json.NewEncoder(w).Encode(geoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
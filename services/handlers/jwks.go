@@ -0,0 +1,25 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "coffeeApi/services/auth"
+)
+
+// JWKSHandler publishes the public keys our tokens are signed with, so
+// other services can verify them.
+type JWKSHandler struct {
+    keys *auth.KeyManager
+}
+
+func NewJWKSHandler(keys *auth.KeyManager) *JWKSHandler {
+    return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    // Well under the time a new key is published before it signs.
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    json.NewEncoder(w).Encode(h.keys.JWKS())
+}
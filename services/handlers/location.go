@@ -0,0 +1,95 @@
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+
+    "coffeeApi/services/geocoding"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+)
+
+// location points at the address, coordinate and geocoding status fields
+// of a shop or roastery, so one code path can locate both.
+type location struct {
+    Address, City, Country *string
+    Lat, Lon               *float64
+    Status                 *string
+    AddressPending         *bool
+}
+
+func (l location) fullAddress() string {
+    return fmt.Sprintf("%s, %s, %s", *l.Address, *l.City, *l.Country)
+}
+
+func (l location) sameAddress(other location) bool {
+    return geocoding.NormalizeAddress(l.fullAddress()) == geocoding.NormalizeAddress(other.fullAddress())
+}
+
+// decodeLocated decodes a shop or roastery payload into v and reports
+// whether the client sent its own coordinates.
+func decodeLocated(r *http.Request, v interface{}) (bool, []problem.FieldError, error) {
+    obj, err := readObject(r)
+    if err != nil {
+        return false, nil, err
+    }
+    errs := decodeObject(obj, v)
+    lat, lon := isSet(obj["lat"]), isSet(obj["lon"])
+    if lat != lon {
+        errs = append(errs, missingCoordinate(lat))
+    }
+    return lat && lon, errs, nil
+}
+
+func isSet(raw json.RawMessage) bool {
+    return raw != nil && string(bytes.TrimSpace(raw)) != "null"
+}
+
+// missingCoordinate reports the coordinate missing from a pin, lon when
+// only lat was sent.
+func missingCoordinate(haveLat bool) problem.FieldError {
+    field := "lat"
+    if haveLat {
+        field = "lon"
+    }
+    return problem.FieldError{Field: field, Code: "required", Message: "lat and lon must be sent together"}
+}
+
+// locate decides what the background geocoding worker still has to look
+// up. Coordinates the client sent are kept, and a bare map pin waits for its
+// missing address fields from reverse geocoding. An address that is the
+// same as in prev keeps its coordinates; any other address is left pending.
+func locate(loc location, pinned bool, prev *location) {
+    if pinned {
+        *loc.Status = store.GeocodeResolved
+        *loc.AddressPending = *loc.Address == "" || *loc.City == "" || *loc.Country == ""
+        return
+    }
+    if prev != nil && loc.sameAddress(*prev) {
+        *loc.Lat, *loc.Lon, *loc.Status, *loc.AddressPending = *prev.Lat, *prev.Lon, *prev.Status, *prev.AddressPending
+        // Saving a failed address again is a request to retry it.
+        if *loc.Status == store.GeocodeFailed {
+            *loc.Status = store.GeocodePending
+        }
+        return
+    }
+    *loc.Lat, *loc.Lon, *loc.Status, *loc.AddressPending = 0, 0, store.GeocodePending, false
+}
+
+// waiting reports whether the worker has something to look up for loc.
+func (l location) waiting() bool {
+    return *l.Status == store.GeocodePending || *l.AddressPending
+}
+
+// parseGeocodeStatus reads the geocodeStatus list filter.
+func parseGeocodeStatus(q url.Values) (string, error) {
+    switch status := q.Get("geocodeStatus"); status {
+    case "", store.GeocodePending, store.GeocodeResolved, store.GeocodeFailed:
+        return status, nil
+    default:
+        return "", fmt.Errorf("geocodeStatus must be one of pending, resolved, failed")
+    }
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/problem"
+
+    "github.com/gorilla/mux"
+)
+
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// loginLocked answers 429 and returns true while the username or the
+// client address is locked out.
+func (h *UserHandler) loginLocked(w http.ResponseWriter, r *http.Request, username string) bool {
+    wait, err := h.logins.Locked(r.Context(), auth.UsernameKey(username), auth.ClientKey(r))
+    if err != nil {
+        problem.Internal(w, err)
+        return true
+    }
+    if wait > 0 {
+        writeRetryAfter(w, wait)
+        problem.Error(w, http.StatusTooManyRequests, problem.TooManyAttempts, "Too many failed login attempts, try again later")
+        return true
+    }
+    return false
+}
+
+// loginFailed counts a failed login against the username and the client
+// address and answers 401, with Retry-After when the failure started a
+// lockout.
+func (h *UserHandler) loginFailed(w http.ResponseWriter, r *http.Request, username string) {
+    var wait time.Duration
+    counters := []struct {
+        key    string
+        policy auth.LockoutPolicy
+    }{
+        {auth.UsernameKey(username), auth.UsernameLockout},
+        {auth.ClientKey(r), auth.ClientLockout},
+    }
+    for _, c := range counters {
+        lock, err := h.logins.Fail(r.Context(), c.key, c.policy.Window, c.policy.Delay)
+        if err != nil {
+            log.Printf("recording failed login for %s: %v", c.key, err)
+        }
+        wait = max(wait, lock)
+    }
+    if wait > 0 {
+        writeRetryAfter(w, wait)
+    }
+    problem.Error(w, http.StatusUnauthorized, problem.InvalidCredentials, "Invalid credentials")
+}
+
+// Unlock lifts the lockout of an account and forgets its failed logins.
+// Locks of client addresses stay until they expire.
+func (h *UserHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+    userID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        badRequest(w, "Invalid user ID")
+        return
+    }
+    user, err := h.users.Get(r.Context(), userID)
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database error")
+        return
+    }
+    if err := h.logins.Reset(r.Context(), auth.UsernameKey(user.Username)); err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
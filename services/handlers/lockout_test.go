@@ -0,0 +1,44 @@
+package handlers
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestLoginLockout(t *testing.T) {
+    const password = "correct horse battery"
+    tests := []struct {
+        name     string
+        username string
+        // failures wrong passwords are sent before the checked login.
+        failures   int
+        password   string
+        status     int
+        retryAfter string
+    }{
+        {"free attempt", "ana", 2, "wrong", http.StatusUnauthorized, ""},
+        {"failure starting a delay", "ana", 3, "wrong", http.StatusUnauthorized, "1"},
+        {"correct password before the delay", "ana", 3, password, http.StatusOK, ""},
+        {"correct password during the delay", "ana", 4, password, http.StatusTooManyRequests, "1"},
+        {"unknown account", "nobody", 3, "wrong", http.StatusUnauthorized, "1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            router, stores, _ := newAccountRouter(t)
+            addUser(t, stores.Users, "ana", password)
+            body := func(password string) string {
+                return `{"username": "` + tt.username + `", "passwords": "` + password + `"}`
+            }
+            for i := 0; i < tt.failures; i++ {
+                if rec := serve(router, "POST", "/login", "application/json", body("wrong")); rec.Code != http.StatusUnauthorized {
+                    t.Fatalf("failure %d: status = %d", i+1, rec.Code)
+                }
+            }
+
+            rec := serve(router, "POST", "/login", "application/json", body(tt.password))
+            if rec.Code != tt.status || rec.Header().Get("Retry-After") != tt.retryAfter {
+                t.Errorf("status %d, Retry-After %q; want %d, %q", rec.Code, rec.Header().Get("Retry-After"), tt.status, tt.retryAfter)
+            }
+        })
+    }
+}
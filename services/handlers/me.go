@@ -0,0 +1,233 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+func writeUser(w http.ResponseWriter, u models.User) {
+    u.Password = ""
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(u)
+}
+
+// currentUser loads the account of the authenticated caller.
+func (h *UserHandler) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+    user, err := h.users.Get(r.Context(), auth.PrincipalFrom(r.Context()).UserID)
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database error")
+        return user, false
+    }
+    return user, true
+}
+
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.currentUser(w, r)
+    if !ok {
+        return
+    }
+    writeUser(w, user)
+}
+
+type updateMeRequest struct {
+    Username  *string `json:"username"`
+    Email     *string `json:"email"`
+    AvatarURL *string `json:"avatarUrl"`
+}
+
+// UpdateMe changes the username, email and avatar of the caller. Fields
+// left out of the body keep their current values. A new email has to be
+// verified again.
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+    var body updateMeRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    user, ok := h.currentUser(w, r)
+    if !ok {
+        return
+    }
+
+    previousEmail := user.Email
+    if body.Username != nil {
+        if err := validateUsername(*body.Username); err != nil {
+            errs = append(errs, fieldError("username", err))
+        }
+        user.Username = *body.Username
+    }
+    if body.Email != nil {
+        if email, err := normalizeEmail(*body.Email); err != nil {
+            errs = append(errs, fieldError("email", err))
+        } else {
+            user.Email = email
+        }
+    }
+    if body.AvatarURL != nil {
+        if err := validateAvatarURL(*body.AvatarURL); err != nil {
+            errs = append(errs, fieldError("avatarUrl", err))
+        }
+        user.AvatarURL = *body.AvatarURL
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+
+    if err := h.users.Update(r.Context(), &user); err != nil {
+        writeStoreError(w, err, "User not found", "Database update error")
+        return
+    }
+    if !strings.EqualFold(previousEmail, user.Email) {
+        h.sendVerification(user)
+    }
+    writeUser(w, user)
+}
+
+func validateAvatarURL(raw string) error {
+    if raw == "" {
+        return nil
+    }
+    u, err := url.Parse(raw)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > 2048 {
+        return errors.New("avatarUrl must be an http or https URL")
+    }
+    return nil
+}
+
+// checkPassword answers 403 and returns false unless password is the
+// caller's current password.
+func checkPassword(w http.ResponseWriter, user models.User, password string) bool {
+    if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+        problem.Error(w, http.StatusForbidden, problem.InvalidCredentials, "Current password is incorrect")
+        return false
+    }
+    return true
+}
+
+type changePasswordRequest struct {
+    CurrentPassword string `json:"currentPassword"`
+    NewPassword     string `json:"newPassword"`
+}
+
+// ChangePassword sets a new password after verifying the current one. All
+// sessions and API keys are revoked, so stolen tokens and keys stop working,
+// and the caller gets tokens for a new session in the response.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+    var body changePasswordRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if err := validatePassword(body.NewPassword); err != nil {
+        errs = append(errs, fieldError("newPassword", err))
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+    user, ok := h.currentUser(w, r)
+    if !ok || !checkPassword(w, user, body.CurrentPassword) {
+        return
+    }
+
+    hashed, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("hashing password: %w", err))
+        return
+    }
+    if err := h.users.SetPassword(r.Context(), user.ID, string(hashed)); err != nil {
+        writeStoreError(w, err, "User not found", "Database update error")
+        return
+    }
+    if err := h.revokeCredentials(r, user.ID); err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    h.startSession(w, r, user)
+}
+
+type deleteMeRequest struct {
+    Password string `json:"password"`
+}
+
+// DeleteMe deletes the caller's account after verifying the password. The
+// reviews query parameter decides what happens to their reviews:
+// "anonymize" (the default) keeps them without an author, "delete" removes
+// them and recomputes the affected ratings.
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+    var deleteReviews bool
+    switch r.URL.Query().Get("reviews") {
+    case "", "anonymize":
+    case "delete":
+        deleteReviews = true
+    default:
+        badRequest(w, "reviews must be anonymize or delete")
+        return
+    }
+    var body deleteMeRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+    user, ok := h.currentUser(w, r)
+    if !ok || !checkPassword(w, user, body.Password) {
+        return
+    }
+    if user.Role == auth.RoleAdmin {
+        admins, err := h.users.CountByRole(r.Context(), auth.RoleAdmin)
+        if err != nil {
+            problem.Internal(w, err)
+            return
+        }
+        if admins <= 1 {
+            problem.Error(w, http.StatusConflict, problem.Conflict, "Cannot delete the last admin")
+            return
+        }
+    }
+
+    if err := h.users.Delete(r.Context(), user.ID, deleteReviews); err != nil {
+        writeStoreError(w, err, "User not found", "Database delete error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUsers lists accounts for admins, filtered by username, email and role.
+func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    filter := store.UserFilter{
+        Username: q.Get("username"),
+        Email:    q.Get("email"),
+        Role:     q.Get("role"),
+    }
+    opts, err := parseListOptions(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    page, err := h.users.List(r.Context(), filter, opts)
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+    for i := range page.Items {
+        page.Items[i].Password = ""
+    }
+    writeList(w, r, page, opts)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/models"
+    "coffeeApi/services/oidc"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+)
+
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcErrorCodes are the error codes of RFC 6749 and OpenID Connect Core
+// that an authorization response may carry. Callback names only these in
+// its reply; anything else the redirect brings is logged.
+var oidcErrorCodes = map[string]bool{
+    "invalid_request":            true,
+    "unauthorized_client":        true,
+    "access_denied":              true,
+    "unsupported_response_type":  true,
+    "invalid_scope":              true,
+    "server_error":               true,
+    "temporarily_unavailable":    true,
+    "interaction_required":       true,
+    "login_required":             true,
+    "account_selection_required": true,
+    "consent_required":           true,
+    "invalid_request_uri":        true,
+    "invalid_request_object":     true,
+    "request_not_supported":      true,
+    "request_uri_not_supported":  true,
+    "registration_not_supported": true,
+}
+
+// OIDCHandler signs users in through external OpenID Connect providers
+// with the authorization code flow and PKCE.
+type OIDCHandler struct {
+    users      *UserHandler
+    identities store.IdentityStore
+    providers  map[string]*oidc.Provider
+}
+
+func NewOIDCHandler(users *UserHandler, identities store.IdentityStore, providers []*oidc.Provider) *OIDCHandler {
+    h := &OIDCHandler{users: users, identities: identities, providers: map[string]*oidc.Provider{}}
+    for _, p := range providers {
+        h.providers[p.Name] = p
+    }
+    return h
+}
+
+func (h *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+    p, ok := h.providers[mux.Vars(r)["provider"]]
+    if !ok {
+        problem.Error(w, http.StatusNotFound, problem.NotFound, "Unknown identity provider")
+    }
+    return p, ok
+}
+
+func (h *OIDCHandler) redirectURI(p *oidc.Provider) string {
+    return h.users.publicURL + "/oidc/" + p.Name + "/callback"
+}
+
+// Login redirects to the provider. The state, nonce and PKCE verifier are
+// kept on the server until the provider redirects back to Callback.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+    p, ok := h.provider(w, r)
+    if !ok {
+        return
+    }
+    login := store.PendingLogin{Provider: p.Name, ExpiresAt: time.Now().Add(oidcLoginTTL)}
+    var err error
+    for _, v := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+        if *v, err = oidc.RandomString(32); err != nil {
+            problem.Internal(w, fmt.Errorf("generating login state: %w", err))
+            return
+        }
+    }
+    target, err := p.AuthCodeURL(r.Context(), h.redirectURI(p), login.State, login.Nonce, login.Verifier, r.URL.Query().Get("login_hint"))
+    if err != nil {
+        problem.Log(w, err)
+        problem.Error(w, http.StatusBadGateway, problem.UpstreamFailed, "Identity provider unavailable")
+        return
+    }
+    if err := h.identities.StartLogin(r.Context(), login); err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    http.Redirect(w, r, target, http.StatusFound)
+}
+
+// Callback finishes a login started by Login and answers with tokens in
+// the same form as POST /login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+    p, ok := h.provider(w, r)
+    if !ok {
+        return
+    }
+    q := r.URL.Query()
+    if e := q.Get("error"); e != "" {
+        problem.Log(w, fmt.Errorf("identity provider %s: error %q: %s", p.Name, e, q.Get("error_description")))
+        detail := "Login at identity provider failed"
+        if oidcErrorCodes[e] {
+            detail += ": " + e
+        }
+        problem.Error(w, http.StatusUnauthorized, problem.InvalidCredentials, detail)
+        return
+    }
+    login, err := h.identities.FinishLogin(r.Context(), q.Get("state"))
+    if err == store.ErrNotFound || (err == nil && login.Provider != p.Name) {
+        badRequest(w, "Invalid or expired login state")
+        return
+    } else if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    claims, err := p.Exchange(r.Context(), h.redirectURI(p), q.Get("code"), login.Verifier)
+    if err != nil {
+        problem.Log(w, err)
+        problem.Error(w, http.StatusUnauthorized, problem.InvalidCredentials, "Login at identity provider failed")
+        return
+    }
+    if claims.Nonce != login.Nonce {
+        problem.Error(w, http.StatusUnauthorized, problem.InvalidCredentials, "Login at identity provider failed: nonce mismatch")
+        return
+    }
+
+    user, ok := h.resolveUser(w, r, claims)
+    if !ok {
+        return
+    }
+    h.users.startSession(w, r, user)
+}
+
+// resolveUser finds the user linked to the identity in claims. An unknown
+// identity is linked to the account with the same email when both the
+// provider and the account have verified it, and gets a new account when
+// no account uses the email.
+func (h *OIDCHandler) resolveUser(w http.ResponseWriter, r *http.Request, claims *oidc.IDToken) (models.User, bool) {
+    ctx := r.Context()
+    userID, err := h.identities.Find(ctx, claims.Issuer, claims.Subject)
+    if err == nil {
+        user, err := h.users.users.Get(ctx, userID)
+        if err != nil {
+            writeStoreError(w, err, "User not found", "Database error")
+            return user, false
+        }
+        return user, true
+    } else if err != store.ErrNotFound {
+        problem.Internal(w, err)
+        return models.User{}, false
+    }
+
+    email, err := normalizeEmail(claims.Email)
+    if err != nil {
+        problem.Error(w, http.StatusUnprocessableEntity, problem.UpstreamFailed, "Identity provider did not share a valid email address")
+        return models.User{}, false
+    }
+    identity := store.Identity{Issuer: claims.Issuer, Subject: claims.Subject, Email: email}
+
+    existing, err := h.users.users.GetByEmail(ctx, email)
+    if err == nil {
+        if !claims.EmailVerified || !existing.EmailVerified {
+            problem.Error(w, http.StatusConflict, problem.Duplicate, "Email already registered; verify it on the existing account to sign in with this provider")
+            return existing, false
+        }
+        identity.UserID = existing.ID
+        if err := h.identities.Link(ctx, identity); err != nil {
+            writeStoreError(w, err, "User not found", "Database insert error")
+            return existing, false
+        }
+        return existing, true
+    } else if err != store.ErrNotFound {
+        problem.Internal(w, err)
+        return existing, false
+    }
+
+    user := models.User{
+        Email:         email,
+        EmailVerified: claims.EmailVerified,
+        Role:          auth.RoleUser,
+        // No password until one is set through POST /password/forgot.
+    }
+    if user.Username, err = h.freeUsername(ctx, claims); err != nil {
+        problem.Internal(w, err)
+        return user, false
+    }
+    if err := h.identities.CreateUser(ctx, &user, identity); err != nil {
+        writeStoreError(w, err, "User not found", "Error inserting user")
+        return user, false
+    }
+    return user, true
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^\p{L}\p{N}_.-]+`)
+
+// freeUsername derives a valid username from the claims, adding a number
+// when it is taken.
+func (h *OIDCHandler) freeUsername(ctx context.Context, claims *oidc.IDToken) (string, error) {
+    base := claims.PreferredUsername
+    if base == "" {
+        base, _, _ = strings.Cut(claims.Email, "@")
+    }
+    base = usernameDisallowed.ReplaceAllString(base, "")
+    if len([]rune(base)) > 28 {
+        base = string([]rune(base)[:28])
+    }
+    for len([]rune(base)) < 3 {
+        base += "_"
+    }
+    name := base
+    for i := 2; ; i++ {
+        _, err := h.users.users.GetByUsername(ctx, name)
+        if errors.Is(err, store.ErrNotFound) {
+            return name, nil
+        } else if err != nil {
+            return "", err
+        }
+        name = base + strconv.Itoa(i)
+    }
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+)
+
+const (
+    defaultPageLimit = 100
+    maxPageLimit     = 500
+)
+
+// parseListOptions reads limit, offset, cursor and sort from the query
+// string. sort is a comma separated list of fields, each optionally
+// prefixed with "-" for descending order, e.g. sort=-avgRating,name.
+func parseListOptions(q url.Values) (store.ListOptions, error) {
+    opts := store.ListOptions{Limit: defaultPageLimit, Cursor: q.Get("cursor")}
+    if v := q.Get("limit"); v != "" {
+        limit, err := strconv.Atoi(v)
+        if err != nil || limit <= 0 {
+            return opts, errors.New("limit must be a positive integer")
+        }
+        if limit > maxPageLimit {
+            limit = maxPageLimit
+        }
+        opts.Limit = limit
+    }
+    if v := q.Get("offset"); v != "" {
+        offset, err := strconv.Atoi(v)
+        if err != nil || offset < 0 {
+            return opts, errors.New("offset must be a non-negative integer")
+        }
+        opts.Offset = offset
+    }
+    if opts.Cursor != "" && opts.Offset > 0 {
+        return opts, errors.New("cursor and offset cannot be combined")
+    }
+    if v := q.Get("sort"); v != "" {
+        for _, field := range strings.Split(v, ",") {
+            field = strings.TrimSpace(field)
+            desc := strings.HasPrefix(field, "-")
+            field = strings.TrimPrefix(field, "-")
+            if field == "" {
+                return opts, errors.New("sort contains an empty field")
+            }
+            opts.Sort = append(opts.Sort, store.SortField{Field: field, Desc: desc})
+        }
+    }
+    return opts, nil
+}
+
+// listUnlessPaged returns the page the client asked for, or every match
+// when the query has no paging parameters. Maps need the whole dataset, and
+// clients written before lists were paged expect all of it.
+func listUnlessPaged[T any](q url.Values, opts store.ListOptions, list func(store.ListOptions) (store.Page[T], error)) (store.Page[T], error) {
+    if q.Has("limit") || q.Has("offset") || q.Has("cursor") {
+        return list(opts)
+    }
+    opts.Limit = maxPageLimit
+    all, err := list(opts)
+    for err == nil && all.NextCursor != "" {
+        opts.Cursor = all.NextCursor
+        var page store.Page[T]
+        if page, err = list(opts); err == nil {
+            all.Items = append(all.Items, page.Items...)
+            all.NextCursor = page.NextCursor
+        }
+    }
+    return all, err
+}
+
+// writeList sends one page as a JSON array.
+func writeList[T any](w http.ResponseWriter, r *http.Request, page store.Page[T], opts store.ListOptions) {
+    writePageHeaders(w, r, page, opts)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(page.Items)
+}
+
+// writePageHeaders puts the total number of matches into X-Total-Count and
+// links to neighbouring pages into Link.
+func writePageHeaders[T any](w http.ResponseWriter, r *http.Request, page store.Page[T], opts store.ListOptions) {
+    w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+
+    var links []string
+    pageLink := func(rel string, set func(url.Values)) {
+        q := r.URL.Query()
+        q.Del("cursor")
+        q.Del("offset")
+        q.Set("limit", strconv.Itoa(opts.Limit))
+        set(q)
+        u := *r.URL
+        u.RawQuery = q.Encode()
+        links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+    }
+    // Offset paging keeps using offsets; the first page and cursor paging
+    // continue with the opaque cursor, which stays stable under inserts.
+    // Lists that cannot issue cursors fall back to offsets.
+    if opts.Cursor == "" && (opts.Offset > 0 || page.NextCursor == "") {
+        if opts.Offset+len(page.Items) < page.Total {
+            pageLink("next", func(q url.Values) { q.Set("offset", strconv.Itoa(opts.Offset+opts.Limit)) })
+        }
+        if opts.Offset > 0 {
+            prev := opts.Offset - opts.Limit
+            if prev < 0 {
+                prev = 0
+            }
+            pageLink("prev", func(q url.Values) { q.Set("offset", strconv.Itoa(prev)) })
+        }
+    } else if page.NextCursor != "" {
+        pageLink("next", func(q url.Values) { q.Set("cursor", page.NextCursor) })
+    }
+    if len(links) > 0 {
+        w.Header().Set("Link", strings.Join(links, ", "))
+    }
+}
+
+// writeListError answers 400 for a bad sort or cursor and 500 otherwise.
+func writeListError(w http.ResponseWriter, err error) {
+    if errors.Is(err, store.ErrInvalidListOptions) {
+        badRequest(w, err.Error())
+        return
+    }
+    problem.Internal(w, err)
+}
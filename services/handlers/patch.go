@@ -0,0 +1,445 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "mime"
+    "net/http"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+
+    "coffeeApi/services/problem"
+    "coffeeApi/services/validation"
+)
+
+// Media types accepted by PATCH routes.
+const (
+    mergePatchType = "application/merge-patch+json"
+    jsonPatchType  = "application/json-patch+json"
+)
+
+// Fields of each resource that a PATCH may change; the rest are read-only.
+var (
+    coffeeWritable  = []string{"name", "roasteryId", "country", "region", "farm", "variety", "process", "roastProfile", "flavourNotes", "description"}
+    locatedWritable = []string{"name", "country", "city", "address", "website", "description", "lat", "lon"}
+    reviewWritable  = []string{"rating", "review"}
+)
+
+// patchErrorf describes a patch that cannot be applied, with the status to
+// answer.
+func patchErrorf(status int, format string, args ...interface{}) error {
+    code := problem.PatchFailed
+    switch status {
+    case http.StatusBadRequest:
+        code = problem.InvalidRequest
+    case http.StatusUnsupportedMediaType:
+        code = problem.UnsupportedMediaType
+    }
+    return problem.Newf(status, code, format, args...)
+}
+
+func writePatchError(w http.ResponseWriter, err error) {
+    var p *problem.Problem
+    if !errors.As(err, &p) {
+        badRequest(w, "Invalid request payload: "+err.Error())
+        return
+    }
+    if p.Status == http.StatusUnsupportedMediaType {
+        w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+    }
+    problem.Write(w, p)
+}
+
+// patchedFields records the top-level fields of a resource that a patch
+// named and the ones whose value it actually changed.
+type patchedFields struct {
+    present map[string]bool
+    changed map[string]bool
+}
+
+// applyPatch applies the JSON Merge Patch (RFC 7396) or JSON Patch
+// (RFC 6902) in the body of r to the JSON form of current and decodes the
+// result into patched. Changing a field not listed in writable is refused.
+func applyPatch(r *http.Request, current, patched interface{}, writable []string) (patchedFields, error) {
+    fields := patchedFields{present: map[string]bool{}, changed: map[string]bool{}}
+
+    mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil || (mediaType != mergePatchType && mediaType != jsonPatchType) {
+        return fields, patchErrorf(http.StatusUnsupportedMediaType, "Content-Type must be %s or %s", mergePatchType, jsonPatchType)
+    }
+    body, err := readBody(r)
+    if err != nil {
+        return fields, err
+    }
+
+    // Patches change doc in place, so original is decoded separately.
+    var doc interface{}
+    var original map[string]interface{}
+    if err := roundTrip(current, &doc); err != nil {
+        return fields, err
+    }
+    if err := roundTrip(current, &original); err != nil {
+        return fields, err
+    }
+
+    if mediaType == mergePatchType {
+        var patch interface{}
+        if err := json.Unmarshal(body, &patch); err != nil {
+            return fields, patchErrorf(http.StatusBadRequest, "Invalid merge patch: %s", err)
+        }
+        if obj, ok := patch.(map[string]interface{}); ok {
+            for name := range obj {
+                fields.present[name] = true
+            }
+        } else {
+            fields.presentAll(original)
+        }
+        doc = mergePatch(doc, patch)
+    } else {
+        var ops []jsonPatchOp
+        if err := json.Unmarshal(body, &ops); err != nil {
+            return fields, patchErrorf(http.StatusBadRequest, "Invalid JSON patch: %s", err)
+        }
+        for i, op := range ops {
+            if doc, err = op.apply(doc); err != nil {
+                if p, ok := err.(*problem.Problem); ok {
+                    p.Detail = fmt.Sprintf("Operation %d (%s %s): %s", i, op.Op, op.Path, p.Detail)
+                }
+                return fields, err
+            }
+            if op.Op != "test" {
+                fields.touch(op.Path, original)
+            }
+            if op.Op == "move" {
+                fields.touch(op.From, original)
+            }
+        }
+    }
+
+    after, ok := doc.(map[string]interface{})
+    if !ok {
+        return fields, patchErrorf(http.StatusUnprocessableEntity, "The patched document must be an object")
+    }
+    dropIgnored(after, patched)
+    for name := range union(original, after) {
+        if !reflect.DeepEqual(original[name], after[name]) {
+            fields.changed[name] = true
+        }
+    }
+    var refused []problem.FieldError
+    for _, name := range sortedKeys(fields.changed) {
+        if unknown := validation.Unknown(patched, []string{name}); unknown != nil {
+            refused = append(refused, unknown...)
+        } else if !contains(writable, name) {
+            refused = append(refused, problem.FieldError{Field: name, Code: "read_only", Message: "Field " + name + " is read-only"})
+        }
+    }
+    if len(refused) > 0 {
+        p := problem.New(http.StatusUnprocessableEntity, problem.ValidationFailed, refused[0].Message)
+        p.Errors = refused
+        return fields, p
+    }
+
+    if err := roundTrip(after, patched); err != nil {
+        return fields, patchErrorf(http.StatusUnprocessableEntity, "Invalid patched document: %s", err)
+    }
+    return fields, nil
+}
+
+// touch marks the field that the JSON pointer path starts at as present,
+// or every field of doc when path is the whole document.
+func (f patchedFields) touch(path string, doc map[string]interface{}) {
+    tokens, err := parsePointer(path)
+    if err != nil {
+        return
+    }
+    if len(tokens) == 0 {
+        f.presentAll(doc)
+        return
+    }
+    f.present[tokens[0]] = true
+}
+
+func (f patchedFields) presentAll(doc map[string]interface{}) {
+    for name := range doc {
+        f.present[name] = true
+    }
+}
+
+func roundTrip(from, to interface{}) error {
+    data, err := json.Marshal(from)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(data, to)
+}
+
+func union(a, b map[string]interface{}) map[string]bool {
+    keys := map[string]bool{}
+    for k := range a {
+        keys[k] = true
+    }
+    for k := range b {
+        keys[k] = true
+    }
+    return keys
+}
+
+func sortedKeys(m map[string]bool) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+// mergePatch applies patch to target as described in RFC 7396: members of
+// a patch object replace those of the target, null removes them and any
+// other patch replaces the target whole.
+func mergePatch(target, patch interface{}) interface{} {
+    p, ok := patch.(map[string]interface{})
+    if !ok {
+        return patch
+    }
+    t, ok := target.(map[string]interface{})
+    if !ok {
+        t = map[string]interface{}{}
+    }
+    for name, value := range p {
+        if value == nil {
+            delete(t, name)
+        } else {
+            t[name] = mergePatch(t[name], value)
+        }
+    }
+    return t
+}
+
+// jsonPatchOp is one operation of an RFC 6902 JSON Patch.
+type jsonPatchOp struct {
+    Op    string          `json:"op"`
+    Path  string          `json:"path"`
+    From  string          `json:"from"`
+    Value json.RawMessage `json:"value"`
+}
+
+func (op jsonPatchOp) value() (interface{}, error) {
+    if op.Value == nil {
+        return nil, patchErrorf(http.StatusBadRequest, "value is required")
+    }
+    var v interface{}
+    err := json.Unmarshal(op.Value, &v)
+    return v, err
+}
+
+func (op jsonPatchOp) apply(doc interface{}) (interface{}, error) {
+    path, err := parsePointer(op.Path)
+    if err != nil {
+        return nil, err
+    }
+    switch op.Op {
+    case "add", "replace", "test":
+        value, err := op.value()
+        if err != nil {
+            return nil, err
+        }
+        switch op.Op {
+        case "add":
+            return addValue(doc, path, value)
+        case "replace":
+            return replaceValue(doc, path, value)
+        }
+        current, err := getValue(doc, path)
+        if err != nil {
+            return nil, err
+        }
+        if !reflect.DeepEqual(current, value) {
+            return nil, patchErrorf(http.StatusConflict, "test failed")
+        }
+        return doc, nil
+    case "remove":
+        return removeValue(doc, path)
+    case "move", "copy":
+        from, err := parsePointer(op.From)
+        if err != nil {
+            return nil, err
+        }
+        value, err := getValue(doc, from)
+        if err != nil {
+            return nil, err
+        }
+        if op.Op == "copy" {
+            var copied interface{}
+            if err := roundTrip(value, &copied); err != nil {
+                return nil, err
+            }
+            return addValue(doc, path, copied)
+        }
+        if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+            return nil, patchErrorf(http.StatusBadRequest, "cannot move a value into itself")
+        }
+        if doc, err = removeValue(doc, from); err != nil {
+            return nil, err
+        }
+        return addValue(doc, path, value)
+    default:
+        return nil, patchErrorf(http.StatusBadRequest, "unknown operation %q", op.Op)
+    }
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+    if pointer == "" {
+        return nil, nil
+    }
+    if !strings.HasPrefix(pointer, "/") {
+        return nil, patchErrorf(http.StatusBadRequest, "invalid JSON pointer %q", pointer)
+    }
+    tokens := strings.Split(pointer[1:], "/")
+    for i, t := range tokens {
+        tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+    }
+    return tokens, nil
+}
+
+// arrayIndex parses token as an index into an array of length n. The index
+// n itself, also written as "-", is allowed when appending.
+func arrayIndex(token string, n int, appending bool) (int, error) {
+    if token == "-" && appending {
+        return n, nil
+    }
+    i, err := strconv.Atoi(token)
+    if err != nil || i < 0 || token != strconv.Itoa(i) {
+        return 0, patchErrorf(http.StatusUnprocessableEntity, "invalid array index %q", token)
+    }
+    if i > n || (i == n && !appending) {
+        return 0, patchErrorf(http.StatusUnprocessableEntity, "array index %d out of range", i)
+    }
+    return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+    for _, token := range path {
+        switch node := doc.(type) {
+        case map[string]interface{}:
+            value, ok := node[token]
+            if !ok {
+                return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+            }
+            doc = value
+        case []interface{}:
+            i, err := arrayIndex(token, len(node), false)
+            if err != nil {
+                return nil, err
+            }
+            doc = node[i]
+        default:
+            return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+        }
+    }
+    return doc, nil
+}
+
+// update replaces the parent of the value at path with what f returns for
+// that parent and the last token of path.
+func update(doc interface{}, path []string, f func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+    if len(path) == 1 {
+        return f(doc, path[0])
+    }
+    child, err := getValue(doc, path[:1])
+    if err != nil {
+        return nil, err
+    }
+    child, err = update(child, path[1:], f)
+    if err != nil {
+        return nil, err
+    }
+    switch node := doc.(type) {
+    case map[string]interface{}:
+        node[path[0]] = child
+    case []interface{}:
+        i, _ := arrayIndex(path[0], len(node), false)
+        node[i] = child
+    }
+    return doc, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+    if len(path) == 0 {
+        return value, nil
+    }
+    return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+        switch node := parent.(type) {
+        case map[string]interface{}:
+            node[token] = value
+            return node, nil
+        case []interface{}:
+            i, err := arrayIndex(token, len(node), true)
+            if err != nil {
+                return nil, err
+            }
+            node = append(node, nil)
+            copy(node[i+1:], node[i:])
+            node[i] = value
+            return node, nil
+        }
+        return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+    })
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+    if len(path) == 0 {
+        return nil, patchErrorf(http.StatusUnprocessableEntity, "cannot remove the whole document")
+    }
+    return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+        switch node := parent.(type) {
+        case map[string]interface{}:
+            if _, ok := node[token]; !ok {
+                return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+            }
+            delete(node, token)
+            return node, nil
+        case []interface{}:
+            i, err := arrayIndex(token, len(node), false)
+            if err != nil {
+                return nil, err
+            }
+            return append(node[:i], node[i+1:]...), nil
+        }
+        return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+    })
+}
+
+func replaceValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+    if _, err := getValue(doc, path); err != nil {
+        return nil, err
+    }
+    if len(path) == 0 {
+        return value, nil
+    }
+    return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+        switch node := parent.(type) {
+        case map[string]interface{}:
+            node[token] = value
+            return node, nil
+        case []interface{}:
+            i, _ := arrayIndex(token, len(node), false)
+            node[i] = value
+            return node, nil
+        }
+        return nil, patchErrorf(http.StatusUnprocessableEntity, "path not found")
+    })
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "reflect"
+    "testing"
+
+    "coffeeApi/services/problem"
+)
+
+func TestJSONPatchOps(t *testing.T) {
+    const doc = `{"name": "Kenya AA", "notes": ["blackcurrant", "tomato"], "farm": {"name": "Gatomboya"}}`
+    tests := []struct {
+        name string
+        ops  string
+        // want is the patched document, or empty when status is expected.
+        want   string
+        status int
+    }{
+        {"append with -", `[{"op": "add", "path": "/notes/-", "value": "grapefruit"}]`,
+            `{"name": "Kenya AA", "notes": ["blackcurrant", "tomato", "grapefruit"], "farm": {"name": "Gatomboya"}}`, 0},
+        {"insert at index", `[{"op": "add", "path": "/notes/0", "value": "plum"}]`,
+            `{"name": "Kenya AA", "notes": ["plum", "blackcurrant", "tomato"], "farm": {"name": "Gatomboya"}}`, 0},
+        {"add at the length", `[{"op": "add", "path": "/notes/2", "value": "plum"}]`,
+            `{"name": "Kenya AA", "notes": ["blackcurrant", "tomato", "plum"], "farm": {"name": "Gatomboya"}}`, 0},
+        {"add past the length", `[{"op": "add", "path": "/notes/3", "value": "plum"}]`, "", http.StatusUnprocessableEntity},
+        {"replace with -", `[{"op": "replace", "path": "/notes/-", "value": "plum"}]`, "", http.StatusUnprocessableEntity},
+        {"remove with -", `[{"op": "remove", "path": "/notes/-"}]`, "", http.StatusUnprocessableEntity},
+        {"leading zero", `[{"op": "remove", "path": "/notes/01"}]`, "", http.StatusUnprocessableEntity},
+        {"move within an array", `[{"op": "move", "from": "/notes/0", "path": "/notes/-"}]`,
+            `{"name": "Kenya AA", "notes": ["tomato", "blackcurrant"], "farm": {"name": "Gatomboya"}}`, 0},
+        {"move between objects", `[{"op": "move", "from": "/farm/name", "path": "/region"}]`,
+            `{"name": "Kenya AA", "notes": ["blackcurrant", "tomato"], "farm": {}, "region": "Gatomboya"}`, 0},
+        {"move into itself", `[{"op": "move", "from": "/farm", "path": "/farm/old"}]`, "", http.StatusBadRequest},
+        {"move from a missing path", `[{"op": "move", "from": "/region", "path": "/farm/region"}]`, "", http.StatusUnprocessableEntity},
+        {"test passes", `[{"op": "test", "path": "/notes", "value": ["blackcurrant", "tomato"]}, {"op": "remove", "path": "/farm"}]`,
+            `{"name": "Kenya AA", "notes": ["blackcurrant", "tomato"]}`, 0},
+        {"test fails", `[{"op": "test", "path": "/name", "value": "Kenya AB"}, {"op": "remove", "path": "/farm"}]`, "", http.StatusConflict},
+        {"test without a value", `[{"op": "test", "path": "/name"}]`, "", http.StatusBadRequest},
+        {"test of a missing path", `[{"op": "test", "path": "/region", "value": null}]`, "", http.StatusUnprocessableEntity},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got interface{}
+            if err := json.Unmarshal([]byte(doc), &got); err != nil {
+                t.Fatal(err)
+            }
+            var ops []jsonPatchOp
+            if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+                t.Fatal(err)
+            }
+            var err error
+            for _, op := range ops {
+                if got, err = op.apply(got); err != nil {
+                    break
+                }
+            }
+
+            if tt.want == "" {
+                var p *problem.Problem
+                if !errors.As(err, &p) || p.Status != tt.status {
+                    t.Errorf("error = %v, want status %d", err, tt.status)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("applying: %v", err)
+            }
+            var want interface{}
+            json.Unmarshal([]byte(tt.want), &want)
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("patched = %v, want %v", got, want)
+            }
+        })
+    }
+}
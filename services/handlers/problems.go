@@ -0,0 +1,39 @@
+package handlers
+
+import (
+    "net/http"
+    "sort"
+
+    "coffeeApi/services/problem"
+)
+
+// badRequest answers 400 for a body, ID or parameter that cannot be parsed.
+func badRequest(w http.ResponseWriter, detail string) {
+    problem.Error(w, http.StatusBadRequest, problem.InvalidRequest, detail)
+}
+
+// requiredFields lists the fields whose value is empty, by their JSON names.
+func requiredFields(values map[string]string) []problem.FieldError {
+    var errs []problem.FieldError
+    for field, value := range values {
+        if value == "" {
+            errs = append(errs, problem.FieldError{Field: field, Code: "required", Message: field + " is required"})
+        }
+    }
+    sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+    return errs
+}
+
+// fieldError reports err, a failed format check, against field.
+func fieldError(field string, err error) problem.FieldError {
+    return problem.FieldError{Field: field, Code: "invalid", Message: err.Error()}
+}
+
+// addressFields lists the missing address fields of a shop or roastery
+// whose address has to be geocoded.
+func addressFields(loc location, needAddress bool) []problem.FieldError {
+    if !needAddress {
+        return nil
+    }
+    return requiredFields(map[string]string{"address": *loc.Address, "city": *loc.City, "country": *loc.Country})
+}
@@ -1,606 +1,270 @@
 package handlers
 
 import (
-    "database/sql"
-    "encoding/json"
-    "fmt"
     "net/http"
     "strconv"
-    "strings"
     "time"
-    "coffeeApi/services/db"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
     "github.com/gorilla/mux"
 )
 
-type Review struct {
-    ID             int       `json:"id"`
-    UserId         int       `json:"userId"`
-    CoffeeId       int       `json:"coffeeId"`
-    RoasteryId     int       `json:"roasteryId"`
-    CoffeeShopId   int       `json:"coffeeShopId"`
-    Rating         float32   `json:"rating"`
-    Review         string    `json:"review"`
-    DateOfCreation time.Time `json:"dateOfCreation"`
+type ReviewHandler struct {
+    reviews store.ReviewStore
+    users   store.UserStore
+    // requireVerified only lets users with a verified email write reviews.
+    requireVerified bool
 }
 
-type ReviewResponse struct {
-    ID             int       `json:"id"`
-    UserId         int       `json:"userId"`
-    UserName       string    `json:"userName"`
-    CoffeeId       int       `json:"coffeeId"`
-    CoffeeName     string    `json:"coffeeName,omitempty"`
-    RoasteryId     int       `json:"roasteryId"`
-    RoasteryName   string    `json:"roasteryName,omitempty"`
-    CoffeeShopId   int       `json:"coffeeShopId"`
-    CoffeeShopName string    `json:"coffeeShopName,omitempty"`
-    Rating         float32   `json:"rating"`
-    Review         string    `json:"review"`
-    DateOfCreation time.Time `json:"dateOfCreation"`
-    TargetType     string    `json:"targetType"`
-    TargetName     string    `json:"targetName"`
+func NewReviewHandler(reviews store.ReviewStore, users store.UserStore, requireVerified bool) *ReviewHandler {
+    return &ReviewHandler{reviews: reviews, users: users, requireVerified: requireVerified}
 }
 
-func allowedRating(rating float32) bool {
-    intRating := int(rating)
-    if float32(intRating) != rating {
-        return false
-    }
-    return intRating >= 1 && intRating <= 5
-}
-
-func GetReviewsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *ReviewHandler) GetReviews(w http.ResponseWriter, r *http.Request) {
     q := r.URL.Query()
-    
-    userId := q.Get("userId")
-    coffeeId := q.Get("coffeeId")
-    roasteryId := q.Get("roasteryId")
-    coffeeShopId := q.Get("coffeeShopId")
-    minRating := q.Get("minRating")
-    maxRating := q.Get("maxRating")
-    fromDate := q.Get("fromDate")
-    toDate := q.Get("toDate")
-    
-    coffeeCountry := q.Get("coffeeCountry")
-    coffeeProcess := q.Get("coffeeProcess")
-    coffeeRoastProfile := q.Get("coffeeRoastProfile")
-    coffeeFlavour := q.Get("coffeeFlavour")
-    
-    roasteryCountry := q.Get("roasteryCountry")
-    roasteryCity := q.Get("roasteryCity")
-    
-    shopCountry := q.Get("shopCountry")
-    shopCity := q.Get("shopCity")
-    
-    baseQuery := `
-        SELECT r.id, r.user_id, r.coffee_id, r.roastery_id, r.coffee_shop_id, r.rating, r.review, r.date_of_creation,
-               u.username AS user_name,
-               c.name AS coffee_name,
-               ro.name AS roastery_name,
-               s.name AS shop_name
-        FROM reviews r
-        LEFT JOIN users u ON r.user_id = u.id
-        LEFT JOIN coffees c ON r.coffee_id = c.id
-        LEFT JOIN roasteries ro ON r.roastery_id = ro.id
-        LEFT JOIN shops s ON r.coffee_shop_id = s.id`
-    
-    conditions := []string{}
-    args := []interface{}{}
-    argIdx := 1
-    
-    if userId != "" {
-        if id, err := strconv.Atoi(userId); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.user_id = $%d", argIdx))
-            args = append(args, id)
-            argIdx++
-        }
-    }
-    if coffeeId != "" {
-        if id, err := strconv.Atoi(coffeeId); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.coffee_id = $%d", argIdx))
-            args = append(args, id)
-            argIdx++
-        }
-    }
-    if roasteryId != "" {
-        if id, err := strconv.Atoi(roasteryId); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.roastery_id = $%d", argIdx))
-            args = append(args, id)
-            argIdx++
-        }
-    }
-    if coffeeShopId != "" {
-        if id, err := strconv.Atoi(coffeeShopId); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.coffee_shop_id = $%d", argIdx))
-            args = append(args, id)
-            argIdx++
-        }
-    }
-    if minRating != "" {
-        if rating, err := strconv.ParseFloat(minRating, 32); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.rating >= $%d", argIdx))
-            args = append(args, float32(rating))
-            argIdx++
-        }
-    }
-    if maxRating != "" {
-        if rating, err := strconv.ParseFloat(maxRating, 32); err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.rating <= $%d", argIdx))
-            args = append(args, float32(rating))
-            argIdx++
-        }
-    }
-    if fromDate != "" {
-        date, err := time.Parse("2006-01-02", fromDate)
-        if err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.date_of_creation >= $%d", argIdx))
-            args = append(args, date)
-            argIdx++
-        }
-    }
-    if toDate != "" {
-        date, err := time.Parse("2006-01-02", toDate)
-        if err == nil {
-            conditions = append(conditions, fmt.Sprintf("r.date_of_creation <= $%d", argIdx))
-            args = append(args, date.Add(24*time.Hour))
-            argIdx++
-        }
-    }
-    
-    if coffeeCountry != "" {
-        conditions = append(conditions, fmt.Sprintf("c.country ILIKE $%d", argIdx))
-        args = append(args, "%"+coffeeCountry+"%")
-        argIdx++
+
+    filter := store.ReviewFilter{
+        CoffeeCountry:      q.Get("coffeeCountry"),
+        CoffeeProcess:      q.Get("coffeeProcess"),
+        CoffeeRoastProfile: q.Get("coffeeRoastProfile"),
+        CoffeeFlavour:      q.Get("coffeeFlavour"),
+        RoasteryCountry:    q.Get("roasteryCountry"),
+        RoasteryCity:       q.Get("roasteryCity"),
+        ShopCountry:        q.Get("shopCountry"),
+        ShopCity:           q.Get("shopCity"),
     }
-    if coffeeProcess != "" {
-        conditions = append(conditions, fmt.Sprintf("c.process ILIKE $%d", argIdx))
-        args = append(args, "%"+coffeeProcess+"%")
-        argIdx++
+    if id, err := strconv.Atoi(q.Get("userId")); err == nil {
+        filter.UserID = id
     }
-    if coffeeRoastProfile != "" {
-        conditions = append(conditions, fmt.Sprintf("c.roast_profile ILIKE $%d", argIdx))
-        args = append(args, "%"+coffeeRoastProfile+"%")
-        argIdx++
+    if id, err := strconv.Atoi(q.Get("coffeeId")); err == nil {
+        filter.CoffeeID = id
     }
-    if coffeeFlavour != "" {
-        conditions = append(conditions, fmt.Sprintf("c.flavour_notes ILIKE $%d", argIdx))
-        args = append(args, "%"+coffeeFlavour+"%")
-        argIdx++
+    if id, err := strconv.Atoi(q.Get("roasteryId")); err == nil {
+        filter.RoasteryID = id
     }
-    
-    if roasteryCountry != "" {
-        conditions = append(conditions, fmt.Sprintf("ro.country ILIKE $%d", argIdx))
-        args = append(args, "%"+roasteryCountry+"%")
-        argIdx++
+    if id, err := strconv.Atoi(q.Get("coffeeShopId")); err == nil {
+        filter.CoffeeShopID = id
     }
-    if roasteryCity != "" {
-        conditions = append(conditions, fmt.Sprintf("ro.city ILIKE $%d", argIdx))
-        args = append(args, "%"+roasteryCity+"%")
-        argIdx++
+    if rating, err := strconv.ParseFloat(q.Get("minRating"), 32); err == nil {
+        filter.MinRating = &rating
     }
-    
-    if shopCountry != "" {
-        conditions = append(conditions, fmt.Sprintf("s.country ILIKE $%d", argIdx))
-        args = append(args, "%"+shopCountry+"%")
-        argIdx++
+    if rating, err := strconv.ParseFloat(q.Get("maxRating"), 32); err == nil {
+        filter.MaxRating = &rating
     }
-    if shopCity != "" {
-        conditions = append(conditions, fmt.Sprintf("s.city ILIKE $%d", argIdx))
-        args = append(args, "%"+shopCity+"%")
-        argIdx++
+    if date, err := time.Parse("2006-01-02", q.Get("fromDate")); err == nil {
+        filter.FromDate = &date
     }
-
-    if len(conditions) > 0 {
-        baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+    if date, err := time.Parse("2006-01-02", q.Get("toDate")); err == nil {
+        filter.ToDate = &date
     }
 
-    baseQuery += " ORDER BY r.date_of_creation DESC"
-
-    rows, err := db.DB.Query(baseQuery, args...)
+    opts, err := parseListOptions(q)
     if err != nil {
-        http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
+        badRequest(w, err.Error())
         return
     }
-    defer rows.Close()
-
-    var reviewResponses []ReviewResponse
-    for rows.Next() {
-        var rev Review
-        var userName, coffeeName, roasteryName, shopName sql.NullString
-        
-        if err := rows.Scan(
-            &rev.ID, &rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId, 
-            &rev.Rating, &rev.Review, &rev.DateOfCreation,
-            &userName, &coffeeName, &roasteryName, &shopName); err != nil {
-            http.Error(w, "Error scanning review: "+err.Error(), http.StatusInternalServerError)
-            return
-        }
-        
-        response := ReviewResponse{
-            ID:             rev.ID,
-            UserId:         rev.UserId,
-            UserName:       nullStringValue(userName, "Anonymous User"),
-            CoffeeId:       rev.CoffeeId,
-            CoffeeName:     nullStringValue(coffeeName, ""),
-            RoasteryId:     rev.RoasteryId,
-            RoasteryName:   nullStringValue(roasteryName, ""),
-            CoffeeShopId:   rev.CoffeeShopId,
-            CoffeeShopName: nullStringValue(shopName, ""),
-            Rating:         rev.Rating,
-            Review:         rev.Review,
-            DateOfCreation: rev.DateOfCreation,
-            TargetType:     getTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId),
-            TargetName:     getTargetName(coffeeName, roasteryName, shopName),
-        }
-        
-        reviewResponses = append(reviewResponses, response)
+    page, err := listUnlessPaged(q, opts, func(opts store.ListOptions) (store.Page[models.ReviewResponse], error) {
+        return h.reviews.List(r.Context(), filter, opts)
+    })
+    if err != nil {
+        writeListError(w, err)
+        return
     }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(reviewResponses)
+    writeList(w, r, page, opts)
 }
 
-func GetReviewHandler(w http.ResponseWriter, r *http.Request) {
+func (h *ReviewHandler) GetReview(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     reviewID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid review ID", http.StatusBadRequest)
-        return
-    }
-    
-    var rev Review
-    var userName, coffeeName, roasteryName, shopName sql.NullString
-    
-    err = db.DB.QueryRow(`
-        SELECT r.id, r.user_id, r.coffee_id, r.roastery_id, r.coffee_shop_id, r.rating, r.review, r.date_of_creation,
-               u.username AS user_name,
-               c.name AS coffee_name,
-               ro.name AS roastery_name,
-               s.name AS shop_name
-        FROM reviews r
-        LEFT JOIN users u ON r.user_id = u.id
-        LEFT JOIN coffees c ON r.coffee_id = c.id
-        LEFT JOIN roasteries ro ON r.roastery_id = ro.id
-        LEFT JOIN shops s ON r.coffee_shop_id = s.id
-        WHERE r.id = $1`, reviewID).
-        Scan(&rev.ID, &rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId, 
-             &rev.Rating, &rev.Review, &rev.DateOfCreation,
-             &userName, &coffeeName, &roasteryName, &shopName)
-             
-    if err == sql.ErrNoRows {
-        http.Error(w, "Review not found", http.StatusNotFound)
-        return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+        badRequest(w, "Invalid review ID")
         return
     }
-    
-    response := ReviewResponse{
-        ID:             rev.ID,
-        UserId:         rev.UserId,
-        UserName:       nullStringValue(userName, "Anonymous User"),
-        CoffeeId:       rev.CoffeeId,
-        CoffeeName:     nullStringValue(coffeeName, ""),
-        RoasteryId:     rev.RoasteryId,
-        RoasteryName:   nullStringValue(roasteryName, ""),
-        CoffeeShopId:   rev.CoffeeShopId,
-        CoffeeShopName: nullStringValue(shopName, ""),
-        Rating:         rev.Rating,
-        Review:         rev.Review,
-        DateOfCreation: rev.DateOfCreation,
-        TargetType:     getTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId),
-        TargetName:     getTargetName(coffeeName, roasteryName, shopName),
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
-}
 
-func CreateReviewHandler(w http.ResponseWriter, r *http.Request) {
-    var rev Review
-    if err := json.NewDecoder(r.Body).Decode(&rev); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+    response, err := h.reviews.Get(r.Context(), reviewID)
+    if err != nil {
+        writeStoreError(w, err, "Review not found", "Database error")
         return
     }
 
-    userIDStr := r.Header.Get("X-User-ID")
-    if userIDStr == "" {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
-    userID, err := strconv.Atoi(userIDStr)
+    writeResource(w, r, response)
+}
+
+func (h *ReviewHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+    var rev models.Review
+    errs, err := decodeJSON(r, &rev)
     if err != nil {
-        http.Error(w, "Invalid user ID", http.StatusUnauthorized)
+        problem.WriteError(w, err)
         return
     }
-    rev.UserId = userID
 
-    if !allowedRating(rev.Rating) {
-        http.Error(w, "Rating must be an integer between 1 and 5", http.StatusBadRequest)
+    p := auth.PrincipalFrom(r.Context())
+    if !p.Authenticated() {
+        problem.Error(w, http.StatusUnauthorized, problem.Unauthorized, "Unauthorized")
         return
     }
-
-    targetCount := 0
-    if rev.CoffeeId != 0 {
-        targetCount++
-    }
-    if rev.RoasteryId != 0 {
-        targetCount++
-    }
-    if rev.CoffeeShopId != 0 {
-        targetCount++
+    rev.UserId = p.UserID
+    if h.requireVerified {
+        user, err := h.users.Get(r.Context(), p.UserID)
+        if err != nil {
+            writeStoreError(w, err, "User not found", "Database error")
+            return
+        }
+        if !user.EmailVerified {
+            problem.Error(w, http.StatusForbidden, problem.EmailNotVerified, "Verify your email address before writing reviews")
+            return
+        }
     }
-    if targetCount != 1 {
-        http.Error(w, "Review must target exactly one of: coffee, roastery, or coffee shop", http.StatusBadRequest)
+
+    if !valid(w, &rev, errs) {
         return
     }
 
     rev.DateOfCreation = time.Now()
-    err = db.DB.QueryRow(`
-        INSERT INTO reviews (user_id, coffee_id, roastery_id, coffee_shop_id, rating, review, date_of_creation)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
-        RETURNING id`,
-        rev.UserId, rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId, rev.Rating, rev.Review, rev.DateOfCreation).Scan(&rev.ID)
-    if err != nil {
-        http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
+    if err := h.reviews.Create(r.Context(), &rev); err != nil {
+        writeStoreError(w, err, "Review not found", "Database insert error")
         return
     }
 
-    updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
-
-    var userName, coffeeName, roasteryName, shopName sql.NullString
-    
-    err = db.DB.QueryRow(`
-        SELECT r.id, r.user_id, r.coffee_id, r.roastery_id, r.coffee_shop_id, r.rating, r.review, r.date_of_creation,
-               u.username AS user_name,
-               c.name AS coffee_name,
-               ro.name AS roastery_name,
-               s.name AS shop_name
-        FROM reviews r
-        LEFT JOIN users u ON r.user_id = u.id
-        LEFT JOIN coffees c ON r.coffee_id = c.id
-        LEFT JOIN roasteries ro ON r.roastery_id = ro.id
-        LEFT JOIN shops s ON r.coffee_shop_id = s.id
-        WHERE r.id = $1`, rev.ID).
-        Scan(&rev.ID, &rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId, 
-             &rev.Rating, &rev.Review, &rev.DateOfCreation,
-             &userName, &coffeeName, &roasteryName, &shopName)
-             
+    response, err := h.reviews.Get(r.Context(), rev.ID)
     if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Review not found", "Database error")
         return
     }
-    
-    response := ReviewResponse{
-        ID:             rev.ID,
-        UserId:         rev.UserId,
-        UserName:       nullStringValue(userName, "Anonymous User"),
-        CoffeeId:       rev.CoffeeId,
-        CoffeeName:     nullStringValue(coffeeName, ""),
-        RoasteryId:     rev.RoasteryId,
-        RoasteryName:   nullStringValue(roasteryName, ""),
-        CoffeeShopId:   rev.CoffeeShopId,
-        CoffeeShopName: nullStringValue(shopName, ""),
-        Rating:         rev.Rating,
-        Review:         rev.Review,
-        DateOfCreation: rev.DateOfCreation,
-        TargetType:     getTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId),
-        TargetName:     getTargetName(coffeeName, roasteryName, shopName),
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+
+    writeResource(w, r, response)
 }
 
-func UpdateReviewHandler(w http.ResponseWriter, r *http.Request) {
+func (h *ReviewHandler) UpdateReview(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     reviewID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid review ID", http.StatusBadRequest)
+        badRequest(w, "Invalid review ID")
         return
     }
 
-    var orig Review
-    err = db.DB.QueryRow(`
-        SELECT id, user_id, coffee_id, roastery_id, coffee_shop_id, rating, review, date_of_creation 
-        FROM reviews WHERE id = $1`, reviewID).
-        Scan(&orig.ID, &orig.UserId, &orig.CoffeeId, &orig.RoasteryId, &orig.CoffeeShopId, &orig.Rating, &orig.Review, &orig.DateOfCreation)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Review not found", http.StatusNotFound)
-        return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    userIDStr := r.Header.Get("X-User-ID")
-    userRoleStr := r.Header.Get("X-User-Role")
-    reqUserID, err := strconv.Atoi(userIDStr)
-    if err != nil || (reqUserID != orig.UserId && userRoleStr != "admin") {
-        http.Error(w, "You can only update your own reviews", http.StatusForbidden)
+    orig, err := h.reviews.Get(r.Context(), reviewID)
+    if err != nil {
+        writeStoreError(w, err, "Review not found", "Database error")
         return
     }
 
-    var rev Review
-    if err := json.NewDecoder(r.Body).Decode(&rev); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+    if !auth.Can(auth.PrincipalFrom(r.Context()), auth.Update, auth.Resource{Kind: auth.Reviews, OwnerID: orig.UserId}) {
+        problem.Error(w, http.StatusForbidden, problem.Forbidden, "You can only update your own reviews")
         return
     }
-    if !allowedRating(rev.Rating) {
-        http.Error(w, "Rating must be an integer between 1 and 5", http.StatusBadRequest)
+    version, ok := checkIfMatch(w, r, orig, orig.Version)
+    if !ok {
         return
     }
 
-    rev.UserId = orig.UserId
-    rev.CoffeeId = orig.CoffeeId
-    rev.RoasteryId = orig.RoasteryId
-    rev.CoffeeShopId = orig.CoffeeShopId
-    rev.DateOfCreation = orig.DateOfCreation
-
-    result, err := db.DB.Exec(`
-        UPDATE reviews SET rating = $1, review = $2 
-        WHERE id = $3`, rev.Rating, rev.Review, reviewID)
+    var rev models.Review
+    errs, err := decodeJSON(r, &rev)
     if err != nil {
-        http.Error(w, "Database update error: "+err.Error(), http.StatusInternalServerError)
+        problem.WriteError(w, err)
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Review not found", http.StatusNotFound)
-        return
-    }
-    
-    updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
-    
-    var userName, coffeeName, roasteryName, shopName sql.NullString
-    
-    err = db.DB.QueryRow(`
-        SELECT r.id, r.user_id, r.coffee_id, r.roastery_id, r.coffee_shop_id, r.rating, r.review, r.date_of_creation,
-               u.username AS user_name,
-               c.name AS coffee_name,
-               ro.name AS roastery_name,
-               s.name AS shop_name
-        FROM reviews r
-        LEFT JOIN users u ON r.user_id = u.id
-        LEFT JOIN coffees c ON r.coffee_id = c.id
-        LEFT JOIN roasteries ro ON r.roastery_id = ro.id
-        LEFT JOIN shops s ON r.coffee_shop_id = s.id
-        WHERE r.id = $1`, reviewID).
-        Scan(&rev.ID, &rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId, 
-             &rev.Rating, &rev.Review, &rev.DateOfCreation,
-             &userName, &coffeeName, &roasteryName, &shopName)
-             
-    if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
-        return
-    }
-    
-    response := ReviewResponse{
-        ID:             rev.ID,
-        UserId:         rev.UserId,
-        UserName:       nullStringValue(userName, "Anonymous User"),
-        CoffeeId:       rev.CoffeeId,
-        CoffeeName:     nullStringValue(coffeeName, ""),
-        RoasteryId:     rev.RoasteryId,
-        RoasteryName:   nullStringValue(roasteryName, ""),
-        CoffeeShopId:   rev.CoffeeShopId,
-        CoffeeShopName: nullStringValue(shopName, ""),
-        Rating:         rev.Rating,
-        Review:         rev.Review,
-        DateOfCreation: rev.DateOfCreation,
-        TargetType:     getTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId),
-        TargetName:     getTargetName(coffeeName, roasteryName, shopName),
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    // The target of a review cannot change.
+    rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId = orig.CoffeeId, orig.RoasteryId, orig.CoffeeShopId
+    rev.ID, rev.Version = reviewID, version
+    h.save(w, r, &rev, nil, errs)
 }
 
-func DeleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+// PatchReview applies a merge patch or JSON patch to the rating and text
+// of a review.
+func (h *ReviewHandler) PatchReview(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     reviewID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid review ID", http.StatusBadRequest)
+        badRequest(w, "Invalid review ID")
         return
     }
 
-    var orig Review
-    err = db.DB.QueryRow(`
-        SELECT id, user_id, coffee_id, roastery_id, coffee_shop_id FROM reviews WHERE id = $1`, reviewID).
-        Scan(&orig.ID, &orig.UserId, &orig.CoffeeId, &orig.RoasteryId, &orig.CoffeeShopId)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Review not found", http.StatusNotFound)
-        return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+    orig, err := h.reviews.Get(r.Context(), reviewID)
+    if err != nil {
+        writeStoreError(w, err, "Review not found", "Database error")
         return
     }
 
-    userIDStr := r.Header.Get("X-User-ID")
-    userRoleStr := r.Header.Get("X-User-Role")
-    reqUserID, err := strconv.Atoi(userIDStr)
-    
-    if err != nil || (reqUserID != orig.UserId && userRoleStr != "admin") {
-        http.Error(w, "You can only delete your own reviews", http.StatusForbidden)
+    if !auth.Can(auth.PrincipalFrom(r.Context()), auth.Update, auth.Resource{Kind: auth.Reviews, OwnerID: orig.UserId}) {
+        problem.Error(w, http.StatusForbidden, problem.Forbidden, "You can only update your own reviews")
         return
     }
-
-    result, err := db.DB.Exec(`DELETE FROM reviews WHERE id = $1`, reviewID)
-    if err != nil {
-        http.Error(w, "Database delete error: "+err.Error(), http.StatusInternalServerError)
+    version, ok := checkIfMatch(w, r, orig, orig.Version)
+    if !ok {
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Review not found", http.StatusNotFound)
+
+    var patched models.ReviewResponse
+    fields, err := applyPatch(r, orig, &patched, reviewWritable)
+    if err != nil {
+        writePatchError(w, err)
         return
     }
-    
-    updateAverageRating(orig.CoffeeId, orig.RoasteryId, orig.CoffeeShopId)
-    
-    w.WriteHeader(http.StatusNoContent)
+    h.save(w, r, &models.Review{
+        ID:           reviewID,
+        CoffeeId:     orig.CoffeeId,
+        RoasteryId:   orig.RoasteryId,
+        CoffeeShopId: orig.CoffeeShopId,
+        Rating:       patched.Rating,
+        Review:       patched.Review,
+        Version:      version,
+    }, fields.changed, nil)
 }
 
-func updateAverageRating(coffeeId, roasteryId, coffeeShopId int) {
-    if coffeeId != 0 {
-        _, err := db.DB.Exec(`
-            UPDATE coffees SET avg_rating = 
-            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE coffee_id = $1)
-            WHERE id = $1`, coffeeId)
-        if err != nil {
-            fmt.Printf("Error updating coffee rating: %v\n", err)
-        }
-    }
-    
-    if roasteryId != 0 {
-        _, err := db.DB.Exec(`
-            UPDATE roasteries SET avg_rating = 
-            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE roastery_id = $1)
-            WHERE id = $1`, roasteryId)
-        if err != nil {
-            fmt.Printf("Error updating roastery rating: %v\n", err)
-        }
+// save validates and stores the rating and text of an updated review,
+// reporting errs, the fields found invalid while decoding it, with the rest.
+// When changed is not nil only the fields in it are validated.
+func (h *ReviewHandler) save(w http.ResponseWriter, r *http.Request, rev *models.Review, changed map[string]bool, errs []problem.FieldError) {
+    if !validChanged(w, rev, changed, errs) {
+        return
     }
-    
-    if coffeeShopId != 0 {
-        _, err := db.DB.Exec(`
-            UPDATE shops SET avg_rating = 
-            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE coffee_shop_id = $1)
-            WHERE id = $1`, coffeeShopId)
-        if err != nil {
-            fmt.Printf("Error updating coffee shop rating: %v\n", err)
-        }
+
+    if err := h.reviews.Update(r.Context(), rev); err != nil {
+        writeStoreError(w, err, "Review not found", "Database update error")
+        return
     }
-}
 
-func nullStringValue(ns sql.NullString, defaultValue string) string {
-    if ns.Valid {
-        return ns.String
+    response, err := h.reviews.Get(r.Context(), rev.ID)
+    if err != nil {
+        writeStoreError(w, err, "Review not found", "Database error")
+        return
     }
-    return defaultValue
+
+    writeResource(w, r, response)
 }
 
-func getTargetType(coffeeId, roasteryId, coffeeShopId int) string {
-    if coffeeId != 0 {
-        return "coffee"
-    }
-    if roasteryId != 0 {
-        return "roastery"
+func (h *ReviewHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    reviewID, err := strconv.Atoi(params["id"])
+    if err != nil {
+        badRequest(w, "Invalid review ID")
+        return
     }
-    if coffeeShopId != 0 {
-        return "coffee_shop"
+
+    orig, err := h.reviews.Get(r.Context(), reviewID)
+    if err != nil {
+        writeStoreError(w, err, "Review not found", "Database error")
+        return
     }
-    return "unknown"
-}
 
-func getTargetName(coffeeName, roasteryName, shopName sql.NullString) string {
-    if coffeeName.Valid {
-        return coffeeName.String
+    if !auth.Can(auth.PrincipalFrom(r.Context()), auth.Delete, auth.Resource{Kind: auth.Reviews, OwnerID: orig.UserId}) {
+        problem.Error(w, http.StatusForbidden, problem.Forbidden, "You can only delete your own reviews")
+        return
     }
-    if roasteryName.Valid {
-        return roasteryName.String
+    version, ok := checkIfMatch(w, r, orig, orig.Version)
+    if !ok {
+        return
     }
-    if shopName.Valid {
-        return shopName.String
+
+    if err := h.reviews.Delete(r.Context(), reviewID, version); err != nil {
+        writeStoreError(w, err, "Review not found", "Database delete error")
+        return
     }
-    return "Unknown"
-}
\ No newline at end of file
+
+    w.WriteHeader(http.StatusNoContent)
+}
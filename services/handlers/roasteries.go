@@ -1,243 +1,267 @@
 package handlers
 
 import (
-    "database/sql"
-    "encoding/json"
-    "fmt"
     "net/http"
+    "net/url"
     "strconv"
-    "strings"
 
-    "coffeeApi/services/db"
-    "coffeeApi/services/geocoding"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+
     "github.com/gorilla/mux"
 )
 
-type Roastery struct {
-    ID          int     `json:"id"`
-    Name        string  `json:"name"`
-    Country     string  `json:"country"`
-    City        string  `json:"city"`
-    Address     string  `json:"address"`
-    Website     string  `json:"website"`
-    Description string  `json:"description"`
-    AvgRating   float32 `json:"avgRating"`
-    Lat         float64 `json:"lat"`
-    Lon         float64 `json:"lon"`
+type RoasteryHandler struct {
+    roasteries store.RoasteryStore
+    // wake tells the geocoding worker that a pending row was saved.
+    wake func()
 }
 
-func GetRoasteriesHandler(w http.ResponseWriter, r *http.Request) {
-    query := r.URL.Query()
-    name := query.Get("name")
-    country := query.Get("country")
-    city := query.Get("city")
-    address := query.Get("address")
-    website := query.Get("website")
-    description := query.Get("description")
-    minRating := query.Get("minRating")
-    maxRating := query.Get("maxRating")
-
-    baseQuery := `SELECT id, name, country, city, address, website, description, avg_rating, lat, lon FROM roasteries`
-    conditions := []string{}
-    args := []interface{}{}
-    argIdx := 1
-
-    if name != "" {
-        conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", argIdx))
-        args = append(args, "%"+name+"%")
-        argIdx++
-    }
-    if country != "" {
-        conditions = append(conditions, fmt.Sprintf("country ILIKE $%d", argIdx))
-        args = append(args, "%"+country+"%")
-        argIdx++
-    }
-    if city != "" {
-        conditions = append(conditions, fmt.Sprintf("city ILIKE $%d", argIdx))
-        args = append(args, "%"+city+"%")
-        argIdx++
-    }
-    if address != "" {
-        conditions = append(conditions, fmt.Sprintf("address ILIKE $%d", argIdx))
-        args = append(args, "%"+address+"%")
-        argIdx++
-    }
-    if website != "" {
-        conditions = append(conditions, fmt.Sprintf("website ILIKE $%d", argIdx))
-        args = append(args, "%"+website+"%")
-        argIdx++
-    }
-    if description != "" {
-        conditions = append(conditions, fmt.Sprintf("description ILIKE $%d", argIdx))
-        args = append(args, "%"+description+"%")
-        argIdx++
-    }
-    if minRating != "" {
-        if rating, err := strconv.ParseFloat(minRating, 32); err == nil {
-            conditions = append(conditions, fmt.Sprintf("avg_rating >= $%d", argIdx))
-            args = append(args, rating)
-            argIdx++
-        }
-    }
-    if maxRating != "" {
-        if rating, err := strconv.ParseFloat(maxRating, 32); err == nil {
-            conditions = append(conditions, fmt.Sprintf("avg_rating <= $%d", argIdx))
-            args = append(args, rating)
-            argIdx++
-        }
-    }
-
-    if len(conditions) > 0 {
-        baseQuery += " WHERE " + strings.Join(conditions, " AND ")
-    }
-
-    rows, err := db.DB.Query(baseQuery, args...)
-    if err != nil {
-        http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var roasteries []Roastery
-    for rows.Next() {
-        var rastery Roastery
-        err := rows.Scan(&rastery.ID, &rastery.Name, &rastery.Country, &rastery.City, &rastery.Address, &rastery.Website, &rastery.Description, &rastery.AvgRating, &rastery.Lat, &rastery.Lon)
-        if err != nil {
-            http.Error(w, "Error scanning roastery: "+err.Error(), http.StatusInternalServerError)
-            return
-        }
-        roasteries = append(roasteries, rastery)
-    }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(roasteries)
+func NewRoasteryHandler(roasteries store.RoasteryStore, wake func()) *RoasteryHandler {
+    return &RoasteryHandler{roasteries: roasteries, wake: wake}
 }
 
-func GetRoasteryHandler(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    roasteryID, err := strconv.Atoi(params["id"])
+func roasteryLocation(r *models.Roastery) location {
+    return location{Address: &r.Address, City: &r.City, Country: &r.Country, Lat: &r.Lat, Lon: &r.Lon, Status: &r.GeocodeStatus, AddressPending: &r.AddressPending}
+}
+
+func roasteryFilter(query url.Values) (store.RoasteryFilter, error) {
+    filter := store.RoasteryFilter{
+        Name:        query.Get("name"),
+        Country:     query.Get("country"),
+        City:        query.Get("city"),
+        Address:     query.Get("address"),
+        Website:     query.Get("website"),
+        Description: query.Get("description"),
+    }
+    if rating, err := strconv.ParseFloat(query.Get("minRating"), 32); err == nil {
+        filter.MinRating = &rating
+    }
+    if rating, err := strconv.ParseFloat(query.Get("maxRating"), 32); err == nil {
+        filter.MaxRating = &rating
+    }
+
+    status, err := parseGeocodeStatus(query)
     if err != nil {
-        http.Error(w, "Invalid roastery ID", http.StatusBadRequest)
+        return filter, err
+    }
+    filter.GeocodeStatus = status
+
+    geo, err := parseGeoFilter(query)
+    filter.GeoFilter = geo
+    return filter, err
+}
+
+func (h *RoasteryHandler) GetRoasteries(w http.ResponseWriter, r *http.Request) {
+    w.Header().Add("Vary", "Accept")
+    if wantsGeoJSON(r) {
+        h.GetRoasteriesGeoJSON(w, r)
         return
     }
 
-    var rastery Roastery
-    err = db.DB.QueryRow(`
-        SELECT id, name, country, city, address, website, description, avg_rating, lat, lon
-        FROM roasteries WHERE id = $1`, roasteryID).
-        Scan(&rastery.ID, &rastery.Name, &rastery.Country, &rastery.City, &rastery.Address, &rastery.Website, &rastery.Description, &rastery.AvgRating, &rastery.Lat, &rastery.Lon)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Roastery not found", http.StatusNotFound)
+    query := r.URL.Query()
+    filter, err := roasteryFilter(query)
+    if err != nil {
+        badRequest(w, err.Error())
         return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+    }
+    opts, err := parseListOptions(query)
+    if err != nil {
+        badRequest(w, err.Error())
         return
     }
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(rastery)
+    page, err := listUnlessPaged(query, opts, func(opts store.ListOptions) (store.Page[models.Roastery], error) {
+        return h.roasteries.List(r.Context(), filter, opts)
+    })
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+    writeList(w, r, page, opts)
 }
 
-func CreateRoasteryHandler(w http.ResponseWriter, r *http.Request) {
-    var rastery Roastery
-    if err := json.NewDecoder(r.Body).Decode(&rastery); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+// GetRoasteriesGeoJSON returns the roasteries matching the list filters as
+// a FeatureCollection.
+func (h *RoasteryHandler) GetRoasteriesGeoJSON(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    filter, err := roasteryFilter(query)
+    if err != nil {
+        badRequest(w, err.Error())
         return
     }
-    if rastery.Name == "" || rastery.Country == "" || rastery.City == "" || rastery.Address == "" {
-        http.Error(w, "Missing required fields", http.StatusBadRequest)
+    opts, err := parseListOptions(query)
+    if err != nil {
+        badRequest(w, err.Error())
         return
     }
+    page, err := listUnlessPaged(query, opts, func(opts store.ListOptions) (store.Page[models.Roastery], error) {
+        return h.roasteries.List(r.Context(), filter, opts)
+    })
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+
+    features := make([]geoJSONFeature, len(page.Items))
+    for i, rs := range page.Items {
+        features[i] = newFeature(rs.ID, rs.Lat, rs.Lon, geoJSONProperties{
+            Name: rs.Name, City: rs.City, AvgRating: rs.AvgRating, Website: rs.Website, DistanceKm: rs.DistanceKm,
+        })
+    }
+    writeFeatureCollection(w, r, page, opts, features)
+}
 
-    fullAddress := fmt.Sprintf("%s, %s, %s", rastery.Address, rastery.City, rastery.Country)
-    lat, lon, err := geocoding.GetCoordinates(fullAddress)
+func (h *RoasteryHandler) GetRoastery(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    roasteryID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Geocoding error: "+err.Error(), http.StatusInternalServerError)
+        badRequest(w, "Invalid roastery ID")
         return
     }
-    rastery.Lat = lat
-    rastery.Lon = lon
 
-    err = db.DB.QueryRow(`
-        INSERT INTO roasteries (name, country, city, address, website, description, avg_rating, lat, lon)
-        VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8) RETURNING id`,
-        rastery.Name, rastery.Country, rastery.City, rastery.Address, rastery.Website, rastery.Description, rastery.Lat, rastery.Lon).
-        Scan(&rastery.ID)
+    rastery, err := h.roasteries.Get(r.Context(), roasteryID)
     if err != nil {
-        http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Roastery not found", "Database error")
         return
     }
-    rastery.AvgRating = 0
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(rastery)
+    writeResource(w, r, rastery)
 }
 
-func UpdateRoasteryHandler(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    roasteryID, err := strconv.Atoi(params["id"])
+func (h *RoasteryHandler) CreateRoastery(w http.ResponseWriter, r *http.Request) {
+    var rastery models.Roastery
+    pinned, errs, err := decodeLocated(r, &rastery)
     if err != nil {
-        http.Error(w, "Invalid roastery ID", http.StatusBadRequest)
+        problem.WriteError(w, err)
         return
     }
-    var rastery Roastery
-    if err := json.NewDecoder(r.Body).Decode(&rastery); err != nil {
-        http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+    if !valid(w, &rastery, append(errs, addressFields(roasteryLocation(&rastery), !pinned)...)) {
         return
     }
 
-    fullAddress := fmt.Sprintf("%s, %s, %s", rastery.Address, rastery.City, rastery.Country)
-    lat, lon, err := geocoding.GetCoordinates(fullAddress)
+    locate(roasteryLocation(&rastery), pinned, nil)
+
+    if err := h.roasteries.Create(r.Context(), &rastery); err != nil {
+        writeStoreError(w, err, "Roastery not found", "Database insert error")
+        return
+    }
+    if roasteryLocation(&rastery).waiting() {
+        h.wake()
+    }
+    writeResource(w, r, rastery)
+}
+
+func (h *RoasteryHandler) UpdateRoastery(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    roasteryID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Geocoding error: "+err.Error(), http.StatusInternalServerError)
+        badRequest(w, "Invalid roastery ID")
         return
     }
-    rastery.Lat = lat
-    rastery.Lon = lon
 
-    result, err := db.DB.Exec(`
-        UPDATE roasteries SET name=$1, country=$2, city=$3, address=$4, website=$5, description=$6, lat=$7, lon=$8
-        WHERE id=$9`,
-        rastery.Name, rastery.Country, rastery.City, rastery.Address, rastery.Website, rastery.Description, rastery.Lat, rastery.Lon, roasteryID)
+    prev, err := h.roasteries.Get(r.Context(), roasteryID)
     if err != nil {
-        http.Error(w, "Database update error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Roastery not found", "Database error")
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Roastery not found", http.StatusNotFound)
+
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
+        return
+    }
+
+    var rastery models.Roastery
+    pinned, errs, err := decodeLocated(r, &rastery)
+    if err != nil {
+        problem.WriteError(w, err)
         return
     }
-    rastery.ID = roasteryID
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(rastery)
+    rastery.ID, rastery.Version = roasteryID, version
+    h.save(w, r, &rastery, prev, pinned, true, nil, errs)
 }
 
-func DeleteRoasteryHandler(w http.ResponseWriter, r *http.Request) {
+// PatchRoastery applies a merge patch or JSON patch to the roastery. Its address is
+// geocoded again only when address, city or country change.
+func (h *RoasteryHandler) PatchRoastery(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     roasteryID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid roastery ID", http.StatusBadRequest)
+        badRequest(w, "Invalid roastery ID")
         return
     }
 
-    var coffeeCount int
-    err = db.DB.QueryRow("SELECT COUNT(*) FROM coffees WHERE roastery_id = $1", roasteryID).Scan(&coffeeCount)
+    prev, err := h.roasteries.Get(r.Context(), roasteryID)
     if err != nil {
-        http.Error(w, "Database query error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Roastery not found", "Database error")
+        return
+    }
+
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
+        return
+    }
+
+    var rastery models.Roastery
+    fields, err := applyPatch(r, prev, &rastery, locatedWritable)
+    if err != nil {
+        writePatchError(w, err)
+        return
+    }
+    var errs []problem.FieldError
+    pinned := fields.present["lat"] || fields.present["lon"]
+    // A pin on a roastery that has no coordinates yet needs both of them.
+    if pinned && prev.GeocodeStatus != store.GeocodeResolved && fields.present["lat"] != fields.present["lon"] {
+        errs = append(errs, missingCoordinate(fields.present["lat"]))
+    }
+    moved := pinned || fields.changed["address"] || fields.changed["city"] || fields.changed["country"]
+    rastery.ID, rastery.Version = roasteryID, version
+    h.save(w, r, &rastery, prev, pinned, moved, fields.changed, errs)
+}
+
+// save validates and stores an updated roastery, reporting errs, the fields
+// found invalid while decoding it, with the rest. When changed is not nil
+// only the fields in it are validated. Unless moved, its coordinates and
+// geocoding status are kept as they are.
+func (h *RoasteryHandler) save(w http.ResponseWriter, r *http.Request, rastery *models.Roastery, prev models.Roastery, pinned, moved bool, changed map[string]bool, errs []problem.FieldError) {
+    if !validChanged(w, rastery, changed, append(errs, addressFields(roasteryLocation(rastery), moved && !pinned)...)) {
+        return
+    }
+
+    if moved {
+        prevLocation := roasteryLocation(&prev)
+        locate(roasteryLocation(rastery), pinned, &prevLocation)
+    }
+
+    if err := h.roasteries.Update(r.Context(), rastery); err != nil {
+        writeStoreError(w, err, "Roastery not found", "Database update error")
         return
     }
-    if coffeeCount > 0 {
-        http.Error(w, "Cannot delete roastery that has associated coffees", http.StatusBadRequest)
+    if roasteryLocation(rastery).waiting() {
+        h.wake()
+    }
+    writeResource(w, r, rastery)
+}
+
+func (h *RoasteryHandler) DeleteRoastery(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    roasteryID, err := strconv.Atoi(params["id"])
+    if err != nil {
+        badRequest(w, "Invalid roastery ID")
         return
     }
 
-    result, err := db.DB.Exec(`DELETE FROM roasteries WHERE id = $1`, roasteryID)
+    prev, err := h.roasteries.Get(r.Context(), roasteryID)
     if err != nil {
-        http.Error(w, "Database delete error: "+err.Error(), http.StatusInternalServerError)
+        writeStoreError(w, err, "Roastery not found", "Database error")
+        return
+    }
+    version, ok := checkIfMatch(w, r, prev, prev.Version)
+    if !ok {
         return
     }
-    rowsAffected, err := result.RowsAffected()
-    if err != nil || rowsAffected == 0 {
-        http.Error(w, "Roastery not found", http.StatusNotFound)
+    if err := h.roasteries.Delete(r.Context(), roasteryID, version); err != nil {
+        writeStoreError(w, err, "Roastery not found", "Database delete error")
         return
     }
     w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
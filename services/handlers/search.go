@@ -0,0 +1,47 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+
+    "coffeeApi/services/store"
+)
+
+const defaultSearchLimit = 20
+
+type SearchHandler struct {
+    search store.SearchStore
+}
+
+func NewSearchHandler(search store.SearchStore) *SearchHandler {
+    return &SearchHandler{search: search}
+}
+
+// Search answers GET /search?q=...&lang=simple|polish|english&types=coffee,roastery,shop
+// with the matching coffees, roasteries and shops, best match first.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    query := store.SearchQuery{Text: strings.TrimSpace(q.Get("q")), Config: q.Get("lang")}
+    if query.Text == "" {
+        badRequest(w, "Missing search query")
+        return
+    }
+    if types := q.Get("types"); types != "" {
+        query.Types = strings.Split(types, ",")
+    }
+
+    opts, err := parseListOptions(q)
+    if err != nil {
+        badRequest(w, err.Error())
+        return
+    }
+    if q.Get("limit") == "" {
+        opts.Limit = defaultSearchLimit
+    }
+    page, err := h.search.Search(r.Context(), query, opts)
+    if err != nil {
+        writeListError(w, err)
+        return
+    }
+    writeList(w, r, page, opts)
+}
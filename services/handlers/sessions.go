@@ -0,0 +1,119 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+)
+
+type tokenResponse struct {
+    Token        string `json:"token"`
+    RefreshToken string `json:"refreshToken"`
+    ExpiresIn    int    `json:"expiresIn"`
+}
+
+func writeTokens(w http.ResponseWriter, user models.User, sessionID, refreshToken string) {
+    token, err := auth.NewAccessToken(user.ID, user.Role, sessionID)
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("generating token: %w", err))
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(tokenResponse{
+        Token:        token,
+        RefreshToken: refreshToken,
+        ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+    })
+}
+
+// startSession opens a new session for a user who just logged in and
+// answers with its first access and refresh tokens.
+func (h *UserHandler) startSession(w http.ResponseWriter, r *http.Request, user models.User) {
+    sessionID, err := auth.NewSessionID()
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("generating token: %w", err))
+        return
+    }
+    refreshToken, hash, err := auth.NewRefreshToken()
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("generating token: %w", err))
+        return
+    }
+    err = h.sessions.Start(r.Context(), store.RefreshToken{
+        Hash:      hash,
+        SessionID: sessionID,
+        UserID:    user.ID,
+        ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+    })
+    if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    writeTokens(w, user, sessionID, refreshToken)
+}
+
+type refreshRequest struct {
+    RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Every refresh token works once; presenting one again
+// revokes the whole session.
+func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+    var body refreshRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+    refreshToken, hash, err := auth.NewRefreshToken()
+    if err != nil {
+        problem.Internal(w, fmt.Errorf("generating token: %w", err))
+        return
+    }
+    t, err := h.sessions.Rotate(r.Context(), auth.HashRefreshToken(body.RefreshToken), hash, time.Now().Add(auth.RefreshTokenTTL))
+    if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrTokenReused) {
+        problem.Error(w, http.StatusUnauthorized, problem.InvalidToken, "Invalid refresh token")
+        return
+    } else if err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    // The role is read again, so refreshed tokens reflect role changes.
+    user, err := h.users.Get(r.Context(), t.UserID)
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database error")
+        return
+    }
+    writeTokens(w, user, t.SessionID, refreshToken)
+}
+
+// Logout revokes the session of the access token used for the request.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+    err := h.sessions.Revoke(r.Context(), auth.PrincipalFrom(r.Context()).SessionID)
+    if err != nil && !errors.Is(err, store.ErrNotFound) {
+        problem.Internal(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll revokes every session of the user, on all devices.
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+    if err := h.sessions.RevokeUser(r.Context(), auth.PrincipalFrom(r.Context()).UserID); err != nil {
+        problem.Internal(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
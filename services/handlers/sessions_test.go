@@ -0,0 +1,130 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/mailer"
+    "coffeeApi/services/middleware"
+    "coffeeApi/services/models"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// newAccountRouter serves login, token refresh and logout on in-memory
+// stores, signing tokens with a fresh key. Tests add the other routes they
+// need behind the returned authenticator.
+func newAccountRouter(t *testing.T) (*mux.Router, store.Stores, *middleware.Authenticator) {
+    t.Helper()
+    keys := t.TempDir()
+    if _, err := auth.GenerateKey(keys, auth.AlgEdDSA, time.Now().Add(-time.Minute)); err != nil {
+        t.Fatal(err)
+    }
+    manager := &auth.KeyManager{Dir: keys, Alg: auth.AlgEdDSA}
+    if err := manager.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    auth.UseKeys(manager)
+
+    stores := store.NewMemoryStores()
+    users := NewUserHandler(stores.Users, stores.Sessions, stores.APIKeys, stores.Logins, mailer.Log{}, "http://api.test")
+    authn := middleware.NewAuthenticator(stores.Sessions, stores.APIKeys)
+    router := mux.NewRouter()
+    router.HandleFunc("/login", users.Login).Methods("POST")
+    router.HandleFunc("/token/refresh", users.RefreshToken).Methods("POST")
+    router.Handle("/logout", authn.AuthMiddleware(middleware.RequireSession(http.HandlerFunc(users.Logout)))).Methods("POST")
+    return router, stores, authn
+}
+
+func addUser(t *testing.T, users store.UserStore, username, password string) models.User {
+    t.Helper()
+    hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    u := models.User{Username: username, Email: username + "@example.com", Password: string(hashed), Role: auth.RoleUser}
+    if err := users.Create(context.Background(), &u); err != nil {
+        t.Fatalf("creating user: %v", err)
+    }
+    return u
+}
+
+func login(t *testing.T, router http.Handler, username, password string) tokenResponse {
+    t.Helper()
+    rec := serve(router, "POST", "/login", "application/json", `{"username": "`+username+`", "passwords": "`+password+`"}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("login status = %d, body %s", rec.Code, rec.Body)
+    }
+    var tokens tokenResponse
+    decodeBody(t, rec, &tokens)
+    return tokens
+}
+
+// serveAs serves the request with the given Authorization header.
+func serveAs(router http.Handler, method, target, authorization, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, target, strings.NewReader(body))
+    req.Header.Set("Authorization", authorization)
+    if body != "" {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    rec := httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+    return rec
+}
+
+func refresh(t *testing.T, router http.Handler, refreshToken string) (int, tokenResponse) {
+    t.Helper()
+    rec := serve(router, "POST", "/token/refresh", "application/json", `{"refreshToken": "`+refreshToken+`"}`)
+    var tokens tokenResponse
+    if rec.Code == http.StatusOK {
+        decodeBody(t, rec, &tokens)
+    }
+    return rec.Code, tokens
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+    tests := []struct {
+        name string
+        // replay presents these tokens, oldest first, after one rotation:
+        // "first" is the token from login, "second" the one refreshing it
+        // returned.
+        replay []string
+        status []int
+        // sessionAlive is whether the access token of the session still
+        // works afterwards.
+        sessionAlive bool
+    }{
+        {"rotated token works once", []string{"second"}, []int{http.StatusOK}, true},
+        {"reused token revokes the session", []string{"first", "second"}, []int{http.StatusUnauthorized, http.StatusUnauthorized}, false},
+        {"unknown token", []string{"forged"}, []int{http.StatusUnauthorized}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            router, stores, _ := newAccountRouter(t)
+            addUser(t, stores.Users, "ana", "correct horse battery")
+            first := login(t, router, "ana", "correct horse battery")
+            status, second := refresh(t, router, first.RefreshToken)
+            if status != http.StatusOK {
+                t.Fatalf("first refresh status = %d", status)
+            }
+            tokens := map[string]string{"first": first.RefreshToken, "second": second.RefreshToken, "forged": "forged"}
+
+            for i, name := range tt.replay {
+                if status, _ := refresh(t, router, tokens[name]); status != tt.status[i] {
+                    t.Errorf("refreshing with the %s token: status = %d, want %d", name, status, tt.status[i])
+                }
+            }
+            alive := serveAs(router, "POST", "/logout", "Bearer "+second.Token, "").Code == http.StatusNoContent
+            if alive != tt.sessionAlive {
+                t.Errorf("session alive = %v, want %v", alive, tt.sessionAlive)
+            }
+        })
+    }
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
-	"coffeeApi/services/db"
+	"coffeeApi/services/problem"
+	"coffeeApi/services/store"
 )
 
 type Stats struct {
@@ -15,22 +17,35 @@ type Stats struct {
     Reviews    int `json:"reviews"`
 }
 
-func GetStatsHandler(w http.ResponseWriter, r *http.Request) {
+type StatsHandler struct {
+    stores store.Stores
+}
+
+func NewStatsHandler(stores store.Stores) *StatsHandler {
+    return &StatsHandler{stores: stores}
+}
+
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
     stats := Stats{}
 
-    queries := map[string]*int{
-        "SELECT COUNT(*) FROM users":      &stats.Users,
-        "SELECT COUNT(*) FROM coffees":    &stats.Coffees,
-        "SELECT COUNT(*) FROM roasteries": &stats.Roasteries,
-        "SELECT COUNT(*) FROM shops":      &stats.Shops,
-        "SELECT COUNT(*) FROM reviews":    &stats.Reviews,
+    counters := []struct {
+        count func(context.Context) (int, error)
+        dest  *int
+    }{
+        {h.stores.Users.Count, &stats.Users},
+        {h.stores.Coffees.Count, &stats.Coffees},
+        {h.stores.Roasteries.Count, &stats.Roasteries},
+        {h.stores.Shops.Count, &stats.Shops},
+        {h.stores.Reviews.Count, &stats.Reviews},
     }
 
-    for query, dest := range queries {
-        if err := db.DB.QueryRow(query).Scan(dest); err != nil {
-            http.Error(w, "Database error", http.StatusInternalServerError)
+    for _, c := range counters {
+        n, err := c.count(r.Context())
+        if err != nil {
+            problem.Internal(w, err)
             return
         }
+        *c.dest = n
     }
 
     w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
+)
+
+// writeStoreError responds to a failed store call: notFound for
+// store.ErrNotFound, 412 for store.ErrStale, 404/409/422 for integrity
+// violations and a logged 500 for anything else, with fallback saying
+// what failed.
+func writeStoreError(w http.ResponseWriter, err error, notFound, fallback string) {
+    if errors.Is(err, store.ErrNotFound) {
+        problem.Error(w, http.StatusNotFound, problem.NotFound, notFound)
+        return
+    }
+    if errors.Is(err, store.ErrStale) {
+        problem.Error(w, http.StatusPreconditionFailed, problem.PreconditionFailed, "Resource has changed since it was read, fetch it again")
+        return
+    }
+    var constraintErr *store.ConstraintError
+    if errors.As(err, &constraintErr) {
+        switch constraintErr.Kind {
+        case store.MissingReference:
+            problem.Error(w, http.StatusNotFound, problem.NotFound, constraintErr.Message)
+        case store.StillReferenced:
+            problem.Error(w, http.StatusConflict, problem.StillReferenced, constraintErr.Message)
+        case store.Duplicate:
+            problem.Error(w, http.StatusConflict, problem.Duplicate, constraintErr.Message)
+        case store.Invalid:
+            problem.Error(w, http.StatusUnprocessableEntity, problem.ConstraintViolation, constraintErr.Message)
+        default:
+            problem.Internal(w, err)
+        }
+        return
+    }
+    problem.Internal(w, fmt.Errorf("%s: %w", fallback, err))
+}
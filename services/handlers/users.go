@@ -1,147 +1,213 @@
 package handlers
 
 import (
-    "database/sql"
     "encoding/json"
+    "fmt"
+    "log"
     "net/http"
-    "time"
+    "strconv"
+    "strings"
 
-    "coffeeApi/services/db"
+    "coffeeApi/services/auth"
+    "coffeeApi/services/mailer"
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
 
-    "github.com/golang-jwt/jwt"
     "golang.org/x/crypto/bcrypt"
     "github.com/gorilla/mux"
-    "strconv"
-    "os"
-    
 )
 
-var rawKey = os.Getenv("JWT_SECRET_KEY")
-
-var jwtKey = []byte(rawKey)
+type UserHandler struct {
+    users    store.UserStore
+    sessions store.SessionStore
+    apiKeys  store.APIKeyStore
+    logins   store.LoginAttemptStore
+    mailer   mailer.Mailer
+    // publicURL is where the API is reachable from outside, used in links
+    // sent by email.
+    publicURL string
+}
 
-type User struct {
-    ID       int    `json:"id"`
-    Username string `json:"username"`
-    Password string `json:"password"`
-    Email    string `json:"email"`
-    Role     string `json:"role"`
+func NewUserHandler(users store.UserStore, sessions store.SessionStore, apiKeys store.APIKeyStore, logins store.LoginAttemptStore, mail mailer.Mailer, publicURL string) *UserHandler {
+    return &UserHandler{users: users, sessions: sessions, apiKeys: apiKeys, logins: logins, mailer: mail, publicURL: strings.TrimRight(publicURL, "/")}
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-    var user User
-    if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
+    var user models.User
+    errs, err := decodeJSON(r, &user)
+    if err != nil {
+        problem.WriteError(w, err)
         return
     }
-    if user.Username == "" || user.Password == "" || user.Email == "" {
-        http.Error(w, "Missing required fields", http.StatusBadRequest)
+    if !valid(w, &user, append(errs, validateRegistration(&user)...)) {
         return
     }
 
-
     hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
     if err != nil {
-        http.Error(w, "Error hashing password", http.StatusInternalServerError)
+        problem.Internal(w, fmt.Errorf("hashing password: %w", err))
         return
     }
     user.Password = string(hashed)
-    if user.Role == "" {
-        user.Role = "user"
-    }
+    // Admins are only made through PUT /users/{id}/role or the bootstrap
+    // command, never by the client registering itself.
+    user.Role = auth.RoleUser
+    user.EmailVerified = false
 
-    err = db.DB.QueryRow(
-        `INSERT INTO users (username, password, email, role) VALUES ($1, $2, $3, $4) RETURNING id`,
-        user.Username, user.Password, user.Email, user.Role,
-    ).Scan(&user.ID)
-    if err != nil {
-        http.Error(w, "Error inserting user: "+err.Error(), http.StatusInternalServerError)
+    if err := h.users.Create(r.Context(), &user); err != nil {
+        writeStoreError(w, err, "User not found", "Error inserting user")
         return
     }
+    h.sendVerification(user)
 
     // Nie zwracamy hasła
     user.Password = ""
     json.NewEncoder(w).Encode(user)
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-    var credentials struct {
-        Username  string `json:"username"`
-        Passwords string `json:"passwords"`
+// loginRequest is the body of POST /login. Its password field is named
+// passwords.
+type loginRequest struct {
+    Username  string `json:"username"`
+    Passwords string `json:"passwords"`
+}
+
+// dummyHash is compared against when the username is unknown, so that
+// answering takes as long as for a wrong password and does not tell which
+// usernames exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not anyone's password"), bcrypt.DefaultCost)
+
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+    var credentials loginRequest
+    errs, err := decodeJSON(r, &credentials)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
     }
-    if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+    if !valid(w, &credentials, errs) {
         return
     }
-    var user User
-    err := db.DB.QueryRow(
-        `SELECT id, username, password, email, role FROM users WHERE username=$1`,
-        credentials.Username,
-    ).Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role)
-    if err == sql.ErrNoRows {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+    if h.loginLocked(w, r, credentials.Username) {
+        return
+    }
+    user, err := h.users.GetByUsername(r.Context(), credentials.Username)
+    if err == store.ErrNotFound {
+        bcrypt.CompareHashAndPassword(dummyHash, []byte(credentials.Passwords))
+        h.loginFailed(w, r, credentials.Username)
         return
     } else if err != nil {
-        http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+        problem.Internal(w, err)
         return
     }
 
-
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Passwords)); err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        h.loginFailed(w, r, credentials.Username)
         return
     }
-
-    expirationTime := time.Now().Add(24 * time.Hour)
-    claims := jwt.MapClaims{
-        "userId": user.ID,
-        "exp":    expirationTime.Unix(),
-    }
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    tokenString, err := token.SignedString(jwtKey)
-    if err != nil {
-        http.Error(w, "Error generating token", http.StatusInternalServerError)
-        return
+    // Only the account is cleared; one valid login must not reset the
+    // count of a client trying many accounts.
+    if err := h.logins.Reset(r.Context(), auth.UsernameKey(credentials.Username)); err != nil {
+        log.Printf("clearing failed logins of %s: %v", credentials.Username, err)
     }
-    json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+
+    h.startSession(w, r, user)
+}
+
+// userResponse is a user as GET /users/{id} shows it. Email and role are
+// left out for callers other than the user and admins.
+type userResponse struct {
+    ID        int    `json:"id"`
+    Username  string `json:"username"`
+    AvatarURL string `json:"avatarUrl,omitempty"`
+    Email     string `json:"email,omitempty"`
+    Role      string `json:"role,omitempty"`
 }
 
-func GetUserByIdHandler(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) GetUserById(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     userID, err := strconv.Atoi(params["id"])
     if err != nil {
-        http.Error(w, "Invalid user ID", http.StatusBadRequest)
+        badRequest(w, "Invalid user ID")
         return
     }
     
-    type UserResponse struct {
-        ID       int    `json:"id"`
-        Username string `json:"username"`
-        Email    string `json:"email,omitempty"`
-        Role     string `json:"role,omitempty"`
-    }
-    
-    var user UserResponse
-    err = db.DB.QueryRow(`
-        SELECT id, username, email, role 
-        FROM users WHERE id = $1`, userID).
-        Scan(&user.ID, &user.Username, &user.Email, &user.Role)
-        
-    if err == sql.ErrNoRows {
-        http.Error(w, "User not found", http.StatusNotFound)
-        return
-    } else if err != nil {
-        http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+    found, err := h.users.Get(r.Context(), userID)
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database error")
         return
     }
+    user := userResponse{ID: found.ID, Username: found.Username, AvatarURL: found.AvatarURL, Email: found.Email, Role: found.Role}
     
 
-    userRoleStr := r.Header.Get("X-User-Role")
-    if userRoleStr != "admin" {
+    if !auth.Can(auth.PrincipalFrom(r.Context()), auth.Read, auth.Resource{Kind: auth.Users, OwnerID: found.ID}) {
         user.Email = ""
         user.Role = ""
     }
     
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(user)
-}
\ No newline at end of file
+}
+
+type roleRequest struct {
+    Role string `json:"role" validate:"required,oneof=user|admin"`
+}
+
+// SetRole changes the role of a user. It is admin only and recorded in the
+// role audit log. The user's sessions are revoked, so the new role applies
+// to their next login rather than to tokens issued before the change.
+func (h *UserHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+    userID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        badRequest(w, "Invalid user ID")
+        return
+    }
+    var body roleRequest
+    errs, err := decodeJSON(r, &body)
+    if err != nil {
+        problem.WriteError(w, err)
+        return
+    }
+    if !valid(w, &body, errs) {
+        return
+    }
+
+    user, err := h.users.Get(r.Context(), userID)
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database error")
+        return
+    }
+    if user.Role == auth.RoleAdmin && body.Role != auth.RoleAdmin {
+        admins, err := h.users.CountByRole(r.Context(), auth.RoleAdmin)
+        if err != nil {
+            problem.Internal(w, err)
+            return
+        }
+        if admins <= 1 {
+            problem.Error(w, http.StatusConflict, problem.Conflict, "Cannot remove the last admin")
+            return
+        }
+    }
+
+    err = h.users.SetRole(r.Context(), store.RoleChange{
+        UserID:    userID,
+        Role:      body.Role,
+        ChangedBy: auth.PrincipalFrom(r.Context()).UserID,
+        Source:    "api",
+    })
+    if err != nil {
+        writeStoreError(w, err, "User not found", "Database update error")
+        return
+    }
+    if user.Role != body.Role {
+        if err := h.sessions.RevokeUser(r.Context(), userID); err != nil {
+            problem.Internal(w, err)
+            return
+        }
+    }
+
+    user.Role = body.Role
+    user.Password = ""
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+    "errors"
+    "net/mail"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "coffeeApi/services/models"
+    "coffeeApi/services/problem"
+)
+
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_.-]{3,32}$`)
+
+const minPasswordLength = 8
+
+func validateUsername(username string) error {
+    if !usernamePattern.MatchString(username) {
+        return errors.New("username must be 3 to 32 letters, digits, dots, dashes or underscores")
+    }
+    return nil
+}
+
+// normalizeEmail checks that email is a bare address and returns it
+// without surrounding whitespace.
+func normalizeEmail(email string) (string, error) {
+    addr, err := mail.ParseAddress(email)
+    if err != nil || addr.Name != "" || addr.Address != strings.TrimSpace(email) {
+        return "", errors.New("email is not a valid address")
+    }
+    return addr.Address, nil
+}
+
+func validatePassword(password string) error {
+    if utf8.RuneCountInString(password) < minPasswordLength {
+        return errors.New("password must be at least 8 characters long")
+    }
+    return nil
+}
+
+// validateRegistration checks the format of a new account and normalizes
+// its email address. It returns every invalid field.
+func validateRegistration(u *models.User) []problem.FieldError {
+    errs := requiredFields(map[string]string{"username": u.Username, "email": u.Email, "password": u.Password})
+    if len(errs) > 0 {
+        return errs
+    }
+    if err := validateUsername(u.Username); err != nil {
+        errs = append(errs, fieldError("username", err))
+    }
+    if email, err := normalizeEmail(u.Email); err != nil {
+        errs = append(errs, fieldError("email", err))
+    } else {
+        u.Email = email
+    }
+    if err := validatePassword(u.Password); err != nil {
+        errs = append(errs, fieldError("password", err))
+    }
+    return errs
+}
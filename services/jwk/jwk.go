@@ -0,0 +1,88 @@
+// Package jwk encodes and decodes public keys as JSON Web Keys (RFC 7517).
+// Only RSA and Ed25519 keys are supported.
+package jwk
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "math/big"
+)
+
+type Key struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use,omitempty"`
+    Alg string `json:"alg,omitempty"`
+    // N and E are set for RSA keys.
+    N string `json:"n,omitempty"`
+    E string `json:"e,omitempty"`
+    // Crv and X are set for Ed25519 keys.
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+}
+
+type Set struct {
+    Keys []Key `json:"keys"`
+}
+
+// New encodes a public signing key under the key ID kid.
+func New(kid string, key crypto.PublicKey) (Key, error) {
+    switch key := key.(type) {
+    case *rsa.PublicKey:
+        return Key{
+            Kty: "RSA",
+            Kid: kid,
+            Use: "sig",
+            Alg: "RS256",
+            N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+            E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+        }, nil
+    case ed25519.PublicKey:
+        return Key{
+            Kty: "OKP",
+            Kid: kid,
+            Use: "sig",
+            Alg: "EdDSA",
+            Crv: "Ed25519",
+            X:   base64.RawURLEncoding.EncodeToString(key),
+        }, nil
+    }
+    return Key{}, fmt.Errorf("unsupported key type %T", key)
+}
+
+// PublicKey decodes k into an *rsa.PublicKey or an ed25519.PublicKey.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+    switch k.Kty {
+    case "RSA":
+        n, err := base64.RawURLEncoding.DecodeString(k.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := base64.RawURLEncoding.DecodeString(k.E)
+        if err != nil {
+            return nil, err
+        }
+        exp := new(big.Int).SetBytes(e)
+        if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+            return nil, errors.New("invalid RSA exponent")
+        }
+        return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+    case "OKP":
+        if k.Crv != "Ed25519" {
+            return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+        }
+        x, err := base64.RawURLEncoding.DecodeString(k.X)
+        if err != nil {
+            return nil, err
+        }
+        if len(x) != ed25519.PublicKeySize {
+            return nil, errors.New("invalid Ed25519 key size")
+        }
+        return ed25519.PublicKey(x), nil
+    }
+    return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
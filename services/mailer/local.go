@@ -0,0 +1,38 @@
+package mailer
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// Log prints messages to the standard logger, for development.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, m Message) error {
+    log.Printf("mail to %s: %s\n%s", m.To, m.Subject, m.Body)
+    return nil
+}
+
+// File writes every message to its own .eml file in Dir, so tests can read
+// the links that were sent.
+type File struct {
+    Dir  string
+    From string
+
+    seq atomic.Int64
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+    if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+        return err
+    }
+    to := strings.NewReplacer("@", "_at_", "/", "_", `\`, "_").Replace(m.To)
+    name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().Format("20060102T150405"), f.seq.Add(1), to)
+    return os.WriteFile(filepath.Join(f.Dir, name), format(f.From, m), 0o644)
+}
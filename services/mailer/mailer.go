@@ -0,0 +1,71 @@
+package mailer
+
+import (
+    "context"
+    "fmt"
+    "os"
+)
+
+type Message struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// Mailer delivers account emails such as verification and password reset
+// links.
+type Mailer interface {
+    Send(ctx context.Context, m Message) error
+}
+
+type Config struct {
+    // Kind is "smtp", "file" or "log".
+    Kind string
+    From string
+
+    SMTPAddr     string
+    SMTPUsername string
+    SMTPPassword string
+
+    // Dir receives one file per message for the "file" mailer.
+    Dir string
+}
+
+func ConfigFromEnv() Config {
+    return Config{
+        Kind:         orDefault(os.Getenv("MAILER"), "log"),
+        From:         orDefault(os.Getenv("MAIL_FROM"), "no-reply@coffeeapi.local"),
+        SMTPAddr:     os.Getenv("SMTP_ADDR"),
+        SMTPUsername: os.Getenv("SMTP_USERNAME"),
+        SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+        Dir:          orDefault(os.Getenv("MAIL_DIR"), "mail"),
+    }
+}
+
+func New(cfg Config) (Mailer, error) {
+    switch cfg.Kind {
+    case "smtp":
+        if cfg.SMTPAddr == "" {
+            return nil, fmt.Errorf("SMTP_ADDR is required for the smtp mailer")
+        }
+        return &SMTP{Addr: cfg.SMTPAddr, From: cfg.From, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}, nil
+    case "file":
+        return &File{Dir: cfg.Dir, From: cfg.From}, nil
+    case "log":
+        return &Log{}, nil
+    }
+    return nil, fmt.Errorf("unknown mailer %q", cfg.Kind)
+}
+
+// format renders m as a plain text RFC 5322 message.
+func format(from string, m Message) []byte {
+    return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+        from, m.To, m.Subject, m.Body))
+}
+
+func orDefault(value, def string) string {
+    if value == "" {
+        return def
+    }
+    return value
+}
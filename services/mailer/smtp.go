@@ -0,0 +1,28 @@
+package mailer
+
+import (
+    "context"
+    "net"
+    "net/smtp"
+)
+
+// SMTP sends messages through an SMTP server, authenticating with PLAIN
+// when a username is set.
+type SMTP struct {
+    Addr     string
+    From     string
+    Username string
+    Password string
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+    var auth smtp.Auth
+    if s.Username != "" {
+        host, _, err := net.SplitHostPort(s.Addr)
+        if err != nil {
+            return err
+        }
+        auth = smtp.PlainAuth("", s.Username, s.Password, host)
+    }
+    return smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, format(s.From, m))
+}
@@ -1,84 +1,170 @@
 package middleware
 
 import (
-    "database/sql"
-    "fmt"
+    "crypto/rand"
+    "encoding/hex"
     "net/http"
-    "strconv"
+    "regexp"
     "strings"
 
-    "coffeeApi/services/db"
-    "github.com/golang-jwt/jwt"
-    "os"
+    "coffeeApi/services/auth"
+    "coffeeApi/services/problem"
+    "coffeeApi/services/store"
 )
 
-var rawKey = os.Getenv("JWT_SECRET_KEY")
+// Authenticator checks bearer access tokens and the sessions they belong
+// to, so logging out takes effect before the token expires, and API keys.
+type Authenticator struct {
+    sessions store.SessionStore
+    apiKeys  store.APIKeyStore
+}
+
+func NewAuthenticator(sessions store.SessionStore, apiKeys store.APIKeyStore) *Authenticator {
+    return &Authenticator{sessions: sessions, apiKeys: apiKeys}
+}
 
-var jwtKey = []byte(rawKey)
+// authenticate checks the access token or API key of r. Rejected
+// credentials give a *problem.Problem.
+func (a *Authenticator) authenticate(r *http.Request) (auth.Principal, error) {
+    parts := strings.Split(r.Header.Get("Authorization"), " ")
+    if len(parts) != 2 {
+        return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.InvalidToken, "Invalid token format")
+    }
+    if strings.EqualFold(parts[0], "ApiKey") {
+        return a.authenticateAPIKey(r, parts[1])
+    }
+    claims, err := auth.ParseAccessToken(parts[1])
+    if err != nil {
+        return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.InvalidToken, "Invalid token")
+    }
+    active, err := a.sessions.Active(r.Context(), claims.SessionID)
+    if err != nil {
+        return auth.Principal{}, err
+    }
+    if !active {
+        return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.InvalidToken, "Token has been revoked")
+    }
+    return claims.Principal(), nil
+}
 
+func (a *Authenticator) authenticateAPIKey(r *http.Request, key string) (auth.Principal, error) {
+    k, role, err := a.apiKeys.Use(r.Context(), auth.HashAPIKey(key))
+    if err == store.ErrNotFound {
+        return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.InvalidToken, "Invalid API key")
+    } else if err != nil {
+        return auth.Principal{}, err
+    }
+    scopes := k.Scopes
+    if scopes == nil {
+        // A nil Scopes would grant everything.
+        scopes = []string{}
+    }
+    return auth.Principal{UserID: k.UserID, Role: role, APIKeyID: k.ID, Scopes: scopes}, nil
+}
 
-func AuthMiddleware(next http.Handler) http.Handler {
+func (a *Authenticator) AuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        authHeader := r.Header.Get("Authorization")
-        if authHeader == "" {
-            http.Error(w, "Authorization header required", http.StatusUnauthorized)
-            return
-        }
-        parts := strings.Split(authHeader, " ")
-        if len(parts) != 2 {
-            http.Error(w, "Invalid token format", http.StatusUnauthorized)
-            return
-        }
-        token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-            if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-                return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-            }
-            return jwtKey, nil
-        })
-        if err != nil || !token.Valid {
-            http.Error(w, "Invalid token", http.StatusUnauthorized)
+        if r.Header.Get("Authorization") == "" {
+            problem.Error(w, http.StatusUnauthorized, problem.Unauthorized, "Authorization header required")
             return
         }
-        claims, ok := token.Claims.(jwt.MapClaims)
-        if !ok {
-            http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+        p, err := a.authenticate(r)
+        if err != nil {
+            problem.WriteError(w, err)
             return
         }
-        userIDFloat, ok := claims["userId"].(float64)
-        if !ok {
-            http.Error(w, "Invalid userId in token", http.StatusUnauthorized)
+        next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+    })
+}
+
+// OptionalAuth authenticates requests that carry a token and lets anonymous
+// ones through, for routes whose response depends on the caller.
+func (a *Authenticator) OptionalAuth(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") == "" {
+            next.ServeHTTP(w, r)
             return
         }
-        r.Header.Set("X-User-ID", strconv.Itoa(int(userIDFloat)))
-        next.ServeHTTP(w, r)
+        a.AuthMiddleware(next).ServeHTTP(w, r)
     })
 }
 
+// Authorize lets the request through when the policy allows the caller to
+// perform action on resources of the given kind.
+func Authorize(action auth.Action, kind string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p := auth.PrincipalFrom(r.Context())
+            if !p.Authenticated() {
+                problem.Error(w, http.StatusUnauthorized, problem.Unauthorized, "Unauthorized")
+                return
+            }
+            if !auth.Can(p, action, auth.Resource{Kind: kind}) {
+                problem.Error(w, http.StatusForbidden, problem.Forbidden, "Insufficient privileges")
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
 
-func AdminMiddleware(next http.Handler) http.Handler {
+// RequireSession refuses callers using an API key, for routes that manage
+// the account itself, such as its password, sessions and keys.
+func RequireSession(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        userIDStr := r.Header.Get("X-User-ID")
-        if userIDStr == "" {
-            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        if auth.PrincipalFrom(r.Context()).APIKeyID != 0 {
+            problem.Error(w, http.StatusForbidden, problem.Forbidden, "API keys cannot be used here, log in instead")
             return
         }
-        userID, err := strconv.Atoi(userIDStr)
-        if err != nil {
-            http.Error(w, "Invalid user ID", http.StatusUnauthorized)
-            return
+        next.ServeHTTP(w, r)
+    })
+}
+
+// RequireIfMatch, when required is set, refuses writes without an If-Match
+// header with 428, so clients cannot overwrite changes they have not seen.
+func RequireIfMatch(required bool) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if !required {
+            return next
         }
-        var role string
-        err = db.DB.QueryRow(`SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
-        if err == sql.ErrNoRows {
-            http.Error(w, "User not found", http.StatusUnauthorized)
-            return
-        } else if err != nil {
-            http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
-            return
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Header.Get("If-Match") == "" {
+                problem.Error(w, http.StatusPreconditionRequired, problem.PreconditionRequired, "If-Match header required, send the ETag of the resource")
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an ID in the X-Request-ID response header,
+// keeping one sent by a proxy when it looks sane. Error responses and the
+// server log quote it, so a report can be matched to its log line.
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(problem.RequestIDHeader)
+        if !requestIDPattern.MatchString(id) {
+            b := make([]byte, 12)
+            rand.Read(b)
+            id = hex.EncodeToString(b)
         }
-        if role != "admin" {
-            http.Error(w, "Admin privileges required", http.StatusForbidden)
-            return
+        w.Header().Set(problem.RequestIDHeader, id)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// StripIdentityHeaders drops X-User-* and X-Session-* headers sent by
+// clients. Identity is only ever taken from the request context, but the
+// headers are removed so nothing downstream, such as a proxy or a log line,
+// mistakes them for something the server vouches for.
+func StripIdentityHeaders(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        for name := range r.Header {
+            if strings.HasPrefix(name, "X-User-") || strings.HasPrefix(name, "X-Session-") {
+                r.Header.Del(name)
+            }
         }
         next.ServeHTTP(w, r)
     })
@@ -88,8 +174,9 @@ func AdminMiddleware(next http.Handler) http.Handler {
 func CORSMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authentication")
+        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authentication, If-Match, If-None-Match, X-Request-ID")
+        w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, Link, ETag, X-Request-ID")
         
         if r.Method == "OPTIONS" {
             w.WriteHeader(http.StatusOK)
@@ -0,0 +1,273 @@
+package migrations
+
+import (
+    "context"
+    "database/sql"
+    "embed"
+    "fmt"
+    "io/fs"
+    "log"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID is the pg_advisory_lock key held while migrations run, so two
+// instances started at the same time never apply the same step twice.
+const lockID = 7315320441
+
+type Migration struct {
+    Version int
+    Name    string
+    Up      string
+    Down    string
+}
+
+type Status struct {
+    Version   int
+    Name      string
+    Applied   bool
+    AppliedAt time.Time
+}
+
+type Migrator struct {
+    db         *sql.DB
+    migrations []Migration
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+    migrations, err := load(files)
+    if err != nil {
+        return nil, err
+    }
+    return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from the embedded
+// directory and returns them sorted by version.
+func load(fsys fs.FS) ([]Migration, error) {
+    entries, err := fs.ReadDir(fsys, "sql")
+    if err != nil {
+        return nil, err
+    }
+    byVersion := map[int]*Migration{}
+    for _, e := range entries {
+        fileName := e.Name()
+        var direction string
+        switch {
+        case strings.HasSuffix(fileName, ".up.sql"):
+            direction = "up"
+        case strings.HasSuffix(fileName, ".down.sql"):
+            direction = "down"
+        default:
+            return nil, fmt.Errorf("unexpected migration file %s", fileName)
+        }
+        base := strings.TrimSuffix(fileName, "."+direction+".sql")
+        parts := strings.SplitN(base, "_", 2)
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("migration file %s must be named NNNN_name.%s.sql", fileName, direction)
+        }
+        version, err := strconv.Atoi(parts[0])
+        if err != nil || version <= 0 {
+            return nil, fmt.Errorf("invalid migration version in %s", fileName)
+        }
+        body, err := fs.ReadFile(fsys, path.Join("sql", fileName))
+        if err != nil {
+            return nil, err
+        }
+        m, ok := byVersion[version]
+        if !ok {
+            m = &Migration{Version: version, Name: parts[1]}
+            byVersion[version] = m
+        } else if m.Name != parts[1] {
+            return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, m.Name, parts[1])
+        }
+        if direction == "up" {
+            m.Up = string(body)
+        } else {
+            m.Down = string(body)
+        }
+    }
+
+    migrations := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.Up == "" || m.Down == "" {
+            return nil, fmt.Errorf("migration %d (%s) needs both up and down files", m.Version, m.Name)
+        }
+        migrations = append(migrations, *m)
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+    return migrations, nil
+}
+
+func (m *Migrator) Latest() int {
+    if len(m.migrations) == 0 {
+        return 0
+    }
+    return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable() error {
+    _, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations(
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`)
+    return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+    rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    applied := map[int]time.Time{}
+    for rows.Next() {
+        var version int
+        var at time.Time
+        if err := rows.Scan(&version, &at); err != nil {
+            return nil, err
+        }
+        applied[version] = at
+    }
+    return applied, rows.Err()
+}
+
+// Current returns the highest applied version, or 0 for an empty database.
+func (m *Migrator) Current() (int, error) {
+    if err := m.ensureTable(); err != nil {
+        return 0, err
+    }
+    var version int
+    err := m.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+    return version, err
+}
+
+func (m *Migrator) Status() ([]Status, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+    statuses := make([]Status, 0, len(m.migrations))
+    for _, mig := range m.migrations {
+        at, ok := applied[mig.Version]
+        statuses = append(statuses, Status{Version: mig.Version, Name: mig.Name, Applied: ok, AppliedAt: at})
+    }
+    return statuses, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up() error {
+    return m.To(m.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down() error {
+    current, err := m.Current()
+    if err != nil {
+        return err
+    }
+    if current == 0 {
+        return nil
+    }
+    target := 0
+    for _, mig := range m.migrations {
+        if mig.Version < current {
+            target = mig.Version
+        }
+    }
+    return m.To(target)
+}
+
+// To migrates up or down until the schema is exactly at the given version.
+func (m *Migrator) To(version int) error {
+    if version != 0 && m.find(version) == nil {
+        return fmt.Errorf("unknown migration version %d", version)
+    }
+    if err := m.ensureTable(); err != nil {
+        return fmt.Errorf("error creating schema_migrations: %v", err)
+    }
+
+    conn, err := m.db.Conn(context.Background())
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+        return fmt.Errorf("error acquiring migration lock: %v", err)
+    }
+    defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+    applied, err := m.applied()
+    if err != nil {
+        return err
+    }
+
+    for _, mig := range m.migrations {
+        if _, ok := applied[mig.Version]; ok || mig.Version > version {
+            continue
+        }
+        if err := m.run(mig, true); err != nil {
+            return err
+        }
+    }
+    for i := len(m.migrations) - 1; i >= 0; i-- {
+        mig := m.migrations[i]
+        if _, ok := applied[mig.Version]; !ok || mig.Version <= version {
+            continue
+        }
+        if err := m.run(mig, false); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+    for i := range m.migrations {
+        if m.migrations[i].Version == version {
+            return &m.migrations[i]
+        }
+    }
+    return nil
+}
+
+func (m *Migrator) run(mig Migration, up bool) error {
+    tx, err := m.db.Begin()
+    if err != nil {
+        return err
+    }
+    body, direction := mig.Up, "up"
+    if !up {
+        body, direction = mig.Down, "down"
+    }
+    if _, err := tx.Exec(body); err != nil {
+        tx.Rollback()
+        return fmt.Errorf("migration %04d_%s (%s) failed: %v", mig.Version, mig.Name, direction, err)
+    }
+    if up {
+        _, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+    } else {
+        _, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+    }
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("error recording migration %04d_%s: %v", mig.Version, mig.Name, err)
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    log.Printf("Migration %04d_%s: %s", mig.Version, mig.Name, direction)
+    return nil
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reviews;
+DROP TABLE IF EXISTS shops;
+DROP TABLE IF EXISTS roasteries;
+DROP TABLE IF EXISTS coffees;
+DROP TABLE IF EXISTS users;
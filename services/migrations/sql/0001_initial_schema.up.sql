@@ -0,0 +1,64 @@
+-- Baseline schema previously created by dbinitializr. IF NOT EXISTS lets
+-- databases created before migrations existed adopt this version as-is.
+CREATE TABLE IF NOT EXISTS users(
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    avatar_url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS coffees(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    roastery_id INTEGER,
+    country TEXT,
+    region TEXT,
+    farm TEXT,
+    variety TEXT,
+    process TEXT,
+    roast_profile TEXT,
+    flavour_notes TEXT,
+    description TEXT,
+    image_url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS roasteries(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    country TEXT,
+    city TEXT,
+    address TEXT,
+    website TEXT,
+    description TEXT,
+    avg_rating REAL,
+    lat REAL,
+    lon REAL,
+    image_url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS shops(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    country TEXT,
+    city TEXT,
+    address TEXT,
+    website TEXT,
+    description TEXT,
+    avg_rating REAL,
+    lat REAL,
+    lon REAL,
+    image_url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS reviews(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER,
+    coffee_id INTEGER,
+    roastery_id INTEGER,
+    coffee_shop_id INTEGER,
+    rating REAL,
+    review TEXT,
+    date_of_creation TIMESTAMPTZ
+);
@@ -0,0 +1 @@
+ALTER TABLE coffees DROP COLUMN IF EXISTS avg_rating;
@@ -0,0 +1,6 @@
+-- updateAverageRating has always written coffees.avg_rating, but the column
+-- was never part of the schema.
+ALTER TABLE coffees ADD COLUMN IF NOT EXISTS avg_rating REAL NOT NULL DEFAULT 0;
+
+UPDATE coffees c SET avg_rating = COALESCE(
+    (SELECT AVG(r.rating) FROM reviews r WHERE r.coffee_id = c.id), 0);
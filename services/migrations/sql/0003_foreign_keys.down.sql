@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS reviews_coffee_shop_id_idx;
+DROP INDEX IF EXISTS reviews_roastery_id_idx;
+DROP INDEX IF EXISTS reviews_coffee_id_idx;
+DROP INDEX IF EXISTS reviews_user_id_idx;
+DROP INDEX IF EXISTS coffees_roastery_id_idx;
+
+ALTER TABLE reviews
+    DROP CONSTRAINT IF EXISTS reviews_rating_range,
+    DROP CONSTRAINT IF EXISTS reviews_single_target,
+    DROP CONSTRAINT IF EXISTS reviews_coffee_shop_id_fkey,
+    DROP CONSTRAINT IF EXISTS reviews_roastery_id_fkey,
+    DROP CONSTRAINT IF EXISTS reviews_coffee_id_fkey,
+    DROP CONSTRAINT IF EXISTS reviews_user_id_fkey;
+
+ALTER TABLE coffees DROP CONSTRAINT IF EXISTS coffees_roastery_id_fkey;
+
+INSERT INTO reviews (id, user_id, coffee_id, roastery_id, coffee_shop_id, rating, review, date_of_creation)
+SELECT id, user_id, coffee_id, roastery_id, coffee_shop_id, rating, review, date_of_creation FROM orphaned_reviews;
+DROP TABLE IF EXISTS orphaned_reviews;
+
+UPDATE reviews SET coffee_id = 0 WHERE coffee_id IS NULL;
+UPDATE reviews SET roastery_id = 0 WHERE roastery_id IS NULL;
+UPDATE reviews SET coffee_shop_id = 0 WHERE coffee_shop_id IS NULL;
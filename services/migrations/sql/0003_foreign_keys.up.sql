@@ -0,0 +1,61 @@
+-- Reviews and coffees used 0 to mean "no reference"; foreign keys need NULL.
+UPDATE coffees SET roastery_id = NULL WHERE roastery_id = 0;
+UPDATE reviews SET user_id = NULL WHERE user_id = 0;
+UPDATE reviews SET coffee_id = NULL WHERE coffee_id = 0;
+UPDATE reviews SET roastery_id = NULL WHERE roastery_id = 0;
+UPDATE reviews SET coffee_shop_id = NULL WHERE coffee_shop_id = 0;
+
+-- Clean up rows orphaned by deletes made before the constraints existed.
+UPDATE coffees c SET roastery_id = NULL
+WHERE roastery_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM roasteries ro WHERE ro.id = c.roastery_id);
+UPDATE reviews r SET user_id = NULL
+WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = r.user_id);
+
+-- Reviews of a deleted coffee, roastery or shop cannot satisfy the foreign
+-- keys. They are moved to orphaned_reviews instead of being deleted, so
+-- they can be inspected and restored or purged by hand.
+CREATE TABLE orphaned_reviews (
+    LIKE reviews,
+    quarantined_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+WITH orphans AS (
+    DELETE FROM reviews r
+    WHERE (r.coffee_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM coffees c WHERE c.id = r.coffee_id))
+       OR (r.roastery_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM roasteries ro WHERE ro.id = r.roastery_id))
+       OR (r.coffee_shop_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM shops s WHERE s.id = r.coffee_shop_id))
+    RETURNING r.*
+)
+INSERT INTO orphaned_reviews SELECT *, now() FROM orphans;
+
+DO $$
+DECLARE
+    moved INTEGER;
+BEGIN
+    SELECT COUNT(*) INTO moved FROM orphaned_reviews;
+    IF moved > 0 THEN
+        RAISE WARNING '% reviews of deleted coffees, roasteries or shops moved to orphaned_reviews', moved;
+    END IF;
+END
+$$;
+
+ALTER TABLE coffees
+    ADD CONSTRAINT coffees_roastery_id_fkey FOREIGN KEY (roastery_id)
+        REFERENCES roasteries(id) ON DELETE RESTRICT;
+
+ALTER TABLE reviews
+    ADD CONSTRAINT reviews_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE SET NULL,
+    ADD CONSTRAINT reviews_coffee_id_fkey FOREIGN KEY (coffee_id)
+        REFERENCES coffees(id) ON DELETE CASCADE,
+    ADD CONSTRAINT reviews_roastery_id_fkey FOREIGN KEY (roastery_id)
+        REFERENCES roasteries(id) ON DELETE CASCADE,
+    ADD CONSTRAINT reviews_coffee_shop_id_fkey FOREIGN KEY (coffee_shop_id)
+        REFERENCES shops(id) ON DELETE CASCADE,
+    ADD CONSTRAINT reviews_single_target CHECK (num_nonnulls(coffee_id, roastery_id, coffee_shop_id) = 1),
+    ADD CONSTRAINT reviews_rating_range CHECK (rating BETWEEN 1 AND 5 AND rating = trunc(rating));
+
+CREATE INDEX IF NOT EXISTS coffees_roastery_id_idx ON coffees(roastery_id);
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON reviews(user_id);
+CREATE INDEX IF NOT EXISTS reviews_coffee_id_idx ON reviews(coffee_id);
+CREATE INDEX IF NOT EXISTS reviews_roastery_id_idx ON reviews(roastery_id);
+CREATE INDEX IF NOT EXISTS reviews_coffee_shop_id_idx ON reviews(coffee_shop_id);
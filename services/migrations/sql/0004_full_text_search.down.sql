@@ -0,0 +1,14 @@
+ALTER TABLE coffees
+    DROP COLUMN IF EXISTS search_simple,
+    DROP COLUMN IF EXISTS search_polish,
+    DROP COLUMN IF EXISTS search_english;
+ALTER TABLE roasteries
+    DROP COLUMN IF EXISTS search_simple,
+    DROP COLUMN IF EXISTS search_polish,
+    DROP COLUMN IF EXISTS search_english;
+ALTER TABLE shops
+    DROP COLUMN IF EXISTS search_simple,
+    DROP COLUMN IF EXISTS search_polish,
+    DROP COLUMN IF EXISTS search_english;
+-- The polish text search configuration is left in place; it may predate
+-- this migration.
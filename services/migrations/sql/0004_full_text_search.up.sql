@@ -0,0 +1,61 @@
+-- Stock PostgreSQL has no Polish configuration. Fall back to a copy of
+-- simple so the schema is portable; a server with a Polish dictionary
+-- installed can replace it before this migration runs.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'polish') THEN
+        CREATE TEXT SEARCH CONFIGURATION polish (COPY = simple);
+    END IF;
+END
+$$;
+
+ALTER TABLE coffees
+    ADD COLUMN search_simple tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(flavour_notes, '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_polish tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('polish', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('polish', COALESCE(flavour_notes, '')), 'B') ||
+        setweight(to_tsvector('polish', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_english tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(flavour_notes, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')) STORED;
+CREATE INDEX coffees_search_simple_idx ON coffees USING GIN (search_simple);
+CREATE INDEX coffees_search_polish_idx ON coffees USING GIN (search_polish);
+CREATE INDEX coffees_search_english_idx ON coffees USING GIN (search_english);
+
+ALTER TABLE roasteries
+    ADD COLUMN search_simple tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_polish tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('polish', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('polish', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('polish', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_english tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')) STORED;
+CREATE INDEX roasteries_search_simple_idx ON roasteries USING GIN (search_simple);
+CREATE INDEX roasteries_search_polish_idx ON roasteries USING GIN (search_polish);
+CREATE INDEX roasteries_search_english_idx ON roasteries USING GIN (search_english);
+
+ALTER TABLE shops
+    ADD COLUMN search_simple tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_polish tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('polish', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('polish', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('polish', COALESCE(description, '')), 'C')) STORED,
+    ADD COLUMN search_english tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(city, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')) STORED;
+CREATE INDEX shops_search_simple_idx ON shops USING GIN (search_simple);
+CREATE INDEX shops_search_polish_idx ON shops USING GIN (search_polish);
+CREATE INDEX shops_search_english_idx ON shops USING GIN (search_english);
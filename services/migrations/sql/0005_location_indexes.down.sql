@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS shops_lat_lon_idx;
+DROP INDEX IF EXISTS roasteries_lat_lon_idx;
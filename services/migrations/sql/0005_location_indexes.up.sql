@@ -0,0 +1,3 @@
+-- Bounding box and near queries filter on both coordinates.
+CREATE INDEX IF NOT EXISTS shops_lat_lon_idx ON shops (lat, lon);
+CREATE INDEX IF NOT EXISTS roasteries_lat_lon_idx ON roasteries (lat, lon);
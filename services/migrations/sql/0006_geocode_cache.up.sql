@@ -0,0 +1,6 @@
+CREATE TABLE geocode_cache(
+    address_key TEXT PRIMARY KEY,
+    lat DOUBLE PRECISION NOT NULL,
+    lon DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
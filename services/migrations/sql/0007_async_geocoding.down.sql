@@ -0,0 +1,10 @@
+ALTER TABLE shops
+    DROP COLUMN IF EXISTS geocode_status,
+    DROP COLUMN IF EXISTS geocode_error,
+    DROP COLUMN IF EXISTS geocode_attempts,
+    DROP COLUMN IF EXISTS geocode_next_attempt;
+ALTER TABLE roasteries
+    DROP COLUMN IF EXISTS geocode_status,
+    DROP COLUMN IF EXISTS geocode_error,
+    DROP COLUMN IF EXISTS geocode_attempts,
+    DROP COLUMN IF EXISTS geocode_next_attempt;
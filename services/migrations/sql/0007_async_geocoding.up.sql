@@ -0,0 +1,28 @@
+-- Geocoding moved to a background worker. Rows wait as 'pending' until it
+-- resolves their coordinates or gives up with 'failed'.
+
+ALTER TABLE shops
+    ADD COLUMN geocode_status TEXT NOT NULL DEFAULT 'resolved',
+    ADD COLUMN geocode_error TEXT,
+    ADD COLUMN geocode_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN geocode_next_attempt TIMESTAMPTZ,
+    ADD CONSTRAINT shops_geocode_status_check CHECK (geocode_status IN ('pending', 'resolved', 'failed'));
+
+-- Rows saved while geocoding was down kept the 0,0 placeholder; retry them.
+UPDATE shops SET geocode_status = 'pending', lat = COALESCE(lat, 0), lon = COALESCE(lon, 0)
+WHERE lat IS NULL OR lon IS NULL OR (lat = 0 AND lon = 0);
+
+CREATE INDEX shops_geocode_pending_idx ON shops (geocode_next_attempt) WHERE geocode_status = 'pending';
+
+ALTER TABLE roasteries
+    ADD COLUMN geocode_status TEXT NOT NULL DEFAULT 'resolved',
+    ADD COLUMN geocode_error TEXT,
+    ADD COLUMN geocode_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN geocode_next_attempt TIMESTAMPTZ,
+    ADD CONSTRAINT roasteries_geocode_status_check CHECK (geocode_status IN ('pending', 'resolved', 'failed'));
+
+-- Rows saved while geocoding was down kept the 0,0 placeholder; retry them.
+UPDATE roasteries SET geocode_status = 'pending', lat = COALESCE(lat, 0), lon = COALESCE(lon, 0)
+WHERE lat IS NULL OR lon IS NULL OR (lat = 0 AND lon = 0);
+
+CREATE INDEX roasteries_geocode_pending_idx ON roasteries (geocode_next_attempt) WHERE geocode_status = 'pending';
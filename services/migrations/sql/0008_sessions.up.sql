@@ -0,0 +1,19 @@
+-- A session is one login and the family of refresh tokens rotated from it.
+-- Revoking the session invalidates every access token carrying its id.
+CREATE TABLE sessions(
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+-- Only SHA-256 hashes of refresh tokens are stored.
+CREATE TABLE refresh_tokens(
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens(session_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS role_changes;
+DROP INDEX IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
@@ -0,0 +1,39 @@
+-- Registration used to store whatever role the client sent.
+UPDATE users SET role = 'user' WHERE role NOT IN ('user', 'admin');
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
+
+-- Accounts whose emails differ only in case cannot be merged safely here,
+-- so the migration stops and lists them; rename or remove them by hand and
+-- run it again.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('%s (users %s)', email, ids), '; ') INTO duplicates
+    FROM (
+        SELECT lower(email) AS email, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(email)
+        HAVING COUNT(*) > 1
+    ) d;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email address ignoring case: %', duplicates
+            USING HINT = 'Change or delete all but one account per address before migrating.';
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
+
+-- Every role change, made through the API or the bootstrap command.
+CREATE TABLE role_changes(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    old_role TEXT NOT NULL,
+    new_role TEXT NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    source TEXT NOT NULL,
+    actor TEXT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX role_changes_user_id_idx ON role_changes(user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+-- Accounts created before verification existed had no way to verify, so
+-- they keep working when reviews require a verified email.
+UPDATE users SET email_verified = true;
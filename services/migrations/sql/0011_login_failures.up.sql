@@ -0,0 +1,9 @@
+-- Failed logins per username ("user:alice") and per client address
+-- ("ip:203.0.113.7"). A row is removed by a successful login or an admin
+-- unlocking the account.
+CREATE TABLE login_failures(
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
@@ -0,0 +1,13 @@
+-- Keys for machine clients. Only a hash of the key is stored; the prefix
+-- is shown to the owner to tell their keys apart.
+CREATE TABLE api_keys(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+CREATE INDEX api_keys_user_id_idx ON api_keys(user_id);
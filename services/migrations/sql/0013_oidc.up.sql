@@ -0,0 +1,21 @@
+-- Accounts at external OpenID Connect providers, identified by the issuer
+-- and the subject the issuer gives the user.
+CREATE TABLE user_identities(
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX user_identities_user_id_idx ON user_identities(user_id);
+
+-- Logins started at a provider and not yet finished, keyed by the state
+-- parameter. The PKCE verifier never leaves the server.
+CREATE TABLE oidc_logins(
+    state TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE shops DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE roasteries DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE coffees DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,2 @@
+ALTER TABLE shops DROP COLUMN IF EXISTS address_pending;
+ALTER TABLE roasteries DROP COLUMN IF EXISTS address_pending;
@@ -0,0 +1,8 @@
+-- Map pins saved without a full address wait with address_pending set until
+-- the geocoding worker fills in the address from their coordinates.
+
+ALTER TABLE shops ADD COLUMN address_pending BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX shops_address_pending_idx ON shops (geocode_next_attempt) WHERE address_pending;
+
+ALTER TABLE roasteries ADD COLUMN address_pending BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX roasteries_address_pending_idx ON roasteries (geocode_next_attempt) WHERE address_pending;
@@ -0,0 +1,2 @@
+-- The messages replaced by codes are not kept; the codes stay.
+SELECT 1;
@@ -0,0 +1,16 @@
+-- geocode_error is shown to clients, so it holds a stable code instead of
+-- the provider's message, which could name internal hosts or echo response
+-- bodies. Replace the messages stored before.
+UPDATE shops SET geocode_error = CASE
+    WHEN geocode_error = 'no results found for the address' THEN 'not_found'
+    WHEN geocode_error LIKE '%rate limited%' OR geocode_error LIKE '%status: 429%' THEN 'rate_limited'
+    ELSE 'upstream_unavailable'
+END
+WHERE geocode_error IS NOT NULL AND geocode_error NOT IN ('not_found', 'rate_limited', 'upstream_unavailable');
+
+UPDATE roasteries SET geocode_error = CASE
+    WHEN geocode_error = 'no results found for the address' THEN 'not_found'
+    WHEN geocode_error LIKE '%rate limited%' OR geocode_error LIKE '%status: 429%' THEN 'rate_limited'
+    ELSE 'upstream_unavailable'
+END
+WHERE geocode_error IS NOT NULL AND geocode_error NOT IN ('not_found', 'rate_limited', 'upstream_unavailable');
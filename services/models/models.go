@@ -0,0 +1,151 @@
+package models
+
+import "time"
+
+type User struct {
+    ID            int    `json:"id"`
+    Username      string `json:"username"`
+    Password      string `json:"password"`
+    Email         string `json:"email"`
+    EmailVerified bool   `json:"emailVerified"`
+    Role          string `json:"role"`
+    AvatarURL     string `json:"avatarUrl"`
+}
+
+type APIKey struct {
+    ID         int        `json:"id"`
+    UserID     int        `json:"-"`
+    Name       string     `json:"name"`
+    Prefix     string     `json:"prefix"`
+    Hash       string     `json:"-"`
+    Scopes     []string   `json:"scopes"`
+    CreatedAt  time.Time  `json:"createdAt"`
+    LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type Coffee struct {
+    ID           int       `json:"id"`
+    Name         string    `json:"name" validate:"required,max=200"`
+    RoasteryId   int       `json:"roasteryId"`
+    Country      string    `json:"country" validate:"required,max=100"`
+    Region       string    `json:"region" validate:"max=100"`
+    Farm         string    `json:"farm" validate:"max=100"`
+    Variety      string    `json:"variety" validate:"max=100"`
+    Process      string    `json:"process" validate:"required,oneof=Washed|Natural|Honey|Pulped natural|Anaerobic|Wet-hulled|Blend|Experimental|Unknown"`
+    RoastProfile string    `json:"roastProfile" validate:"required,oneof=Light|Medium-light|Medium|Medium-dark|Dark|Filter|Espresso|Omni|Unknown"`
+    FlavourNotes []string  `json:"flavourNotes" validate:"max=20"`
+    Description  string    `json:"description" validate:"max=2000"`
+    AvgRating    float32   `json:"avgRating"`
+    // Version is raised by every update, which also sets UpdatedAt.
+    Version      int       `json:"version"`
+    UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type CoffeeShop struct {
+    ID             int       `json:"id"`
+    Name           string    `json:"name" validate:"required,max=200"`
+    Country        string    `json:"country" validate:"max=100"`
+    City           string    `json:"city" validate:"max=100"`
+    Address        string    `json:"address" validate:"max=200"`
+    Website        string    `json:"website" validate:"max=500,url"`
+    Description    string    `json:"description" validate:"max=2000"`
+    AvgRating      float32   `json:"avgRating"`
+    Lat            float64   `json:"lat" validate:"min=-90,max=90"`
+    Lon            float64   `json:"lon" validate:"min=-180,max=180"`
+    // GeocodeStatus is "pending" until Lat and Lon are resolved in the
+    // background, then "resolved" or "failed".
+    GeocodeStatus  string    `json:"geocodeStatus"`
+    GeocodeError   string    `json:"geocodeError,omitempty"`
+    // AddressPending is set while the missing address of a map pin is
+    // looked up in the background.
+    AddressPending bool      `json:"addressPending"`
+    // Version is raised by every update, which also sets UpdatedAt.
+    Version        int       `json:"version"`
+    UpdatedAt      time.Time `json:"updatedAt"`
+    // DistanceKm is set only by lists filtered with near=lat,lon.
+    DistanceKm     *float64  `json:"distanceKm,omitempty"`
+}
+
+type Roastery struct {
+    ID             int       `json:"id"`
+    Name           string    `json:"name" validate:"required,max=200"`
+    Country        string    `json:"country" validate:"max=100"`
+    City           string    `json:"city" validate:"max=100"`
+    Address        string    `json:"address" validate:"max=200"`
+    Website        string    `json:"website" validate:"max=500,url"`
+    Description    string    `json:"description" validate:"max=2000"`
+    AvgRating      float32   `json:"avgRating"`
+    Lat            float64   `json:"lat" validate:"min=-90,max=90"`
+    Lon            float64   `json:"lon" validate:"min=-180,max=180"`
+    // GeocodeStatus is "pending" until Lat and Lon are resolved in the
+    // background, then "resolved" or "failed".
+    GeocodeStatus  string    `json:"geocodeStatus"`
+    GeocodeError   string    `json:"geocodeError,omitempty"`
+    // AddressPending is set while the missing address of a map pin is
+    // looked up in the background.
+    AddressPending bool      `json:"addressPending"`
+    // Version is raised by every update, which also sets UpdatedAt.
+    Version        int       `json:"version"`
+    UpdatedAt      time.Time `json:"updatedAt"`
+    // DistanceKm is set only by lists filtered with near=lat,lon.
+    DistanceKm     *float64  `json:"distanceKm,omitempty"`
+}
+
+type Review struct {
+    ID             int       `json:"id"`
+    UserId         int       `json:"userId"`
+    CoffeeId       int       `json:"coffeeId" validate:"exactlyone=target"`
+    RoasteryId     int       `json:"roasteryId" validate:"exactlyone=target"`
+    CoffeeShopId   int       `json:"coffeeShopId" validate:"exactlyone=target"`
+    Rating         float32   `json:"rating" validate:"required,int,min=1,max=5"`
+    Review         string    `json:"review" validate:"max=5000"`
+    DateOfCreation time.Time `json:"dateOfCreation"`
+    // Version is the version an update expects to replace, 0 for any. The
+    // store sets it and UpdatedAt after a write.
+    Version        int       `json:"-"`
+    UpdatedAt      time.Time `json:"-"`
+}
+
+type ReviewResponse struct {
+    ID             int       `json:"id"`
+    UserId         int       `json:"userId"`
+    UserName       string    `json:"userName"`
+    CoffeeId       int       `json:"coffeeId"`
+    CoffeeName     string    `json:"coffeeName,omitempty"`
+    RoasteryId     int       `json:"roasteryId"`
+    RoasteryName   string    `json:"roasteryName,omitempty"`
+    CoffeeShopId   int       `json:"coffeeShopId"`
+    CoffeeShopName string    `json:"coffeeShopName,omitempty"`
+    Rating         float32   `json:"rating"`
+    Review         string    `json:"review"`
+    DateOfCreation time.Time `json:"dateOfCreation"`
+    TargetType     string    `json:"targetType"`
+    TargetName     string    `json:"targetName"`
+    // Version is raised by every update, which also sets UpdatedAt.
+    Version        int       `json:"version"`
+    UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// SearchResult is one ranked hit of the full-text search. Snippet is an
+// HTML excerpt of the matched text: the text is escaped and the matched
+// words are wrapped in <mark>.
+type SearchResult struct {
+    Type    string  `json:"type"`
+    ID      int     `json:"id"`
+    Name    string  `json:"name"`
+    Score   float64 `json:"score"`
+    Snippet string  `json:"snippet"`
+}
+
+func ReviewTargetType(coffeeId, roasteryId, coffeeShopId int) string {
+    if coffeeId != 0 {
+        return "coffee"
+    }
+    if roasteryId != 0 {
+        return "roastery"
+    }
+    if coffeeShopId != 0 {
+        return "coffee_shop"
+    }
+    return "unknown"
+}
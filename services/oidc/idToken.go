@@ -0,0 +1,106 @@
+package oidc
+
+import (
+    "context"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/golang-jwt/jwt"
+)
+
+// clockSkew is how far the provider's clock may be ahead or behind.
+const clockSkew = time.Minute
+
+// IDToken holds the claims of an ID token used to identify the user.
+type IDToken struct {
+    Issuer            string   `json:"iss"`
+    Subject           string   `json:"sub"`
+    Audience          audience `json:"aud"`
+    ExpiresAt         int64    `json:"exp"`
+    IssuedAt          int64    `json:"iat"`
+    Nonce             string   `json:"nonce"`
+    Email             string   `json:"email"`
+    EmailVerified     bool     `json:"email_verified"`
+    PreferredUsername string   `json:"preferred_username"`
+    Name              string   `json:"name"`
+}
+
+// Valid checks the times of the token; the issuer and audience are checked
+// by verify, which knows the expected values.
+func (t *IDToken) Valid() error {
+    now := time.Now()
+    if t.ExpiresAt == 0 || now.After(time.Unix(t.ExpiresAt, 0).Add(clockSkew)) {
+        return errors.New("id token expired")
+    }
+    if t.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(t.IssuedAt, 0)) {
+        return errors.New("id token issued in the future")
+    }
+    return nil
+}
+
+// audience is a single string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+    var single string
+    if err := json.Unmarshal(data, &single); err == nil {
+        *a = audience{single}
+        return nil
+    }
+    var list []string
+    if err := json.Unmarshal(data, &list); err != nil {
+        return err
+    }
+    *a = list
+    return nil
+}
+
+func (a audience) contains(v string) bool {
+    for _, s := range a {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *Provider) verify(ctx context.Context, raw string) (*IDToken, error) {
+    claims := &IDToken{}
+    _, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        key, err := p.keys.get(ctx, kid)
+        if err != nil {
+            return nil, err
+        }
+        // The key decides the algorithm, so a token cannot pick a weaker
+        // one, such as HS256 keyed with the public key.
+        switch key.(type) {
+        case *rsa.PublicKey:
+            if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+                return key, nil
+            }
+        case ed25519.PublicKey:
+            if token.Method == jwt.SigningMethodEdDSA {
+                return key, nil
+            }
+        }
+        return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+    })
+    if err != nil {
+        return nil, fmt.Errorf("id token: %w", err)
+    }
+    if claims.Issuer != p.Issuer {
+        return nil, fmt.Errorf("id token: issuer %q does not match %q", claims.Issuer, p.Issuer)
+    }
+    if !claims.Audience.contains(p.ClientID) {
+        return nil, errors.New("id token: not issued for this client")
+    }
+    if claims.Subject == "" {
+        return nil, errors.New("id token: no subject")
+    }
+    return claims, nil
+}
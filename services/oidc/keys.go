@@ -0,0 +1,66 @@
+package oidc
+
+import (
+    "context"
+    "crypto"
+    "fmt"
+    "sync"
+    "time"
+
+    "coffeeApi/services/jwk"
+)
+
+// minRefresh limits how often an unknown key ID makes keySet fetch the
+// keys again, so forged tokens cannot flood the provider.
+const minRefresh = time.Minute
+
+// keySet caches the signing keys of a provider and fetches them again when
+// a token names a key it does not know, which happens after rotation.
+type keySet struct {
+    uri      string
+    provider *Provider
+
+    mu      sync.Mutex
+    keys    map[string]crypto.PublicKey
+    fetched time.Time
+}
+
+func (s *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if key, ok := s.lookup(kid); ok {
+        return key, nil
+    }
+    if time.Since(s.fetched) < minRefresh {
+        return nil, fmt.Errorf("unknown signing key %q", kid)
+    }
+    var set jwk.Set
+    if err := s.provider.getJSON(ctx, s.uri, &set); err != nil {
+        return nil, fmt.Errorf("fetching keys: %w", err)
+    }
+    s.fetched = time.Now()
+    s.keys = map[string]crypto.PublicKey{}
+    for _, k := range set.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        if key, err := k.PublicKey(); err == nil {
+            s.keys[k.Kid] = key
+        }
+    }
+    if key, ok := s.lookup(kid); ok {
+        return key, nil
+    }
+    return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds the key by ID; tokens without an ID match the only key.
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+    if kid == "" && len(s.keys) == 1 {
+        for _, key := range s.keys {
+            return key, true
+        }
+    }
+    key, ok := s.keys[kid]
+    return key, ok
+}
@@ -0,0 +1,180 @@
+package oidc
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ProviderConfig names an OpenID Connect issuer and the client registered
+// with it. ClientSecret is empty for public clients, which rely on PKCE.
+type ProviderConfig struct {
+    Name         string
+    Issuer       string
+    ClientID     string
+    ClientSecret string
+}
+
+// ConfigFromEnv reads OIDC_PROVIDERS (comma separated names) and, for each
+// name, OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and
+// OIDC_<NAME>_CLIENT_SECRET.
+func ConfigFromEnv() ([]ProviderConfig, error) {
+    var configs []ProviderConfig
+    for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+        env := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+        cfg := ProviderConfig{
+            Name:         name,
+            Issuer:       strings.TrimSuffix(os.Getenv(env+"ISSUER"), "/"),
+            ClientID:     os.Getenv(env + "CLIENT_ID"),
+            ClientSecret: os.Getenv(env + "CLIENT_SECRET"),
+        }
+        if cfg.Issuer == "" || cfg.ClientID == "" {
+            return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required for provider %q", env, env, name)
+        }
+        configs = append(configs, cfg)
+    }
+    return configs, nil
+}
+
+type discovery struct {
+    Issuer                string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint         string `json:"token_endpoint"`
+    JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider runs the authorization code flow with PKCE against one issuer.
+// Its discovery document is fetched on first use.
+type Provider struct {
+    ProviderConfig
+    Client *http.Client
+
+    mu   sync.Mutex
+    meta *discovery
+    keys *keySet
+}
+
+func NewProvider(cfg ProviderConfig) *Provider {
+    return &Provider{ProviderConfig: cfg, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.meta != nil {
+        return p.meta, nil
+    }
+    var meta discovery
+    if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+        return nil, fmt.Errorf("discovery: %w", err)
+    }
+    if strings.TrimSuffix(meta.Issuer, "/") != p.Issuer {
+        return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.Issuer)
+    }
+    if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+        return nil, errors.New("discovery: incomplete provider metadata")
+    }
+    p.meta = &meta
+    p.keys = &keySet{uri: meta.JWKSURI, provider: p}
+    return p.meta, nil
+}
+
+// AuthCodeURL returns the address the user is sent to for logging in.
+// loginHint, when set, suggests the account to the provider.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, verifier, loginHint string) (string, error) {
+    meta, err := p.discover(ctx)
+    if err != nil {
+        return "", err
+    }
+    q := url.Values{
+        "response_type":         {"code"},
+        "client_id":             {p.ClientID},
+        "redirect_uri":          {redirectURI},
+        "scope":                 {"openid email profile"},
+        "state":                 {state},
+        "nonce":                 {nonce},
+        "code_challenge":        {Challenge(verifier)},
+        "code_challenge_method": {"S256"},
+    }
+    if loginHint != "" {
+        q.Set("login_hint", loginHint)
+    }
+    sep := "?"
+    if strings.Contains(meta.AuthorizationEndpoint, "?") {
+        sep = "&"
+    }
+    return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the
+// verified claims of the ID token. The caller checks the nonce.
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code, verifier string) (*IDToken, error) {
+    meta, err := p.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+    form := url.Values{
+        "grant_type":    {"authorization_code"},
+        "code":          {code},
+        "redirect_uri":  {redirectURI},
+        "client_id":     {p.ClientID},
+        "code_verifier": {verifier},
+    }
+    if p.ClientSecret != "" {
+        form.Set("client_secret", p.ClientSecret)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+    resp, err := p.Client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    var body struct {
+        IDToken          string `json:"id_token"`
+        Error            string `json:"error"`
+        ErrorDescription string `json:"error_description"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+        return nil, fmt.Errorf("token endpoint: %w", err)
+    }
+    if resp.StatusCode != http.StatusOK || body.Error != "" {
+        return nil, fmt.Errorf("token endpoint: %s %s", body.Error, body.ErrorDescription)
+    }
+    if body.IDToken == "" {
+        return nil, errors.New("token endpoint: no id_token in response")
+    }
+    return p.verify(ctx, body.IDToken)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", "application/json")
+    resp, err := p.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("GET %s: %s", url, resp.Status)
+    }
+    return json.NewDecoder(resp.Body).Decode(v)
+}
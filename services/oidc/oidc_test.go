@@ -0,0 +1,243 @@
+package oidc_test
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+
+    "coffeeApi/services/auth"
+    "coffeeApi/services/handlers"
+    "coffeeApi/services/mailer"
+    "coffeeApi/services/models"
+    "coffeeApi/services/oidc"
+    "coffeeApi/services/store"
+
+    "github.com/gorilla/mux"
+)
+
+const publicURL = "http://api.test"
+
+// flow is the API's OIDC routes, backed by in-memory stores, signing in
+// against a stub issuer on a local test server.
+type flow struct {
+    t      *testing.T
+    issuer string
+    client *http.Client
+    stores store.Stores
+    router *mux.Router
+}
+
+func newFlow(t *testing.T) *flow {
+    t.Helper()
+    keys := t.TempDir()
+    if _, err := auth.GenerateKey(keys, auth.AlgEdDSA, time.Now().Add(-time.Minute)); err != nil {
+        t.Fatal(err)
+    }
+    manager := &auth.KeyManager{Dir: keys, Alg: auth.AlgEdDSA}
+    if err := manager.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    auth.UseKeys(manager)
+
+    var stub *oidc.Stub
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        stub.ServeHTTP(w, r)
+    }))
+    t.Cleanup(server.Close)
+    stub, err := oidc.NewStub(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    provider := oidc.NewProvider(oidc.ProviderConfig{Name: "stub", Issuer: server.URL, ClientID: "coffee-api"})
+    provider.Client = server.Client()
+    stores := store.NewMemoryStores()
+    users := handlers.NewUserHandler(stores.Users, stores.Sessions, stores.APIKeys, stores.Logins, mailer.Log{}, publicURL)
+    h := handlers.NewOIDCHandler(users, stores.Identities, []*oidc.Provider{provider})
+    router := mux.NewRouter()
+    router.HandleFunc("/oidc/{provider}/login", h.Login).Methods("GET")
+    router.HandleFunc("/oidc/{provider}/callback", h.Callback).Methods("GET")
+
+    client := server.Client()
+    client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+    return &flow{t: t, issuer: server.URL, client: client, stores: stores, router: router}
+}
+
+func (f *flow) serve(target string) *httptest.ResponseRecorder {
+    rec := httptest.NewRecorder()
+    f.router.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+    return rec
+}
+
+// login starts a login at the API and returns the provider's authorization
+// URL it redirects to.
+func (f *flow) login(email string) *url.URL {
+    f.t.Helper()
+    rec := f.serve("/oidc/stub/login?login_hint=" + url.QueryEscape(email))
+    if rec.Code != http.StatusFound {
+        f.t.Fatalf("login status = %d, body %s", rec.Code, rec.Body)
+    }
+    authorize, err := url.Parse(rec.Header().Get("Location"))
+    if err != nil {
+        f.t.Fatal(err)
+    }
+    return authorize
+}
+
+// authorize signs in at the stub and returns the callback URL it redirects
+// back to.
+func (f *flow) authorize(authorize *url.URL) *url.URL {
+    f.t.Helper()
+    resp, err := f.client.Get(authorize.String())
+    if err != nil {
+        f.t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusFound {
+        f.t.Fatalf("authorize status = %d", resp.StatusCode)
+    }
+    callback, err := url.Parse(resp.Header.Get("Location"))
+    if err != nil {
+        f.t.Fatal(err)
+    }
+    if got := callback.Scheme + "://" + callback.Host + callback.Path; got != publicURL+"/oidc/stub/callback" {
+        f.t.Fatalf("redirected to %s", got)
+    }
+    return callback
+}
+
+func (f *flow) callback(callback *url.URL) *httptest.ResponseRecorder {
+    return f.serve(callback.Path + "?" + callback.RawQuery)
+}
+
+// linkedUser returns the user the stub identity of email is linked to.
+func (f *flow) linkedUser(email string) models.User {
+    f.t.Helper()
+    ctx := context.Background()
+    userID, err := f.stores.Identities.Find(ctx, f.issuer, "stub|"+email)
+    if err != nil {
+        f.t.Fatalf("identity of %s: %v", email, err)
+    }
+    user, err := f.stores.Users.Get(ctx, userID)
+    if err != nil {
+        f.t.Fatal(err)
+    }
+    return user
+}
+
+func TestLoginCreatesAndReusesUser(t *testing.T) {
+    f := newFlow(t)
+
+    authorize := f.login("ana@example.com")
+    q := authorize.Query()
+    if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("state") == "" || q.Get("nonce") == "" {
+        t.Fatalf("authorization request %s lacks PKCE, state or nonce", authorize)
+    }
+    if rec := f.callback(f.authorize(authorize)); rec.Code != http.StatusOK {
+        t.Fatalf("callback status = %d, body %s", rec.Code, rec.Body)
+    }
+    user := f.linkedUser("ana@example.com")
+    if user.Email != "ana@example.com" || user.Username != "ana" || !user.EmailVerified || user.Role != auth.RoleUser {
+        t.Errorf("created user = %+v", user)
+    }
+
+    if rec := f.callback(f.authorize(f.login("ana@example.com"))); rec.Code != http.StatusOK {
+        t.Fatalf("second callback status = %d, body %s", rec.Code, rec.Body)
+    }
+    if again := f.linkedUser("ana@example.com"); again.ID != user.ID {
+        t.Errorf("second login signed in user %d, want %d", again.ID, user.ID)
+    }
+}
+
+func TestLoginLinksVerifiedAccount(t *testing.T) {
+    f := newFlow(t)
+    existing := models.User{Username: "barista", Email: "bob@example.com", EmailVerified: true, Role: auth.RoleUser}
+    if err := f.stores.Users.Create(context.Background(), &existing); err != nil {
+        t.Fatal(err)
+    }
+
+    if rec := f.callback(f.authorize(f.login("bob@example.com"))); rec.Code != http.StatusOK {
+        t.Fatalf("callback status = %d, body %s", rec.Code, rec.Body)
+    }
+    if linked := f.linkedUser("bob@example.com"); linked.ID != existing.ID {
+        t.Errorf("identity linked to user %d, want %d", linked.ID, existing.ID)
+    }
+}
+
+func setParam(u *url.URL, name, value string) {
+    q := u.Query()
+    q.Set(name, value)
+    u.RawQuery = q.Encode()
+}
+
+func TestCallbackRejectsMismatches(t *testing.T) {
+    tests := []struct {
+        name string
+        // inCallback changes the parameter in the callback instead of the
+        // authorization request.
+        inCallback   bool
+        param, value string
+        status       int
+    }{
+        {"unknown state", true, "state", "forged", http.StatusBadRequest},
+        {"nonce mismatch", false, "nonce", "injected", http.StatusUnauthorized},
+        {"verifier mismatch", false, "code_challenge", oidc.Challenge("another verifier"), http.StatusUnauthorized},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newFlow(t)
+            authorize := f.login("eve@example.com")
+            if !tt.inCallback {
+                setParam(authorize, tt.param, tt.value)
+            }
+            callback := f.authorize(authorize)
+            if tt.inCallback {
+                setParam(callback, tt.param, tt.value)
+            }
+
+            if rec := f.callback(callback); rec.Code != tt.status {
+                t.Errorf("status = %d, want %d, body %s", rec.Code, tt.status, rec.Body)
+            }
+            if _, err := f.stores.Identities.Find(context.Background(), f.issuer, "stub|eve@example.com"); err != store.ErrNotFound {
+                t.Errorf("identity linked despite the mismatch (err %v)", err)
+            }
+        })
+    }
+}
+
+func TestCallbackStateWorksOnce(t *testing.T) {
+    f := newFlow(t)
+    callback := f.authorize(f.login("ana@example.com"))
+    if rec := f.callback(callback); rec.Code != http.StatusOK {
+        t.Fatalf("callback status = %d, body %s", rec.Code, rec.Body)
+    }
+    if rec := f.callback(callback); rec.Code != http.StatusBadRequest {
+        t.Errorf("replayed callback status = %d, want 400", rec.Code)
+    }
+}
+
+func TestCallbackReportsOnlyKnownErrors(t *testing.T) {
+    tests := []struct {
+        name, error, detail string
+    }{
+        {"registered code", "access_denied", "Login at identity provider failed: access_denied"},
+        {"arbitrary text", "Visit https://evil.example to fix your account", "Login at identity provider failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newFlow(t)
+            rec := f.serve("/oidc/stub/callback?state=x&error=" + url.QueryEscape(tt.error))
+            var body struct{ Detail string }
+            if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+                t.Fatal(err)
+            }
+            if rec.Code != http.StatusUnauthorized || body.Detail != tt.detail {
+                t.Errorf("status %d, detail %q; want 401, %q", rec.Code, body.Detail, tt.detail)
+            }
+        })
+    }
+}
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "coffeeApi/services/jwk"
+
+    "github.com/golang-jwt/jwt"
+)
+
+const stubKeyID = "stub"
+
+type stubGrant struct {
+    clientID    string
+    redirectURI string
+    challenge   string
+    nonce       string
+    email       string
+    expires     time.Time
+}
+
+// Stub is a minimal OpenID Connect issuer for development and tests
+// without network access. It signs in whoever asks: the authorization
+// endpoint logs in the address given as login_hint, or user@example.com,
+// and redirects straight back with a code. Any client ID is accepted.
+type Stub struct {
+    Issuer string
+
+    key    *rsa.PrivateKey
+    mu     sync.Mutex
+    grants map[string]stubGrant
+}
+
+func NewStub(issuer string) (*Stub, error) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return nil, err
+    }
+    return &Stub{Issuer: strings.TrimSuffix(issuer, "/"), key: key, grants: map[string]stubGrant{}}, nil
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/.well-known/openid-configuration":
+        writeStubJSON(w, http.StatusOK, discovery{
+            Issuer:                s.Issuer,
+            AuthorizationEndpoint: s.Issuer + "/authorize",
+            TokenEndpoint:         s.Issuer + "/token",
+            JWKSURI:               s.Issuer + "/jwks",
+        })
+    case "/jwks":
+        key, _ := jwk.New(stubKeyID, &s.key.PublicKey)
+        writeStubJSON(w, http.StatusOK, jwk.Set{Keys: []jwk.Key{key}})
+    case "/authorize":
+        s.authorize(w, r)
+    case "/token":
+        s.token(w, r)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func (s *Stub) authorize(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    redirect, err := url.Parse(q.Get("redirect_uri"))
+    if err != nil || redirect.Scheme == "" || q.Get("response_type") != "code" || q.Get("client_id") == "" {
+        http.Error(w, "invalid authorization request", http.StatusBadRequest)
+        return
+    }
+    if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+        http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+        return
+    }
+    email := q.Get("login_hint")
+    if email == "" {
+        email = "user@example.com"
+    }
+    code, err := RandomString(16)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    s.mu.Lock()
+    s.grants[code] = stubGrant{
+        clientID:    q.Get("client_id"),
+        redirectURI: q.Get("redirect_uri"),
+        challenge:   q.Get("code_challenge"),
+        nonce:       q.Get("nonce"),
+        email:       email,
+        expires:     time.Now().Add(time.Minute),
+    }
+    s.mu.Unlock()
+
+    back := redirect.Query()
+    back.Set("code", code)
+    back.Set("state", q.Get("state"))
+    redirect.RawQuery = back.Encode()
+    http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Stub) token(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+        writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+        return
+    }
+    s.mu.Lock()
+    grant, ok := s.grants[r.PostForm.Get("code")]
+    delete(s.grants, r.PostForm.Get("code"))
+    s.mu.Unlock()
+    if !ok || time.Now().After(grant.expires) ||
+        grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+        writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+        return
+    }
+    if Challenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+        writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+        return
+    }
+
+    now := time.Now()
+    token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+        "iss":                s.Issuer,
+        "sub":                "stub|" + strings.ToLower(grant.email),
+        "aud":                grant.clientID,
+        "iat":                now.Unix(),
+        "exp":                now.Add(5 * time.Minute).Unix(),
+        "nonce":              grant.nonce,
+        "email":              grant.email,
+        "email_verified":     true,
+        "preferred_username": strings.SplitN(grant.email, "@", 2)[0],
+    })
+    token.Header["kid"] = stubKeyID
+    idToken, err := token.SignedString(s.key)
+    if err != nil {
+        writeStubJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+        return
+    }
+    writeStubJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": idToken,
+        "token_type":   "Bearer",
+        "expires_in":   300,
+        "id_token":     idToken,
+    })
+}
+
+func writeStubJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,103 @@
+package openapi
+
+import (
+    "bytes"
+    "encoding/json"
+    "strings"
+)
+
+// Example returns an indented example of a value of s, with its fields in
+// declaration order. A request example leaves out read-only fields.
+func (d *Document) Example(s *Schema, request bool) string {
+    var buf bytes.Buffer
+    d.example(&buf, s, request, "", 0)
+    return buf.String()
+}
+
+// maxExampleDepth stops examples of types that refer to themselves.
+const maxExampleDepth = 8
+
+func (d *Document) example(buf *bytes.Buffer, s *Schema, request bool, indent string, depth int) {
+    if s.like != nil {
+        s = s.like
+    }
+    if s.Ref != "" {
+        s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+    }
+    if s == nil || depth > maxExampleDepth {
+        buf.WriteString("null")
+        return
+    }
+    if len(s.OneOf) > 0 {
+        d.example(buf, s.OneOf[0], request, indent, depth)
+        return
+    }
+    switch s.Type {
+    case "object":
+        var names []string
+        for _, name := range s.order {
+            if !(request && s.Properties[name].ReadOnly) {
+                names = append(names, name)
+            }
+        }
+        if len(names) == 0 {
+            buf.WriteString("{}")
+            return
+        }
+        buf.WriteString("{\n")
+        for i, name := range names {
+            key, _ := json.Marshal(name)
+            buf.WriteString(indent + "    ")
+            buf.Write(key)
+            buf.WriteString(": ")
+            d.example(buf, s.Properties[name], request, indent+"    ", depth+1)
+            if i < len(names)-1 {
+                buf.WriteString(",")
+            }
+            buf.WriteString("\n")
+        }
+        buf.WriteString(indent + "}")
+    case "array":
+        if s.Items == nil {
+            buf.WriteString("[]")
+            return
+        }
+        buf.WriteString("[\n" + indent + "    ")
+        d.example(buf, s.Items, request, indent+"    ", depth+1)
+        buf.WriteString("\n" + indent + "]")
+    default:
+        value, _ := json.Marshal(scalarExample(s))
+        buf.Write(value)
+    }
+}
+
+func scalarExample(s *Schema) interface{} {
+    if len(s.Enum) > 0 {
+        return s.Enum[0]
+    }
+    switch s.Type {
+    case "string":
+        switch s.Format {
+        case "date-time":
+            return "2025-01-01T12:00:00Z"
+        case "uri":
+            return "https://example.com"
+        }
+        return "string"
+    case "integer", "number":
+        switch {
+        case s.Minimum != nil && s.Maximum != nil:
+            n := (*s.Minimum + *s.Maximum) / 2
+            if s.Type == "integer" {
+                return int(n)
+            }
+            return n
+        case s.Minimum != nil:
+            return *s.Minimum
+        }
+        return 0
+    case "boolean":
+        return false
+    }
+    return nil
+}
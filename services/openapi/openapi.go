@@ -0,0 +1,412 @@
+// Package openapi builds an OpenAPI 3.1 document from the routes registered
+// on a gorilla/mux router and the Go types their handlers read and write.
+//
+// The router supplies the paths, methods and path parameters; a Route for
+// every method and path adds what the router cannot know, such as the
+// request and response types and who may call it. Schemas are generated by
+// reflection from the json and validate tags of the types, so they follow
+// the models as they change.
+package openapi
+
+import (
+    "fmt"
+    "net/http"
+    "reflect"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gorilla/mux"
+)
+
+// Version is the OpenAPI version of the documents built here.
+const Version = "3.1.0"
+
+// Names of the security schemes of every document.
+const (
+    BearerAuth = "bearerAuth"
+    APIKeyAuth = "apiKeyAuth"
+)
+
+type Document struct {
+    OpenAPI    string              `json:"openapi"`
+    Info       Info                `json:"info"`
+    Servers    []Server            `json:"servers,omitempty"`
+    Tags       []Tag               `json:"tags,omitempty"`
+    Paths      map[string]PathItem `json:"paths"`
+    Components Components          `json:"components"`
+
+    // endpoints lists the operations in the order the routes were
+    // registered.
+    endpoints []Endpoint
+}
+
+type Info struct {
+    Title       string `json:"title"`
+    Description string `json:"description,omitempty"`
+    Version     string `json:"version"`
+}
+
+type Server struct {
+    URL         string `json:"url"`
+    Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path, keyed by lower case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+    Tags        []string              `json:"tags,omitempty"`
+    Summary     string                `json:"summary,omitempty"`
+    Description string                `json:"description,omitempty"`
+    OperationID string                `json:"operationId"`
+    Parameters  []Parameter           `json:"parameters,omitempty"`
+    RequestBody *RequestBody          `json:"requestBody,omitempty"`
+    Responses   map[string]Response   `json:"responses"`
+    Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+    Name        string  `json:"name"`
+    In          string  `json:"in"`
+    Description string  `json:"description,omitempty"`
+    Required    bool    `json:"required,omitempty"`
+    Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+    Required bool                 `json:"required"`
+    Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+    Description string               `json:"description"`
+    Headers     map[string]Header    `json:"headers,omitempty"`
+    Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+    Description string  `json:"description,omitempty"`
+    Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+    Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+    Schemas         map[string]*Schema        `json:"schemas"`
+    SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+    Type         string `json:"type"`
+    Scheme       string `json:"scheme,omitempty"`
+    BearerFormat string `json:"bearerFormat,omitempty"`
+    In           string `json:"in,omitempty"`
+    Name         string `json:"name,omitempty"`
+    Description  string `json:"description,omitempty"`
+}
+
+// Endpoint is one operation of a document with its method and path.
+type Endpoint struct {
+    Method string
+    Path   string
+    *Operation
+}
+
+// Endpoints returns the operations of d in the order their routes were
+// registered.
+func (d *Document) Endpoints() []Endpoint {
+    return d.endpoints
+}
+
+// Access says who may call a route.
+type Access int
+
+const (
+    // Public routes need no credentials.
+    Public Access = iota
+    // Optional routes accept credentials and answer more to callers who
+    // send them.
+    Optional
+    // Authenticated routes need an access token or an API key with Scope.
+    Authenticated
+    // Session routes need an access token; API keys are refused.
+    Session
+    // Admin routes need an admin's access token or an API key of an admin
+    // with Scope.
+    Admin
+)
+
+// Param describes a query, header or path parameter of a route.
+type Param struct {
+    Name string
+    // In is "query" (the default), "header" or "path".
+    In          string
+    Type        string
+    Description string
+    Required    bool
+    Enum        []string
+}
+
+// Route describes the operation behind one method and path of the router.
+type Route struct {
+    Tag         string
+    Summary     string
+    Description string
+    Access      Access
+    // Scope is the API key scope an Authenticated or Admin route needs,
+    // e.g. "coffees:write".
+    Scope string
+    // Params are described in addition to the path parameters, which are
+    // generated from the path unless listed here.
+    Params []Param
+    // Body is a value of the type of the request body, nil for none.
+    Body interface{}
+    // Patch marks a route taking a JSON Merge Patch or a JSON Patch of
+    // Body instead of Body itself.
+    Patch bool
+    // Status is the status of a successful response, 200 when zero.
+    Status int
+    // Response is a value of the type of a successful response, nil when
+    // it has no body or the body is not JSON.
+    Response interface{}
+    // ResponseType is the media type of the response, application/json
+    // when empty.
+    ResponseType string
+    // List marks a response that is one page of a list of Response, with
+    // its total in X-Total-Count and neighbouring pages in Link.
+    List bool
+}
+
+// Spec is everything a document is built from besides the router.
+type Spec struct {
+    Info    Info
+    Servers []Server
+    // Tags lists the tags of the routes in the order they are shown.
+    Tags []Tag
+    // Routes describes every route of the router, keyed by method and
+    // path template, e.g. "GET /coffees/{id}".
+    Routes map[string]Route
+    // Writable lists the JSON fields of a type that clients may set. The
+    // other fields of the type are marked read-only.
+    Writable map[reflect.Type][]string
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(?::[^}]+)?\}`)
+
+// Build describes every route of router. It fails when a route has no
+// entry in s.Routes or an entry has no route, so that the document cannot
+// drift from the router.
+func (s Spec) Build(router *mux.Router) (*Document, error) {
+    d := &Document{
+        OpenAPI: Version,
+        Info:    s.Info,
+        Servers: s.Servers,
+        Tags:    s.Tags,
+        Paths:   map[string]PathItem{},
+        Components: Components{
+            Schemas:         map[string]*Schema{},
+            SecuritySchemes: securitySchemes(),
+        },
+    }
+    g := &generator{schemas: d.Components.Schemas, writable: s.Writable}
+    g.schemas["Problem"] = problemSchema(g)
+    g.schemas["JSONPatch"] = jsonPatchSchema()
+
+    described := map[string]bool{}
+    var missing []string
+    err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+        path, err := route.GetPathTemplate()
+        if err != nil {
+            return nil
+        }
+        methods, err := route.GetMethods()
+        if err != nil {
+            return fmt.Errorf("route %s has no methods", path)
+        }
+        for _, method := range methods {
+            key := method + " " + path
+            r, ok := s.Routes[key]
+            if !ok {
+                missing = append(missing, key)
+                continue
+            }
+            described[key] = true
+            op := g.operation(method, path, r)
+            if d.Paths[path] == nil {
+                d.Paths[path] = PathItem{}
+            }
+            d.Paths[path][strings.ToLower(method)] = op
+            d.endpoints = append(d.endpoints, Endpoint{Method: method, Path: path, Operation: op})
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    for key := range s.Routes {
+        if !described[key] {
+            missing = append(missing, key+" (no such route)")
+        }
+    }
+    if len(missing) > 0 {
+        sort.Strings(missing)
+        return nil, fmt.Errorf("undocumented routes: %s", strings.Join(missing, ", "))
+    }
+    return d, nil
+}
+
+func securitySchemes() map[string]SecurityScheme {
+    return map[string]SecurityScheme{
+        BearerAuth: {
+            Type:         "http",
+            Scheme:       "bearer",
+            BearerFormat: "JWT",
+            Description:  "Access token from POST /login, POST /token/refresh or an OIDC login, sent as \"Authorization: Bearer <token>\". It is valid for 15 minutes.",
+        },
+        APIKeyAuth: {
+            Type:        "apiKey",
+            In:          "header",
+            Name:        "Authorization",
+            Description: "API key from POST /me/api-keys, sent as \"Authorization: ApiKey <key>\". It works only within its scopes.",
+        },
+    }
+}
+
+func (g *generator) operation(method, path string, r Route) *Operation {
+    op := &Operation{
+        Summary:     r.Summary,
+        Description: r.Description,
+        OperationID: operationID(method, path),
+        Responses:   map[string]Response{},
+        Security:    security(r),
+    }
+    if r.Tag != "" {
+        op.Tags = []string{r.Tag}
+    }
+
+    described := map[string]bool{}
+    for _, p := range r.Params {
+        if p.In == "path" {
+            described[p.Name] = true
+        }
+    }
+    for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+        if described[m[1]] {
+            continue
+        }
+        p := Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}}
+        if m[1] == "id" {
+            p.Schema = &Schema{Type: "integer"}
+        }
+        op.Parameters = append(op.Parameters, p)
+    }
+    for _, p := range r.Params {
+        op.Parameters = append(op.Parameters, g.parameter(p))
+    }
+
+    if r.Body != nil {
+        schema := g.schemaOf(reflect.TypeOf(r.Body))
+        op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: schema}}}
+        if r.Patch {
+            op.RequestBody.Content = map[string]MediaType{
+                "application/merge-patch+json": {Schema: &Schema{
+                    Type:        "object",
+                    Description: "Fields of " + typeName(reflect.TypeOf(r.Body)) + " to change; null clears a field.",
+                    like:        schema,
+                }},
+                "application/json-patch+json": {Schema: ref("JSONPatch")},
+            }
+        }
+    }
+
+    status := r.Status
+    if status == 0 {
+        status = http.StatusOK
+    }
+    ok := Response{Description: http.StatusText(status)}
+    if r.Response != nil {
+        schema := g.schemaOf(reflect.TypeOf(r.Response))
+        if r.List {
+            schema = &Schema{Type: "array", Items: schema}
+            ok.Headers = map[string]Header{
+                "X-Total-Count": {Description: "Number of matches on all pages", Schema: &Schema{Type: "integer"}},
+                "Link":          {Description: "Links to the next and previous pages", Schema: &Schema{Type: "string"}},
+            }
+        }
+        mediaType := r.ResponseType
+        if mediaType == "" {
+            mediaType = "application/json"
+        }
+        ok.Content = map[string]MediaType{mediaType: {Schema: schema}}
+    } else if r.ResponseType != "" {
+        ok.Content = map[string]MediaType{r.ResponseType: {Schema: &Schema{Type: "string"}}}
+    }
+    op.Responses[strconv.Itoa(status)] = ok
+    op.Responses["default"] = Response{
+        Description: "Error",
+        Content:     map[string]MediaType{"application/problem+json": {Schema: ref("Problem")}},
+    }
+    return op
+}
+
+func (g *generator) parameter(p Param) Parameter {
+    in := p.In
+    if in == "" {
+        in = "query"
+    }
+    typ := p.Type
+    if typ == "" {
+        typ = "string"
+    }
+    schema := &Schema{Type: typ, Enum: p.Enum}
+    return Parameter{Name: p.Name, In: in, Description: p.Description, Required: p.Required || in == "path", Schema: schema}
+}
+
+func security(r Route) []map[string][]string {
+    scopes := []string{}
+    if r.Scope != "" {
+        scopes = []string{r.Scope}
+    }
+    switch r.Access {
+    case Optional:
+        return []map[string][]string{{}, {BearerAuth: {}}, {APIKeyAuth: {}}}
+    case Authenticated:
+        return []map[string][]string{{BearerAuth: {}}, {APIKeyAuth: scopes}}
+    case Session:
+        return []map[string][]string{{BearerAuth: {}}}
+    case Admin:
+        // OpenAPI 3.1 lets a requirement of a non-OAuth scheme name the
+        // roles it needs.
+        return []map[string][]string{{BearerAuth: {"admin"}}, {APIKeyAuth: scopes}}
+    }
+    return nil
+}
+
+// operationID derives an ID from the method and path, e.g.
+// "getCoffeesById" for GET /coffees/{id}.
+func operationID(method, path string) string {
+    id := strings.ToLower(method)
+    for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' || r == '-' }) {
+        if m := pathParam.FindStringSubmatch(part); m != nil {
+            part = "by" + upperFirst(m[1])
+        }
+        id += upperFirst(part)
+    }
+    return id
+}
+
+func upperFirst(s string) string {
+    if s == "" {
+        return s
+    }
+    return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,242 @@
+package openapi
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "time"
+
+    "coffeeApi/services/problem"
+    "coffeeApi/services/validation"
+)
+
+// Schema is a JSON Schema as used by OpenAPI 3.1. Type and Nullable are
+// encoded together as "type", e.g. ["string", "null"].
+type Schema struct {
+    Ref                  string             `json:"$ref,omitempty"`
+    Type                 string             `json:"-"`
+    Nullable             bool               `json:"-"`
+    Format               string             `json:"format,omitempty"`
+    Description          string             `json:"description,omitempty"`
+    Enum                 []string           `json:"enum,omitempty"`
+    Properties           map[string]*Schema `json:"properties,omitempty"`
+    Required             []string           `json:"required,omitempty"`
+    AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+    Items                *Schema            `json:"items,omitempty"`
+    OneOf                []*Schema          `json:"oneOf,omitempty"`
+    MinItems             *int               `json:"minItems,omitempty"`
+    MaxItems             *int               `json:"maxItems,omitempty"`
+    MinLength            *int               `json:"minLength,omitempty"`
+    MaxLength            *int               `json:"maxLength,omitempty"`
+    Minimum              *float64           `json:"minimum,omitempty"`
+    Maximum              *float64           `json:"maximum,omitempty"`
+    ReadOnly             bool               `json:"readOnly,omitempty"`
+
+    // order lists Properties in the order the fields are declared.
+    order []string
+    // like is the schema examples of s are made from, when s does not say
+    // enough itself.
+    like *Schema
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+    type plain Schema
+    out := struct {
+        Type interface{} `json:"type,omitempty"`
+        *plain
+    }{plain: (*plain)(s)}
+    if s.Type != "" {
+        out.Type = s.Type
+        if s.Nullable {
+            out.Type = []string{s.Type, "null"}
+        }
+    }
+    return json.Marshal(out)
+}
+
+func ref(name string) *Schema {
+    return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+var (
+    timeType       = reflect.TypeOf(time.Time{})
+    rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator turns Go types into schemas. Named structs are added to
+// schemas once and referred to by name.
+type generator struct {
+    schemas  map[string]*Schema
+    writable map[reflect.Type][]string
+}
+
+func typeName(t reflect.Type) string {
+    return upperFirst(t.Name())
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+    switch t {
+    case timeType:
+        return &Schema{Type: "string", Format: "date-time"}
+    case rawMessageType:
+        return &Schema{}
+    }
+    switch t.Kind() {
+    case reflect.Ptr:
+        s := g.schemaOf(t.Elem())
+        if s.Ref != "" {
+            return &Schema{OneOf: []*Schema{s, {Type: "null"}}}
+        }
+        s.Nullable = true
+        return s
+    case reflect.Struct:
+        if t.Name() == "" {
+            return g.object(t)
+        }
+        name := typeName(t)
+        if _, ok := g.schemas[name]; !ok {
+            // The placeholder ends the recursion of types referring to
+            // themselves.
+            g.schemas[name] = &Schema{}
+            *g.schemas[name] = *g.object(t)
+        }
+        return ref(name)
+    case reflect.Slice, reflect.Array:
+        if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+            return &Schema{Type: "string", Format: "byte"}
+        }
+        s := &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+        if t.Kind() == reflect.Array {
+            n := t.Len()
+            s.MinItems, s.MaxItems = &n, &n
+        }
+        return s
+    case reflect.Map:
+        return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+    case reflect.Bool:
+        return &Schema{Type: "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return &Schema{Type: "integer"}
+    case reflect.Float32, reflect.Float64:
+        return &Schema{Type: "number"}
+    case reflect.String:
+        return &Schema{Type: "string"}
+    }
+    return &Schema{}
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+    s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+    g.fields(s, t)
+    return s
+}
+
+// fields adds the JSON fields of the struct type t to s, including those
+// of embedded structs.
+func (g *generator) fields(s *Schema, t reflect.Type) {
+    writable, limited := g.writable[t]
+    var groupOrder []string
+    groups := map[string][]string{}
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if f.Anonymous && f.Tag.Get("json") == "" {
+            embedded := f.Type
+            if embedded.Kind() == reflect.Ptr {
+                embedded = embedded.Elem()
+            }
+            if embedded.Kind() == reflect.Struct {
+                g.fields(s, embedded)
+                continue
+            }
+        }
+        name := validation.JSONName(f)
+        if name == "" {
+            continue
+        }
+        p := g.schemaOf(f.Type)
+        if tag := f.Tag.Get("validate"); tag != "" {
+            rs := validation.ParseRules(tag)
+            constrain(p, rs)
+            if rs.Required {
+                s.Required = append(s.Required, name)
+            }
+            if rs.Group != "" {
+                if _, ok := groups[rs.Group]; !ok {
+                    groupOrder = append(groupOrder, rs.Group)
+                }
+                groups[rs.Group] = append(groups[rs.Group], name)
+            }
+        }
+        if limited && !contains(writable, name) {
+            p.ReadOnly = true
+        }
+        s.Properties[name] = p
+        s.order = append(s.order, name)
+    }
+    for _, group := range groupOrder {
+        names := groups[group]
+        for _, name := range names {
+            s.Properties[name].Description = "Exactly one of " + strings.Join(names, ", ") + " is set."
+        }
+    }
+}
+
+// constrain adds the validate rules of a field to its schema.
+func constrain(s *Schema, rs validation.Rules) {
+    if rs.Integer {
+        s.Type = "integer"
+    }
+    switch s.Type {
+    case "string":
+        s.MinLength, s.MaxLength = toInt(rs.Min), toInt(rs.Max)
+    case "array":
+        s.MinItems, s.MaxItems = toInt(rs.Min), toInt(rs.Max)
+    case "integer", "number":
+        s.Minimum, s.Maximum = rs.Min, rs.Max
+    }
+    if rs.OneOf != nil {
+        s.Enum = rs.OneOf
+    }
+    if rs.URL {
+        s.Format = "uri"
+    }
+}
+
+func toInt(f *float64) *int {
+    if f == nil {
+        return nil
+    }
+    n := int(*f)
+    return &n
+}
+
+func contains(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
+        }
+    }
+    return false
+}
+
+func problemSchema(g *generator) *Schema {
+    s := g.object(reflect.TypeOf(problem.Problem{}))
+    s.Description = "RFC 7807 problem details. code is stable and machine-readable; errors lists the invalid fields of a validation_failed problem."
+    return s
+}
+
+func jsonPatchSchema() *Schema {
+    op := &Schema{
+        Type: "object",
+        Properties: map[string]*Schema{
+            "op":    {Type: "string", Enum: []string{"add", "remove", "replace", "move", "copy", "test"}},
+            "path":  {Type: "string", Description: "JSON Pointer to the target field, e.g. /flavourNotes/-"},
+            "from":  {Type: "string", Description: "JSON Pointer to the source of move and copy"},
+            "value": {Description: "Value of add, replace and test"},
+        },
+        Required: []string{"op", "path"},
+        order:    []string{"op", "path", "value"},
+    }
+    return &Schema{Type: "array", Description: "RFC 6902 JSON Patch", Items: op}
+}
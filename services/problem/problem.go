@@ -0,0 +1,118 @@
+// Package problem writes error responses as RFC 7807 problem details.
+package problem
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+)
+
+// Stable, machine-readable error codes. The detail text of a problem may
+// change between releases, its code does not.
+const (
+    // InvalidRequest: the body, a parameter or an ID could not be parsed.
+    InvalidRequest       = "invalid_request"
+    RequestTooLarge      = "request_too_large"
+    // ValidationFailed: the request was understood but some fields are
+    // invalid; Errors lists them.
+    ValidationFailed     = "validation_failed"
+    Unauthorized         = "unauthorized"
+    InvalidToken         = "invalid_token"
+    InvalidCredentials   = "invalid_credentials"
+    Forbidden            = "forbidden"
+    EmailNotVerified     = "email_not_verified"
+    NotFound             = "not_found"
+    MethodNotAllowed     = "method_not_allowed"
+    Conflict             = "conflict"
+    Duplicate            = "duplicate"
+    StillReferenced      = "still_referenced"
+    ConstraintViolation  = "constraint_violation"
+    PreconditionFailed   = "precondition_failed"
+    PreconditionRequired = "precondition_required"
+    UnsupportedMediaType = "unsupported_media_type"
+    PatchFailed          = "patch_failed"
+    TooManyAttempts      = "too_many_attempts"
+    // UpstreamFailed: an identity provider did not answer.
+    UpstreamFailed       = "upstream_failed"
+    InternalError        = "internal_error"
+)
+
+// RequestIDHeader carries the ID of a request. The RequestID middleware
+// sets it on every response before the handlers run.
+const RequestIDHeader = "X-Request-ID"
+
+// FieldError is one invalid field of a request body.
+type FieldError struct {
+    Field   string `json:"field"`
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object with the extension members
+// code, requestId and errors.
+type Problem struct {
+    Type      string       `json:"type"`
+    Title     string       `json:"title"`
+    Status    int          `json:"status"`
+    Detail    string       `json:"detail,omitempty"`
+    Code      string       `json:"code"`
+    RequestID string       `json:"requestId,omitempty"`
+    Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+    return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail, Code: code}
+}
+
+func Newf(status int, code, format string, args ...interface{}) *Problem {
+    return New(status, code, fmt.Sprintf(format, args...))
+}
+
+func (p *Problem) Error() string {
+    return p.Detail
+}
+
+func Write(w http.ResponseWriter, p *Problem) {
+    p.RequestID = w.Header().Get(RequestIDHeader)
+    w.Header().Set("Content-Type", "application/problem+json")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(p.Status)
+    json.NewEncoder(w).Encode(p)
+}
+
+// Error replies with a problem, like http.Error replies with plain text.
+func Error(w http.ResponseWriter, status int, code, detail string) {
+    Write(w, New(status, code, detail))
+}
+
+// Invalid replies 400 with every invalid field of the request.
+func Invalid(w http.ResponseWriter, errs []FieldError) {
+    p := New(http.StatusBadRequest, ValidationFailed, "The request has invalid fields")
+    p.Errors = errs
+    Write(w, p)
+}
+
+// Log writes err to the server log under the ID of the request w answers.
+func Log(w http.ResponseWriter, err error) {
+    log.Printf("request %s: %v", w.Header().Get(RequestIDHeader), err)
+}
+
+// Internal logs err with the request ID and replies 500 without it, so no
+// driver or library message reaches the client.
+func Internal(w http.ResponseWriter, err error) {
+    Log(w, err)
+    Error(w, http.StatusInternalServerError, InternalError, "Internal server error, quote the request ID when reporting it")
+}
+
+// WriteError replies with err when it is a *Problem and as an internal
+// error otherwise.
+func WriteError(w http.ResponseWriter, err error) {
+    var p *Problem
+    if errors.As(err, &p) {
+        Write(w, p)
+        return
+    }
+    Internal(w, err)
+}
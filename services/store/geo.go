@@ -0,0 +1,109 @@
+package store
+
+import (
+    "fmt"
+    "math"
+)
+
+const earthRadiusKm = 6371.0
+
+type GeoPoint struct {
+    Lat float64
+    Lon float64
+}
+
+// BoundingBox is a map viewport. MinLon greater than MaxLon describes a box
+// that crosses the antimeridian.
+type BoundingBox struct {
+    MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func (b BoundingBox) Contains(lat, lon float64) bool {
+    if lat < b.MinLat || lat > b.MaxLat {
+        return false
+    }
+    if b.MinLon > b.MaxLon {
+        return lon >= b.MinLon || lon <= b.MaxLon
+    }
+    return lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// GeoFilter narrows shops and roasteries by location. When Near is set every
+// row gets a DistanceKm and the list is ordered by distance unless another
+// sort is requested.
+type GeoFilter struct {
+    Near *GeoPoint
+    // RadiusKm limits the distance from Near; zero means no limit.
+    RadiusKm float64
+    BBox     *BoundingBox
+}
+
+// defaultSort returns the sort used when the client asks for none, and
+// rejects combinations that need a reference point.
+func (f GeoFilter) defaultSort(opts ListOptions) ([]SortField, error) {
+    if f.Near != nil {
+        return []SortField{{Field: "distance"}}, nil
+    }
+    if f.RadiusKm != 0 {
+        return nil, fmt.Errorf("%w: radius requires near", ErrInvalidListOptions)
+    }
+    for _, s := range opts.Sort {
+        if s.Field == "distance" {
+            return nil, fmt.Errorf("%w: sorting by distance requires near", ErrInvalidListOptions)
+        }
+    }
+    return defaultSort, nil
+}
+
+// distance reports how far a row is from Near and whether it passes the
+// filter; the memory stores use it in place of the SQL conditions. Rows
+// without resolved coordinates never match a location filter.
+func (f GeoFilter) distance(lat, lon float64, status string) (*float64, bool) {
+    if (f.Near != nil || f.BBox != nil) && status != GeocodeResolved {
+        return nil, false
+    }
+    if f.BBox != nil && !f.BBox.Contains(lat, lon) {
+        return nil, false
+    }
+    if f.Near == nil {
+        return nil, true
+    }
+    d := haversineKm(f.Near.Lat, f.Near.Lon, lat, lon)
+    return &d, f.RadiusKm == 0 || d <= f.RadiusKm
+}
+
+// apply adds the bounding box and radius conditions to q and returns the
+// FROM clause for table, which exposes a distance_km column when Near is set.
+func (f GeoFilter) apply(q *queryBuilder, table string) string {
+    if f.Near != nil || f.BBox != nil {
+        q.where("geocode_status = " + q.arg(GeocodeResolved))
+    }
+    if f.BBox != nil {
+        lons := "lon BETWEEN " + q.arg(f.BBox.MinLon) + " AND " + q.arg(f.BBox.MaxLon)
+        if f.BBox.MinLon > f.BBox.MaxLon {
+            lons = "(lon >= " + q.arg(f.BBox.MinLon) + " OR lon <= " + q.arg(f.BBox.MaxLon) + ")"
+        }
+        q.where("lat BETWEEN " + q.arg(f.BBox.MinLat) + " AND " + q.arg(f.BBox.MaxLat) + " AND " + lons)
+    }
+    if f.Near == nil {
+        return "FROM " + table
+    }
+    lat, lon := q.arg(f.Near.Lat)+"::float8", q.arg(f.Near.Lon)+"::float8"
+    distance := fmt.Sprintf(`%g * 2 * ASIN(LEAST(1, SQRT(
+            POWER(SIN(RADIANS(lat - %s) / 2), 2) +
+            COS(RADIANS(%s)) * COS(RADIANS(lat)) * POWER(SIN(RADIANS(lon - %s) / 2), 2))))`,
+        earthRadiusKm, lat, lat, lon)
+    q.where("lat IS NOT NULL AND lon IS NOT NULL")
+    if f.RadiusKm != 0 {
+        q.where("distance_km <= " + q.arg(f.RadiusKm))
+    }
+    return "FROM (SELECT " + table + ".*, " + distance + " AS distance_km FROM " + table + ") " + table
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+    rad := math.Pi / 180
+    dLat := (lat2 - lat1) * rad
+    dLon := (lon2 - lon1) * rad
+    a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLon/2), 2)
+    return 2 * earthRadiusKm * math.Asin(math.Sqrt(math.Min(1, a)))
+}
@@ -0,0 +1,26 @@
+package store
+
+import "fmt"
+
+// geocodeTables maps GeocodeJob kinds to their tables.
+var geocodeTables = []struct {
+    kind  string
+    table string
+}{
+    {"shop", "shops"},
+    {"roastery", "roasteries"},
+}
+
+func geocodeTable(kind string) (string, error) {
+    for _, t := range geocodeTables {
+        if t.kind == kind {
+            return t.table, nil
+        }
+    }
+    return "", fmt.Errorf("unknown geocode job kind %q", kind)
+}
+
+// jobAddress is the address a job geocodes, in the form the handlers use.
+func jobAddress(address, city, country string) string {
+    return fmt.Sprintf("%s, %s, %s", address, city, country)
+}
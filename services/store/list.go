@@ -0,0 +1,253 @@
+package store
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+)
+
+// ErrInvalidListOptions wraps every problem with a caller-supplied sort or
+// cursor, so handlers can answer 400 instead of 500.
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+type SortField struct {
+    Field string
+    Desc  bool
+}
+
+// ListOptions selects one page of a list. Cursor, when set, continues
+// after the last row of the previous page and cannot be combined with
+// Offset.
+type ListOptions struct {
+    Limit  int
+    Offset int
+    Cursor string
+    Sort   []SortField
+}
+
+type Page[T any] struct {
+    Items []T
+    // Total counts every row matching the filter, ignoring the page bounds.
+    Total      int
+    NextCursor string
+}
+
+// sortKey describes a field clients may sort by: the SQL expression the
+// PostgreSQL stores order on and the matching value of a loaded row, used
+// by the memory stores and to build cursors. Every set of keys must
+// contain "id", which breaks ties.
+type sortKey[T any] struct {
+    column string
+    value  func(T) interface{}
+}
+
+type sortKeys[T any] map[string]sortKey[T]
+
+type resolvedSort[T any] struct {
+    field string
+    key   sortKey[T]
+    desc  bool
+}
+
+// resolve validates the requested sort against the whitelist and appends
+// the id tiebreaker unless the client already sorted by id.
+func (keys sortKeys[T]) resolve(fields []SortField, defaults []SortField) ([]resolvedSort[T], error) {
+    if len(fields) == 0 {
+        fields = defaults
+    }
+    var resolved []resolvedSort[T]
+    hasID := false
+    for _, f := range fields {
+        key, ok := keys[f.Field]
+        if !ok {
+            return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidListOptions, f.Field)
+        }
+        resolved = append(resolved, resolvedSort[T]{field: f.Field, key: key, desc: f.Desc})
+        if f.Field == "id" {
+            hasID = true
+            break
+        }
+    }
+    if !hasID {
+        resolved = append(resolved, resolvedSort[T]{field: "id", key: keys["id"]})
+    }
+    return resolved, nil
+}
+
+func sortSignature[T any](sorts []resolvedSort[T]) string {
+    parts := make([]string, len(sorts))
+    for i, s := range sorts {
+        parts[i] = s.field
+        if s.desc {
+            parts[i] = "-" + s.field
+        }
+    }
+    return strings.Join(parts, ",")
+}
+
+type cursorPayload struct {
+    Sort   string            `json:"s"`
+    Values []json.RawMessage `json:"v"`
+}
+
+// encodeCursor captures the sort values of the last row on a page.
+func encodeCursor[T any](sorts []resolvedSort[T], item T) string {
+    payload := cursorPayload{Sort: sortSignature(sorts)}
+    for _, s := range sorts {
+        value := s.key.value(item)
+        if t, ok := value.(time.Time); ok {
+            value = t.Format(time.RFC3339Nano)
+        }
+        raw, _ := json.Marshal(value)
+        payload.Values = append(payload.Values, raw)
+    }
+    data, _ := json.Marshal(payload)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the values stored in a cursor, typed like the sort
+// keys they belong to.
+func decodeCursor[T any](sorts []resolvedSort[T], cursor string) ([]interface{}, error) {
+    invalid := fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+    data, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return nil, invalid
+    }
+    var payload cursorPayload
+    if err := json.Unmarshal(data, &payload); err != nil {
+        return nil, invalid
+    }
+    if payload.Sort != sortSignature(sorts) || len(payload.Values) != len(sorts) {
+        return nil, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidListOptions)
+    }
+    var zero T
+    values := make([]interface{}, len(sorts))
+    for i, s := range sorts {
+        switch s.key.value(zero).(type) {
+        case string:
+            var v string
+            err = json.Unmarshal(payload.Values[i], &v)
+            values[i] = v
+        case int:
+            var v int
+            err = json.Unmarshal(payload.Values[i], &v)
+            values[i] = v
+        case float64:
+            var v float64
+            err = json.Unmarshal(payload.Values[i], &v)
+            values[i] = v
+        case time.Time:
+            var v time.Time
+            err = json.Unmarshal(payload.Values[i], &v)
+            values[i] = v
+        }
+        if err != nil {
+            return nil, invalid
+        }
+    }
+    return values, nil
+}
+
+func compareValues(a, b interface{}) int {
+    switch av := a.(type) {
+    case string:
+        return strings.Compare(av, b.(string))
+    case int:
+        bv := b.(int)
+        if av < bv {
+            return -1
+        } else if av > bv {
+            return 1
+        }
+    case float64:
+        bv := b.(float64)
+        if av < bv {
+            return -1
+        } else if av > bv {
+            return 1
+        }
+    case time.Time:
+        return av.Compare(b.(time.Time))
+    }
+    return 0
+}
+
+// compareRow orders an item against a tuple of sort values, honouring the
+// direction of every key.
+func compareRow[T any](sorts []resolvedSort[T], item T, values []interface{}) int {
+    for i, s := range sorts {
+        c := compareValues(s.key.value(item), values[i])
+        if s.desc {
+            c = -c
+        }
+        if c != 0 {
+            return c
+        }
+    }
+    return 0
+}
+
+func checkOptions(opts ListOptions) error {
+    if opts.Limit <= 0 {
+        return fmt.Errorf("%w: limit must be positive", ErrInvalidListOptions)
+    }
+    if opts.Offset < 0 {
+        return fmt.Errorf("%w: offset must not be negative", ErrInvalidListOptions)
+    }
+    if opts.Cursor != "" && opts.Offset > 0 {
+        return fmt.Errorf("%w: cursor and offset cannot be combined", ErrInvalidListOptions)
+    }
+    return nil
+}
+
+// paginate sorts already filtered rows in memory and cuts out one page,
+// mirroring what the PostgreSQL stores do in SQL.
+func paginate[T any](items []T, keys sortKeys[T], defaults []SortField, opts ListOptions) (Page[T], error) {
+    if err := checkOptions(opts); err != nil {
+        return Page[T]{}, err
+    }
+    sorts, err := keys.resolve(opts.Sort, defaults)
+    if err != nil {
+        return Page[T]{}, err
+    }
+    sort.SliceStable(items, func(i, j int) bool {
+        for _, s := range sorts {
+            c := compareValues(s.key.value(items[i]), s.key.value(items[j]))
+            if s.desc {
+                c = -c
+            }
+            if c != 0 {
+                return c < 0
+            }
+        }
+        return false
+    })
+
+    page := Page[T]{Items: []T{}, Total: len(items)}
+    start := opts.Offset
+    if opts.Cursor != "" {
+        values, err := decodeCursor(sorts, opts.Cursor)
+        if err != nil {
+            return Page[T]{}, err
+        }
+        start = sort.Search(len(items), func(i int) bool {
+            return compareRow(sorts, items[i], values) > 0
+        })
+    }
+    if start > len(items) {
+        start = len(items)
+    }
+    end := start + opts.Limit
+    if end > len(items) {
+        end = len(items)
+    }
+    page.Items = append(page.Items, items[start:end]...)
+    if end < len(items) && len(page.Items) > 0 {
+        page.NextCursor = encodeCursor(sorts, page.Items[len(page.Items)-1])
+    }
+    return page, nil
+}
@@ -0,0 +1,651 @@
+package store
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+// memoryDB is an in-process stand-in for PostgreSQL that enforces the same
+// foreign keys, cascades and checks, so handlers can be exercised without a
+// database.
+type memoryDB struct {
+    mu         sync.RWMutex
+    coffees    map[int]models.Coffee
+    roasteries map[int]models.Roastery
+    shops      map[int]models.CoffeeShop
+    reviews    map[int]models.Review
+    users      map[int]models.User
+    apiKeys    map[int]models.APIKey
+    lastID     map[string]int
+    // sessions and refreshTokens back the SessionStore.
+    sessions      map[string]memorySession
+    refreshTokens map[string]memoryRefreshToken
+    loginFailures map[string]loginFailure
+    // identities and oidcLogins back the IdentityStore.
+    identities map[identityKey]Identity
+    oidcLogins map[string]PendingLogin
+    // geocodeRetries tracks the attempts of pending shops and roasteries.
+    geocodeRetries map[geocodeKey]geocodeRetry
+}
+
+func NewMemoryStores() Stores {
+    m := &memoryDB{
+        coffees:    map[int]models.Coffee{},
+        roasteries: map[int]models.Roastery{},
+        shops:      map[int]models.CoffeeShop{},
+        reviews:    map[int]models.Review{},
+        users:      map[int]models.User{},
+        apiKeys:    map[int]models.APIKey{},
+        lastID:     map[string]int{},
+
+        sessions:       map[string]memorySession{},
+        refreshTokens:  map[string]memoryRefreshToken{},
+        loginFailures:  map[string]loginFailure{},
+        identities:     map[identityKey]Identity{},
+        oidcLogins:     map[string]PendingLogin{},
+        geocodeRetries: map[geocodeKey]geocodeRetry{},
+    }
+    return Stores{
+        Coffees:    &memoryCoffees{m},
+        Roasteries: &memoryRoasteries{m},
+        Shops:      &memoryShops{m},
+        Reviews:    &memoryReviews{m},
+        Users:      &memoryUsers{m},
+        Sessions:   &memorySessions{m},
+        Logins:     &memoryLoginAttempts{m},
+        APIKeys:    &memoryAPIKeys{m},
+        Identities: &memoryIdentities{m},
+        Search:     &memorySearch{m},
+        Geocoding:  &memoryGeocodeQueue{m},
+    }
+}
+
+// checkVersion is the conditional write check of updates and deletes.
+func checkVersion(current, want int) error {
+    if want != 0 && want != current {
+        return ErrStale
+    }
+    return nil
+}
+
+func (m *memoryDB) nextID(table string) int {
+    m.lastID[table]++
+    return m.lastID[table]
+}
+
+func constraintError(kind ConstraintKind, constraint string) error {
+    message := constraintMessages[constraint]
+    if kind == StillReferenced {
+        message = deleteMessages[constraint]
+    }
+    return &ConstraintError{Kind: kind, Message: message}
+}
+
+func sortedIDs[T any](rows map[int]T) []int {
+    ids := make([]int, 0, len(rows))
+    for id := range rows {
+        ids = append(ids, id)
+    }
+    sort.Ints(ids)
+    return ids
+}
+
+// containsFold mirrors the `column ILIKE '%value%'` filters of the
+// PostgreSQL stores; an empty value matches everything.
+func containsFold(s, value string) bool {
+    return value == "" || strings.Contains(strings.ToLower(s), strings.ToLower(value))
+}
+
+func inRange(rating float32, min, max *float64) bool {
+    if min != nil && float64(rating) < *min {
+        return false
+    }
+    if max != nil && float64(rating) > *max {
+        return false
+    }
+    return true
+}
+
+// deleteReviews emulates ON DELETE CASCADE for the reviews of a deleted
+// target. The caller holds the write lock.
+func (m *memoryDB) deleteReviews(match func(models.Review) bool) {
+    for id, rev := range m.reviews {
+        if match(rev) {
+            delete(m.reviews, id)
+        }
+    }
+}
+
+// averageRating computes the mean rating of the matching reviews. The caller
+// holds the lock.
+func (m *memoryDB) averageRating(match func(models.Review) bool) float32 {
+    var sum float32
+    n := 0
+    for _, rev := range m.reviews {
+        if match(rev) {
+            sum += rev.Rating
+            n++
+        }
+    }
+    if n == 0 {
+        return 0
+    }
+    return sum / float32(n)
+}
+
+func (m *memoryDB) updateAverageRating(coffeeId, roasteryId, coffeeShopId int) {
+    if c, ok := m.coffees[coffeeId]; ok {
+        c.AvgRating = m.averageRating(func(rev models.Review) bool { return rev.CoffeeId == coffeeId })
+        m.coffees[coffeeId] = c
+    }
+    if r, ok := m.roasteries[roasteryId]; ok {
+        r.AvgRating = m.averageRating(func(rev models.Review) bool { return rev.RoasteryId == roasteryId })
+        m.roasteries[roasteryId] = r
+    }
+    if s, ok := m.shops[coffeeShopId]; ok {
+        s.AvgRating = m.averageRating(func(rev models.Review) bool { return rev.CoffeeShopId == coffeeShopId })
+        m.shops[coffeeShopId] = s
+    }
+}
+
+type memoryCoffees struct {
+    m *memoryDB
+}
+
+func (s *memoryCoffees) List(ctx context.Context, f CoffeeFilter, opts ListOptions) (Page[models.Coffee], error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var coffees []models.Coffee
+    for _, id := range sortedIDs(s.m.coffees) {
+        c := s.m.coffees[id]
+        if !containsFold(c.Name, f.Name) ||
+            (f.RoasteryID != 0 && c.RoasteryId != f.RoasteryID) ||
+            !containsFold(c.Country, f.Country) ||
+            !containsFold(c.Region, f.Region) ||
+            !containsFold(c.Farm, f.Farm) ||
+            !containsFold(c.Variety, f.Variety) ||
+            !containsFold(c.Process, f.Process) ||
+            !containsFold(c.RoastProfile, f.RoastProfile) ||
+            !containsFold(strings.Join(c.FlavourNotes, ","), f.Flavour) {
+            continue
+        }
+        coffees = append(coffees, copyCoffee(c))
+    }
+    return paginate(coffees, coffeeSortKeys, defaultSort, opts)
+}
+
+func copyCoffee(c models.Coffee) models.Coffee {
+    if c.FlavourNotes != nil {
+        c.FlavourNotes = append([]string(nil), c.FlavourNotes...)
+    }
+    return c
+}
+
+func (s *memoryCoffees) Get(ctx context.Context, id int) (models.Coffee, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    c, ok := s.m.coffees[id]
+    if !ok {
+        return c, ErrNotFound
+    }
+    return copyCoffee(c), nil
+}
+
+func (s *memoryCoffees) Create(ctx context.Context, c *models.Coffee) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if _, ok := s.m.roasteries[c.RoasteryId]; c.RoasteryId != 0 && !ok {
+        return constraintError(MissingReference, "coffees_roastery_id_fkey")
+    }
+    c.ID = s.m.nextID("coffees")
+    c.AvgRating = 0
+    c.Version, c.UpdatedAt = 1, time.Now()
+    s.m.coffees[c.ID] = copyCoffee(*c)
+    return nil
+}
+
+func (s *memoryCoffees) Update(ctx context.Context, c *models.Coffee) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.coffees[c.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, c.Version); err != nil {
+        return err
+    }
+    if _, ok := s.m.roasteries[c.RoasteryId]; c.RoasteryId != 0 && !ok {
+        return constraintError(MissingReference, "coffees_roastery_id_fkey")
+    }
+    c.AvgRating = existing.AvgRating
+    c.Version, c.UpdatedAt = existing.Version+1, time.Now()
+    s.m.coffees[c.ID] = copyCoffee(*c)
+    return nil
+}
+
+func (s *memoryCoffees) Delete(ctx context.Context, id, version int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.coffees[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, version); err != nil {
+        return err
+    }
+    delete(s.m.coffees, id)
+    s.m.deleteReviews(func(rev models.Review) bool { return rev.CoffeeId == id })
+    return nil
+}
+
+func (s *memoryCoffees) Count(ctx context.Context) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    return len(s.m.coffees), nil
+}
+
+type memoryRoasteries struct {
+    m *memoryDB
+}
+
+func (s *memoryRoasteries) List(ctx context.Context, f RoasteryFilter, opts ListOptions) (Page[models.Roastery], error) {
+    defaults, err := f.GeoFilter.defaultSort(opts)
+    if err != nil {
+        return Page[models.Roastery]{}, err
+    }
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var roasteries []models.Roastery
+    for _, id := range sortedIDs(s.m.roasteries) {
+        r := s.m.roasteries[id]
+        if !containsFold(r.Name, f.Name) ||
+            !containsFold(r.Country, f.Country) ||
+            !containsFold(r.City, f.City) ||
+            !containsFold(r.Address, f.Address) ||
+            !containsFold(r.Website, f.Website) ||
+            !containsFold(r.Description, f.Description) ||
+            !inRange(r.AvgRating, f.MinRating, f.MaxRating) ||
+            (f.GeocodeStatus != "" && r.GeocodeStatus != f.GeocodeStatus) {
+            continue
+        }
+        var ok bool
+        if r.DistanceKm, ok = f.distance(r.Lat, r.Lon, r.GeocodeStatus); !ok {
+            continue
+        }
+        roasteries = append(roasteries, r)
+    }
+    return paginate(roasteries, roasterySortKeys, defaults, opts)
+}
+
+func (s *memoryRoasteries) Get(ctx context.Context, id int) (models.Roastery, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    r, ok := s.m.roasteries[id]
+    if !ok {
+        return r, ErrNotFound
+    }
+    return r, nil
+}
+
+func (s *memoryRoasteries) Create(ctx context.Context, r *models.Roastery) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    r.ID = s.m.nextID("roasteries")
+    r.AvgRating = 0
+    r.Version, r.UpdatedAt = 1, time.Now()
+    r.GeocodeStatus = orDefault(r.GeocodeStatus, GeocodeResolved)
+    r.GeocodeError = ""
+    s.m.roasteries[r.ID] = *r
+    return nil
+}
+
+func (s *memoryRoasteries) Update(ctx context.Context, r *models.Roastery) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.roasteries[r.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, r.Version); err != nil {
+        return err
+    }
+    stored := *r
+    stored.AvgRating = existing.AvgRating
+    stored.Version, stored.UpdatedAt = existing.Version+1, time.Now()
+    stored.GeocodeStatus = orDefault(stored.GeocodeStatus, GeocodeResolved)
+    // The geocoding attempts are kept while the status, address and pin stay.
+    if stored.GeocodeStatus == existing.GeocodeStatus && stored.AddressPending == existing.AddressPending &&
+        stored.Address == existing.Address && stored.City == existing.City && stored.Country == existing.Country &&
+        stored.Lat == existing.Lat && stored.Lon == existing.Lon {
+        stored.GeocodeError = existing.GeocodeError
+    } else {
+        stored.GeocodeError = ""
+        delete(s.m.geocodeRetries, geocodeKey{"roastery", r.ID})
+    }
+    s.m.roasteries[r.ID] = stored
+    *r = stored
+    return nil
+}
+
+func (s *memoryRoasteries) Delete(ctx context.Context, id, version int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.roasteries[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, version); err != nil {
+        return err
+    }
+    for _, c := range s.m.coffees {
+        if c.RoasteryId == id {
+            return constraintError(StillReferenced, "coffees_roastery_id_fkey")
+        }
+    }
+    delete(s.m.roasteries, id)
+    delete(s.m.geocodeRetries, geocodeKey{"roastery", id})
+    s.m.deleteReviews(func(rev models.Review) bool { return rev.RoasteryId == id })
+    return nil
+}
+
+func (s *memoryRoasteries) Count(ctx context.Context) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    return len(s.m.roasteries), nil
+}
+
+type memoryShops struct {
+    m *memoryDB
+}
+
+func (s *memoryShops) List(ctx context.Context, f ShopFilter, opts ListOptions) (Page[models.CoffeeShop], error) {
+    defaults, err := f.GeoFilter.defaultSort(opts)
+    if err != nil {
+        return Page[models.CoffeeShop]{}, err
+    }
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var shops []models.CoffeeShop
+    for _, id := range sortedIDs(s.m.shops) {
+        shop := s.m.shops[id]
+        if !containsFold(shop.Name, f.Name) ||
+            !containsFold(shop.Country, f.Country) ||
+            !containsFold(shop.City, f.City) ||
+            !containsFold(shop.Address, f.Address) ||
+            !containsFold(shop.Website, f.Website) ||
+            (f.GeocodeStatus != "" && shop.GeocodeStatus != f.GeocodeStatus) {
+            continue
+        }
+        var ok bool
+        if shop.DistanceKm, ok = f.distance(shop.Lat, shop.Lon, shop.GeocodeStatus); !ok {
+            continue
+        }
+        shops = append(shops, shop)
+    }
+    return paginate(shops, shopSortKeys, defaults, opts)
+}
+
+func (s *memoryShops) Get(ctx context.Context, id int) (models.CoffeeShop, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    shop, ok := s.m.shops[id]
+    if !ok {
+        return shop, ErrNotFound
+    }
+    return shop, nil
+}
+
+func (s *memoryShops) Create(ctx context.Context, shop *models.CoffeeShop) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    shop.ID = s.m.nextID("shops")
+    shop.AvgRating = 0
+    shop.Version, shop.UpdatedAt = 1, time.Now()
+    shop.GeocodeStatus = orDefault(shop.GeocodeStatus, GeocodeResolved)
+    shop.GeocodeError = ""
+    s.m.shops[shop.ID] = *shop
+    return nil
+}
+
+func (s *memoryShops) Update(ctx context.Context, shop *models.CoffeeShop) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.shops[shop.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, shop.Version); err != nil {
+        return err
+    }
+    stored := *shop
+    stored.AvgRating = existing.AvgRating
+    stored.Version, stored.UpdatedAt = existing.Version+1, time.Now()
+    stored.GeocodeStatus = orDefault(stored.GeocodeStatus, GeocodeResolved)
+    // The geocoding attempts are kept while the status, address and pin stay.
+    if stored.GeocodeStatus == existing.GeocodeStatus && stored.AddressPending == existing.AddressPending &&
+        stored.Address == existing.Address && stored.City == existing.City && stored.Country == existing.Country &&
+        stored.Lat == existing.Lat && stored.Lon == existing.Lon {
+        stored.GeocodeError = existing.GeocodeError
+    } else {
+        stored.GeocodeError = ""
+        delete(s.m.geocodeRetries, geocodeKey{"shop", shop.ID})
+    }
+    s.m.shops[shop.ID] = stored
+    *shop = stored
+    return nil
+}
+
+func (s *memoryShops) Delete(ctx context.Context, id, version int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.shops[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(existing.Version, version); err != nil {
+        return err
+    }
+    delete(s.m.shops, id)
+    delete(s.m.geocodeRetries, geocodeKey{"shop", id})
+    s.m.deleteReviews(func(rev models.Review) bool { return rev.CoffeeShopId == id })
+    return nil
+}
+
+func (s *memoryShops) Count(ctx context.Context) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    return len(s.m.shops), nil
+}
+
+type memoryUsers struct {
+    m *memoryDB
+}
+
+func (s *memoryUsers) Get(ctx context.Context, id int) (models.User, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    u, ok := s.m.users[id]
+    if !ok {
+        return u, ErrNotFound
+    }
+    return u, nil
+}
+
+func (s *memoryUsers) GetByUsername(ctx context.Context, username string) (models.User, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    for _, u := range s.m.users {
+        if u.Username == username {
+            return u, nil
+        }
+    }
+    return models.User{}, ErrNotFound
+}
+
+func (s *memoryUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    for _, u := range s.m.users {
+        if strings.EqualFold(u.Email, email) {
+            return u, nil
+        }
+    }
+    return models.User{}, ErrNotFound
+}
+
+func (s *memoryUsers) Create(ctx context.Context, u *models.User) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if u.Role != "user" && u.Role != "admin" {
+        return constraintError(Invalid, "users_role_check")
+    }
+    for _, existing := range s.m.users {
+        if existing.Username == u.Username {
+            return constraintError(Duplicate, "users_username_key")
+        }
+        if strings.EqualFold(existing.Email, u.Email) {
+            return constraintError(Duplicate, "users_email_key")
+        }
+    }
+    u.ID = s.m.nextID("users")
+    s.m.users[u.ID] = *u
+    return nil
+}
+
+func (s *memoryUsers) List(ctx context.Context, f UserFilter, opts ListOptions) (Page[models.User], error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var items []models.User
+    for _, u := range s.m.users {
+        if containsFold(u.Username, f.Username) && containsFold(u.Email, f.Email) && (f.Role == "" || u.Role == f.Role) {
+            items = append(items, u)
+        }
+    }
+    return paginate(items, userSortKeys, defaultSort, opts)
+}
+
+func (s *memoryUsers) Update(ctx context.Context, u *models.User) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    existing, ok := s.m.users[u.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    for _, other := range s.m.users {
+        if other.ID == u.ID {
+            continue
+        }
+        if other.Username == u.Username {
+            return constraintError(Duplicate, "users_username_key")
+        }
+        if strings.EqualFold(other.Email, u.Email) {
+            return constraintError(Duplicate, "users_email_key")
+        }
+    }
+    if !strings.EqualFold(existing.Email, u.Email) {
+        existing.EmailVerified = false
+    }
+    existing.Username, existing.Email, existing.AvatarURL = u.Username, u.Email, u.AvatarURL
+    s.m.users[u.ID] = existing
+    u.EmailVerified = existing.EmailVerified
+    return nil
+}
+
+func (s *memoryUsers) SetEmailVerified(ctx context.Context, id int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    u, ok := s.m.users[id]
+    if !ok {
+        return ErrNotFound
+    }
+    u.EmailVerified = true
+    s.m.users[id] = u
+    return nil
+}
+
+func (s *memoryUsers) SetPassword(ctx context.Context, id int, hash string) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    u, ok := s.m.users[id]
+    if !ok {
+        return ErrNotFound
+    }
+    u.Password = hash
+    s.m.users[id] = u
+    return nil
+}
+
+func (s *memoryUsers) Delete(ctx context.Context, id int, deleteReviews bool) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if _, ok := s.m.users[id]; !ok {
+        return ErrNotFound
+    }
+    for revID, rev := range s.m.reviews {
+        if rev.UserId != id {
+            continue
+        }
+        if deleteReviews {
+            delete(s.m.reviews, revID)
+            s.m.updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
+        } else {
+            rev.UserId = 0
+            s.m.reviews[revID] = rev
+        }
+    }
+    for sessionID, session := range s.m.sessions {
+        if session.userID == id {
+            delete(s.m.sessions, sessionID)
+        }
+    }
+    for keyID, key := range s.m.apiKeys {
+        if key.UserID == id {
+            delete(s.m.apiKeys, keyID)
+        }
+    }
+    for k, identity := range s.m.identities {
+        if identity.UserID == id {
+            delete(s.m.identities, k)
+        }
+    }
+    delete(s.m.users, id)
+    return nil
+}
+
+func (s *memoryUsers) SetRole(ctx context.Context, c RoleChange) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    u, ok := s.m.users[c.UserID]
+    if !ok {
+        return ErrNotFound
+    }
+    if c.Role != "user" && c.Role != "admin" {
+        return constraintError(Invalid, "users_role_check")
+    }
+    u.Role = c.Role
+    s.m.users[c.UserID] = u
+    return nil
+}
+
+func (s *memoryUsers) Count(ctx context.Context) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    return len(s.m.users), nil
+}
+
+func (s *memoryUsers) CountByRole(ctx context.Context, role string) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    n := 0
+    for _, u := range s.m.users {
+        if u.Role == role {
+            n++
+        }
+    }
+    return n, nil
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+    "context"
+    "sort"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+type memoryAPIKeys struct {
+    m *memoryDB
+}
+
+func (s *memoryAPIKeys) Create(ctx context.Context, k *models.APIKey) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if _, ok := s.m.users[k.UserID]; !ok {
+        return &ConstraintError{Kind: MissingReference, Message: "User not found"}
+    }
+    k.ID = s.m.nextID("api_keys")
+    k.CreatedAt = time.Now()
+    s.m.apiKeys[k.ID] = *k
+    return nil
+}
+
+func (s *memoryAPIKeys) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    keys := []models.APIKey{}
+    for _, k := range s.m.apiKeys {
+        if k.UserID == userID {
+            keys = append(keys, k)
+        }
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+    return keys, nil
+}
+
+func (s *memoryAPIKeys) Revoke(ctx context.Context, userID, id int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if k, ok := s.m.apiKeys[id]; !ok || k.UserID != userID {
+        return ErrNotFound
+    }
+    delete(s.m.apiKeys, id)
+    return nil
+}
+
+func (s *memoryAPIKeys) RevokeUser(ctx context.Context, userID int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    for id, k := range s.m.apiKeys {
+        if k.UserID == userID {
+            delete(s.m.apiKeys, id)
+        }
+    }
+    return nil
+}
+
+func (s *memoryAPIKeys) Use(ctx context.Context, hash string) (models.APIKey, string, error) {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    for id, k := range s.m.apiKeys {
+        if k.Hash != hash {
+            continue
+        }
+        now := time.Now()
+        k.LastUsedAt = &now
+        s.m.apiKeys[id] = k
+        return k, s.m.users[k.UserID].Role, nil
+    }
+    return models.APIKey{}, "", ErrNotFound
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+    "context"
+    "time"
+)
+
+type geocodeKey struct {
+    kind string
+    id   int
+}
+
+type geocodeRetry struct {
+    attempts int
+    next     time.Time
+}
+
+type memoryGeocodeQueue struct {
+    m *memoryDB
+}
+
+// geocodeTarget is the part of a shop or roastery the queue works on.
+type geocodeTarget struct {
+    address        string
+    status         string
+    addressPending bool
+    lat, lon       float64
+    set            func(status, code string, lat, lon *float64)
+    // setAddress fills in the empty address fields and ends the wait for
+    // them.
+    setAddress func(address, city, country string)
+    // touch bumps the version and update time.
+    touch func()
+}
+
+func (t geocodeTarget) pending() bool {
+    return t.status == GeocodePending || t.addressPending
+}
+
+func (s *memoryGeocodeQueue) target(kind string, id int) (geocodeTarget, bool) {
+    switch kind {
+    case "shop":
+        shop, ok := s.m.shops[id]
+        return geocodeTarget{
+            address:        jobAddress(shop.Address, shop.City, shop.Country),
+            status:         shop.GeocodeStatus,
+            addressPending: shop.AddressPending,
+            lat:            shop.Lat,
+            lon:            shop.Lon,
+            set: func(status, code string, lat, lon *float64) {
+                shop.GeocodeStatus, shop.GeocodeError = status, code
+                if lat != nil {
+                    shop.Lat, shop.Lon = *lat, *lon
+                }
+                s.m.shops[id] = shop
+            },
+            setAddress: func(address, city, country string) {
+                fill(&shop.Address, address)
+                fill(&shop.City, city)
+                fill(&shop.Country, country)
+                shop.AddressPending, shop.GeocodeError = false, ""
+                s.m.shops[id] = shop
+            },
+            touch: func() {
+                shop.Version, shop.UpdatedAt = shop.Version+1, time.Now()
+                s.m.shops[id] = shop
+            },
+        }, ok
+    case "roastery":
+        r, ok := s.m.roasteries[id]
+        return geocodeTarget{
+            address:        jobAddress(r.Address, r.City, r.Country),
+            status:         r.GeocodeStatus,
+            addressPending: r.AddressPending,
+            lat:            r.Lat,
+            lon:            r.Lon,
+            set: func(status, code string, lat, lon *float64) {
+                r.GeocodeStatus, r.GeocodeError = status, code
+                if lat != nil {
+                    r.Lat, r.Lon = *lat, *lon
+                }
+                s.m.roasteries[id] = r
+            },
+            setAddress: func(address, city, country string) {
+                fill(&r.Address, address)
+                fill(&r.City, city)
+                fill(&r.Country, country)
+                r.AddressPending, r.GeocodeError = false, ""
+                s.m.roasteries[id] = r
+            },
+            touch: func() {
+                r.Version, r.UpdatedAt = r.Version+1, time.Now()
+                s.m.roasteries[id] = r
+            },
+        }, ok
+    }
+    return geocodeTarget{}, false
+}
+
+func (s *memoryGeocodeQueue) Claim(ctx context.Context, n int, lease time.Duration) ([]GeocodeJob, error) {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    now := time.Now()
+    var jobs []GeocodeJob
+    claim := func(kind string, id int) {
+        t, _ := s.target(kind, id)
+        key := geocodeKey{kind, id}
+        retry := s.m.geocodeRetries[key]
+        if len(jobs) >= n || !t.pending() || retry.next.After(now) {
+            return
+        }
+        jobs = append(jobs, GeocodeJob{Kind: kind, ID: id, Address: t.address, Attempts: retry.attempts, Reverse: t.addressPending, Lat: t.lat, Lon: t.lon})
+        retry.next = now.Add(lease)
+        s.m.geocodeRetries[key] = retry
+    }
+    for _, id := range sortedIDs(s.m.shops) {
+        claim("shop", id)
+    }
+    for _, id := range sortedIDs(s.m.roasteries) {
+        claim("roastery", id)
+    }
+    return jobs, nil
+}
+
+// finish applies update when the job's row is still pending with the same
+// address, and the same pin for a reverse job; a vanished or edited row is
+// not an error. Like an update, it bumps the version.
+func (s *memoryGeocodeQueue) finish(job GeocodeJob, update func(geocodeTarget, *geocodeRetry)) error {
+    if _, err := geocodeTable(job.Kind); err != nil {
+        return err
+    }
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    t, ok := s.target(job.Kind, job.ID)
+    if !ok || t.address != job.Address {
+        return nil
+    }
+    if job.Reverse && !(t.addressPending && t.lat == job.Lat && t.lon == job.Lon) || !job.Reverse && t.status != GeocodePending {
+        return nil
+    }
+    key := geocodeKey{job.Kind, job.ID}
+    retry := s.m.geocodeRetries[key]
+    update(t, &retry)
+    t.touch()
+    s.m.geocodeRetries[key] = retry
+    return nil
+}
+
+func (s *memoryGeocodeQueue) Resolve(ctx context.Context, job GeocodeJob, lat, lon float64) error {
+    return s.finish(job, func(t geocodeTarget, retry *geocodeRetry) {
+        t.set(GeocodeResolved, "", &lat, &lon)
+        *retry = geocodeRetry{attempts: retry.attempts}
+    })
+}
+
+func (s *memoryGeocodeQueue) ResolveAddress(ctx context.Context, job GeocodeJob, address, city, country string) error {
+    return s.finish(job, func(t geocodeTarget, retry *geocodeRetry) {
+        t.setAddress(address, city, country)
+        *retry = geocodeRetry{attempts: retry.attempts}
+    })
+}
+
+func (s *memoryGeocodeQueue) Retry(ctx context.Context, job GeocodeJob, code string, at time.Time) error {
+    return s.finish(job, func(t geocodeTarget, retry *geocodeRetry) {
+        t.set(t.status, code, nil, nil)
+        *retry = geocodeRetry{attempts: retry.attempts + 1, next: at}
+    })
+}
+
+func (s *memoryGeocodeQueue) Fail(ctx context.Context, job GeocodeJob, code string) error {
+    return s.finish(job, func(t geocodeTarget, retry *geocodeRetry) {
+        if job.Reverse {
+            t.setAddress("", "", "")
+            t.set(t.status, code, nil, nil)
+        } else {
+            t.set(GeocodeFailed, code, nil, nil)
+        }
+        *retry = geocodeRetry{attempts: retry.attempts + 1}
+    })
+}
+
+func fill(field *string, value string) {
+    if *field == "" {
+        *field = value
+    }
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+type identityKey struct {
+    issuer, subject string
+}
+
+type memoryIdentities struct {
+    m *memoryDB
+}
+
+func (s *memoryIdentities) Find(ctx context.Context, issuer, subject string) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    id, ok := s.m.identities[identityKey{issuer, subject}]
+    if !ok {
+        return 0, ErrNotFound
+    }
+    return id.UserID, nil
+}
+
+func (s *memoryIdentities) Link(ctx context.Context, id Identity) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    return s.link(id)
+}
+
+func (s *memoryIdentities) link(id Identity) error {
+    if _, ok := s.m.users[id.UserID]; !ok {
+        return &ConstraintError{Kind: MissingReference, Message: "User not found"}
+    }
+    key := identityKey{id.Issuer, id.Subject}
+    if _, ok := s.m.identities[key]; ok {
+        return constraintError(Duplicate, "user_identities_pkey")
+    }
+    s.m.identities[key] = id
+    return nil
+}
+
+func (s *memoryIdentities) CreateUser(ctx context.Context, u *models.User, id Identity) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if _, ok := s.m.identities[identityKey{id.Issuer, id.Subject}]; ok {
+        return constraintError(Duplicate, "user_identities_pkey")
+    }
+    for _, existing := range s.m.users {
+        if existing.Username == u.Username {
+            return constraintError(Duplicate, "users_username_key")
+        }
+        if strings.EqualFold(existing.Email, u.Email) {
+            return constraintError(Duplicate, "users_email_key")
+        }
+    }
+    u.ID = s.m.nextID("users")
+    s.m.users[u.ID] = *u
+    id.UserID = u.ID
+    return s.link(id)
+}
+
+func (s *memoryIdentities) StartLogin(ctx context.Context, l PendingLogin) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    for state, pending := range s.m.oidcLogins {
+        if pending.ExpiresAt.Before(time.Now()) {
+            delete(s.m.oidcLogins, state)
+        }
+    }
+    s.m.oidcLogins[l.State] = l
+    return nil
+}
+
+func (s *memoryIdentities) FinishLogin(ctx context.Context, state string) (PendingLogin, error) {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    l, ok := s.m.oidcLogins[state]
+    delete(s.m.oidcLogins, state)
+    if !ok || l.ExpiresAt.Before(time.Now()) {
+        return PendingLogin{}, ErrNotFound
+    }
+    return l, nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+    "context"
+    "time"
+)
+
+type loginFailure struct {
+    failures    int
+    last        time.Time
+    lockedUntil time.Time
+}
+
+type memoryLoginAttempts struct {
+    m *memoryDB
+}
+
+func (s *memoryLoginAttempts) Locked(ctx context.Context, keys ...string) (time.Duration, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var longest time.Duration
+    for _, key := range keys {
+        if left := time.Until(s.m.loginFailures[key].lockedUntil); left > longest {
+            longest = left
+        }
+    }
+    return longest, nil
+}
+
+func (s *memoryLoginAttempts) Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (time.Duration, error) {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    now := time.Now()
+    f := s.m.loginFailures[key]
+    if now.Sub(f.last) > window {
+        f.failures = 0
+    }
+    f.failures++
+    f.last = now
+    lock := lockFor(f.failures)
+    if lock > 0 {
+        f.lockedUntil = now.Add(lock)
+    }
+    s.m.loginFailures[key] = f
+    return lock, nil
+}
+
+func (s *memoryLoginAttempts) Reset(ctx context.Context, key string) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    delete(s.m.loginFailures, key)
+    return nil
+}
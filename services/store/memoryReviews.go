@@ -0,0 +1,194 @@
+package store
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+type memoryReviews struct {
+    m *memoryDB
+}
+
+// response joins a review with the names of its author and target, as the
+// LEFT JOINs of the PostgreSQL store do. The caller holds the lock.
+func (s *memoryReviews) response(rev models.Review) models.ReviewResponse {
+    resp := models.ReviewResponse{
+        ID:             rev.ID,
+        UserId:         rev.UserId,
+        UserName:       "Anonymous User",
+        CoffeeId:       rev.CoffeeId,
+        RoasteryId:     rev.RoasteryId,
+        CoffeeShopId:   rev.CoffeeShopId,
+        Rating:         rev.Rating,
+        Review:         rev.Review,
+        DateOfCreation: rev.DateOfCreation,
+        TargetType:     models.ReviewTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId),
+        TargetName:     "Unknown",
+        Version:        rev.Version,
+        UpdatedAt:      rev.UpdatedAt,
+    }
+    if u, ok := s.m.users[rev.UserId]; ok {
+        resp.UserName = u.Username
+    }
+    if c, ok := s.m.coffees[rev.CoffeeId]; ok {
+        resp.CoffeeName = c.Name
+        resp.TargetName = c.Name
+    }
+    if r, ok := s.m.roasteries[rev.RoasteryId]; ok {
+        resp.RoasteryName = r.Name
+        resp.TargetName = r.Name
+    }
+    if shop, ok := s.m.shops[rev.CoffeeShopId]; ok {
+        resp.CoffeeShopName = shop.Name
+        resp.TargetName = shop.Name
+    }
+    return resp
+}
+
+func (s *memoryReviews) matches(rev models.Review, f ReviewFilter) bool {
+    if (f.UserID != 0 && rev.UserId != f.UserID) ||
+        (f.CoffeeID != 0 && rev.CoffeeId != f.CoffeeID) ||
+        (f.RoasteryID != 0 && rev.RoasteryId != f.RoasteryID) ||
+        (f.CoffeeShopID != 0 && rev.CoffeeShopId != f.CoffeeShopID) ||
+        !inRange(rev.Rating, f.MinRating, f.MaxRating) {
+        return false
+    }
+    if f.FromDate != nil && rev.DateOfCreation.Before(*f.FromDate) {
+        return false
+    }
+    if f.ToDate != nil && rev.DateOfCreation.After(f.ToDate.Add(24*time.Hour)) {
+        return false
+    }
+
+    if f.CoffeeCountry != "" || f.CoffeeProcess != "" || f.CoffeeRoastProfile != "" || f.CoffeeFlavour != "" {
+        c, ok := s.m.coffees[rev.CoffeeId]
+        if !ok || !containsFold(c.Country, f.CoffeeCountry) || !containsFold(c.Process, f.CoffeeProcess) ||
+            !containsFold(c.RoastProfile, f.CoffeeRoastProfile) || !containsFold(strings.Join(c.FlavourNotes, ","), f.CoffeeFlavour) {
+            return false
+        }
+    }
+    if f.RoasteryCountry != "" || f.RoasteryCity != "" {
+        r, ok := s.m.roasteries[rev.RoasteryId]
+        if !ok || !containsFold(r.Country, f.RoasteryCountry) || !containsFold(r.City, f.RoasteryCity) {
+            return false
+        }
+    }
+    if f.ShopCountry != "" || f.ShopCity != "" {
+        shop, ok := s.m.shops[rev.CoffeeShopId]
+        if !ok || !containsFold(shop.Country, f.ShopCountry) || !containsFold(shop.City, f.ShopCity) {
+            return false
+        }
+    }
+    return true
+}
+
+func (s *memoryReviews) List(ctx context.Context, f ReviewFilter, opts ListOptions) (Page[models.ReviewResponse], error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    var reviews []models.ReviewResponse
+    for _, rev := range s.m.reviews {
+        if s.matches(rev, f) {
+            reviews = append(reviews, s.response(rev))
+        }
+    }
+    return paginate(reviews, reviewSortKeys, defaultReviewSort, opts)
+}
+
+func (s *memoryReviews) Get(ctx context.Context, id int) (models.ReviewResponse, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    rev, ok := s.m.reviews[id]
+    if !ok {
+        return models.ReviewResponse{}, ErrNotFound
+    }
+    return s.response(rev), nil
+}
+
+// check enforces the constraints the reviews table declares. The caller
+// holds the lock.
+func (s *memoryReviews) check(rev *models.Review) error {
+    targets := 0
+    for _, id := range []int{rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId} {
+        if id != 0 {
+            targets++
+        }
+    }
+    if targets != 1 {
+        return constraintError(Invalid, "reviews_single_target")
+    }
+    if rev.Rating < 1 || rev.Rating > 5 {
+        return constraintError(Invalid, "reviews_rating_range")
+    }
+    if _, ok := s.m.users[rev.UserId]; rev.UserId != 0 && !ok {
+        return constraintError(MissingReference, "reviews_user_id_fkey")
+    }
+    if _, ok := s.m.coffees[rev.CoffeeId]; rev.CoffeeId != 0 && !ok {
+        return constraintError(MissingReference, "reviews_coffee_id_fkey")
+    }
+    if _, ok := s.m.roasteries[rev.RoasteryId]; rev.RoasteryId != 0 && !ok {
+        return constraintError(MissingReference, "reviews_roastery_id_fkey")
+    }
+    if _, ok := s.m.shops[rev.CoffeeShopId]; rev.CoffeeShopId != 0 && !ok {
+        return constraintError(MissingReference, "reviews_coffee_shop_id_fkey")
+    }
+    return nil
+}
+
+func (s *memoryReviews) Create(ctx context.Context, rev *models.Review) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if err := s.check(rev); err != nil {
+        return err
+    }
+    rev.ID = s.m.nextID("reviews")
+    rev.Version, rev.UpdatedAt = 1, time.Now()
+    s.m.reviews[rev.ID] = *rev
+    s.m.updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
+    return nil
+}
+
+func (s *memoryReviews) Update(ctx context.Context, rev *models.Review) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    stored, ok := s.m.reviews[rev.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(stored.Version, rev.Version); err != nil {
+        return err
+    }
+    stored.Rating = rev.Rating
+    stored.Review = rev.Review
+    stored.Version, stored.UpdatedAt = stored.Version+1, time.Now()
+    if err := s.check(&stored); err != nil {
+        return err
+    }
+    s.m.reviews[rev.ID] = stored
+    *rev = stored
+    s.m.updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
+    return nil
+}
+
+func (s *memoryReviews) Delete(ctx context.Context, id, version int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    rev, ok := s.m.reviews[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if err := checkVersion(rev.Version, version); err != nil {
+        return err
+    }
+    delete(s.m.reviews, id)
+    s.m.updateAverageRating(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
+    return nil
+}
+
+func (s *memoryReviews) Count(ctx context.Context) (int, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    return len(s.m.reviews), nil
+}
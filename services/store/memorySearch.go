@@ -0,0 +1,105 @@
+package store
+
+import (
+    "context"
+    "html"
+    "slices"
+    "strings"
+    "unicode"
+
+    "coffeeApi/services/models"
+)
+
+type memorySearch struct {
+    m *memoryDB
+}
+
+// searchField is a piece of searchable text with the weight PostgreSQL's
+// ts_rank_cd gives its setweight label by default (A=1.0, B=0.4, C=0.2).
+type searchField struct {
+    text   string
+    weight float64
+}
+
+func searchWords(text string) []string {
+    return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+}
+
+// memoryScore approximates the PostgreSQL ranking with whole-word matches:
+// every term must occur, and each adds the weight of the best field it
+// occurs in. The configuration is ignored, as with "simple".
+func memoryScore(terms []string, fields []searchField) (float64, bool) {
+    score := 0.0
+    for _, term := range terms {
+        best := 0.0
+        for _, f := range fields {
+            for _, word := range searchWords(f.text) {
+                if word == term && f.weight > best {
+                    best = f.weight
+                }
+            }
+        }
+        if best == 0 {
+            return 0, false
+        }
+        score += best
+    }
+    return score, true
+}
+
+// memorySnippet escapes the joined fields as HTML and wraps their matched
+// words in <mark>.
+func memorySnippet(terms []string, fields []searchField) string {
+    var words []string
+    for _, f := range fields {
+        for _, word := range strings.Fields(f.text) {
+            escaped := html.EscapeString(word)
+            for _, term := range terms {
+                if slices.Contains(searchWords(word), term) {
+                    escaped = "<mark>" + escaped + "</mark>"
+                    break
+                }
+            }
+            words = append(words, escaped)
+        }
+    }
+    return strings.Join(words, " ")
+}
+
+func (s *memorySearch) Search(ctx context.Context, q SearchQuery, opts ListOptions) (Page[models.SearchResult], error) {
+    _, sources, err := resolveSearch(q, opts)
+    if err != nil {
+        return Page[models.SearchResult]{}, err
+    }
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+
+    terms := searchWords(q.Text)
+    results := []models.SearchResult{}
+    add := func(kind string, id int, name string, fields []searchField) {
+        if score, ok := memoryScore(terms, fields); ok && len(terms) > 0 {
+            results = append(results, models.SearchResult{
+                Type: kind, ID: id, Name: name, Score: score, Snippet: memorySnippet(terms, fields),
+            })
+        }
+    }
+    for _, src := range sources {
+        switch src.kind {
+        case SearchCoffee:
+            for _, c := range s.m.coffees {
+                add(src.kind, c.ID, c.Name, []searchField{{c.Name, 1}, {strings.Join(c.FlavourNotes, " "), 0.4}, {c.Description, 0.2}})
+            }
+        case SearchRoastery:
+            for _, r := range s.m.roasteries {
+                add(src.kind, r.ID, r.Name, []searchField{{r.Name, 1}, {r.City, 0.4}, {r.Description, 0.2}})
+            }
+        case SearchShop:
+            for _, shop := range s.m.shops {
+                add(src.kind, shop.ID, shop.Name, []searchField{{shop.Name, 1}, {shop.City, 0.4}, {shop.Description, 0.2}})
+            }
+        }
+    }
+    return paginate(results, searchSortKeys, searchSort, opts)
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+    "context"
+    "time"
+)
+
+type memorySession struct {
+    userID  int
+    revoked bool
+}
+
+type memoryRefreshToken struct {
+    RefreshToken
+    used bool
+}
+
+type memorySessions struct {
+    m *memoryDB
+}
+
+func (s *memorySessions) Start(ctx context.Context, t RefreshToken) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    if _, ok := s.m.users[t.UserID]; !ok {
+        return &ConstraintError{Kind: MissingReference, Message: "User not found"}
+    }
+    if _, ok := s.m.sessions[t.SessionID]; ok {
+        return &ConstraintError{Kind: Duplicate, Message: "Session already exists"}
+    }
+    s.m.sessions[t.SessionID] = memorySession{userID: t.UserID}
+    s.m.refreshTokens[t.Hash] = memoryRefreshToken{RefreshToken: t}
+    return nil
+}
+
+func (s *memorySessions) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (RefreshToken, error) {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    old, ok := s.m.refreshTokens[oldHash]
+    if !ok {
+        return RefreshToken{}, ErrNotFound
+    }
+    session, ok := s.m.sessions[old.SessionID]
+    if !ok || session.revoked || old.ExpiresAt.Before(time.Now()) {
+        return RefreshToken{}, ErrNotFound
+    }
+    if old.used {
+        session.revoked = true
+        s.m.sessions[old.SessionID] = session
+        return RefreshToken{}, ErrTokenReused
+    }
+    old.used = true
+    s.m.refreshTokens[oldHash] = old
+    t := RefreshToken{Hash: newHash, SessionID: old.SessionID, UserID: session.userID, ExpiresAt: expiresAt}
+    s.m.refreshTokens[newHash] = memoryRefreshToken{RefreshToken: t}
+    return t, nil
+}
+
+func (s *memorySessions) Revoke(ctx context.Context, sessionID string) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    session, ok := s.m.sessions[sessionID]
+    if !ok {
+        return ErrNotFound
+    }
+    session.revoked = true
+    s.m.sessions[sessionID] = session
+    return nil
+}
+
+func (s *memorySessions) RevokeUser(ctx context.Context, userID int) error {
+    s.m.mu.Lock()
+    defer s.m.mu.Unlock()
+    for id, session := range s.m.sessions {
+        if session.userID == userID {
+            session.revoked = true
+            s.m.sessions[id] = session
+        }
+    }
+    return nil
+}
+
+func (s *memorySessions) Active(ctx context.Context, sessionID string) (bool, error) {
+    s.m.mu.RLock()
+    defer s.m.mu.RUnlock()
+    session, ok := s.m.sessions[sessionID]
+    return ok && !session.revoked, nil
+}
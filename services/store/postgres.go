@@ -0,0 +1,244 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/lib/pq"
+)
+
+func NewPostgresStores(db *sql.DB) Stores {
+    return Stores{
+        Coffees:    &postgresCoffees{db: db},
+        Roasteries: &postgresRoasteries{db: db},
+        Shops:      &postgresShops{db: db},
+        Reviews:    &postgresReviews{db: db},
+        Users:      &postgresUsers{db: db},
+        Sessions:   &postgresSessions{db: db},
+        Logins:     &postgresLoginAttempts{db: db},
+        APIKeys:    &postgresAPIKeys{db: db},
+        Identities: &postgresIdentities{db: db},
+        Search:     &postgresSearch{db: db},
+        Geocoding:  &postgresGeocodeQueue{db: db},
+    }
+}
+
+// queryBuilder collects WHERE conditions together with their positional
+// arguments.
+type queryBuilder struct {
+    conditions []string
+    args       []interface{}
+}
+
+func (q *queryBuilder) arg(value interface{}) string {
+    q.args = append(q.args, value)
+    return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *queryBuilder) where(condition string) {
+    q.conditions = append(q.conditions, condition)
+}
+
+func (q *queryBuilder) ilike(column, value string) {
+    if value != "" {
+        q.where(column + " ILIKE " + q.arg("%"+value+"%"))
+    }
+}
+
+func (q *queryBuilder) equals(column string, id int) {
+    if id != 0 {
+        q.where(column + " = " + q.arg(id))
+    }
+}
+
+func (q *queryBuilder) equalsText(column, value string) {
+    if value != "" {
+        q.where(column + " = " + q.arg(value))
+    }
+}
+
+func (q *queryBuilder) clause() string {
+    if len(q.conditions) == 0 {
+        return ""
+    }
+    return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// translateError turns PostgreSQL integrity violations of an INSERT or
+// UPDATE into ConstraintErrors and passes every other error through
+// unchanged.
+func translateError(err error) error {
+    return translateConstraint(err, false)
+}
+
+// translateDeleteError is translateError for a DELETE, where a foreign key
+// violation means the row is still referenced by others.
+func translateDeleteError(err error) error {
+    return translateConstraint(err, true)
+}
+
+// translateConstraint tells the two kinds of foreign key violations apart
+// by the statement that caused them; the server's message is localized.
+func translateConstraint(err error, deleting bool) error {
+    var pqErr *pq.Error
+    if !errors.As(err, &pqErr) {
+        return err
+    }
+    message := constraintMessages[pqErr.Constraint]
+    switch pqErr.Code {
+    case "23503": // foreign_key_violation
+        if deleting {
+            return &ConstraintError{Kind: StillReferenced, Message: orDefault(deleteMessages[pqErr.Constraint], "Resource is still referenced by other records")}
+        }
+        return &ConstraintError{Kind: MissingReference, Message: orDefault(message, "Referenced resource not found")}
+    case "23505": // unique_violation
+        return &ConstraintError{Kind: Duplicate, Message: orDefault(message, "Resource already exists")}
+    case "23514": // check_violation
+        return &ConstraintError{Kind: Invalid, Message: orDefault(message, "Constraint violation")}
+    }
+    return err
+}
+
+func orDefault(value, def string) string {
+    if value == "" {
+        return def
+    }
+    return value
+}
+
+// nullableID stores the zero ID used by the JSON payloads as SQL NULL.
+func nullableID(id int) interface{} {
+    if id == 0 {
+        return nil
+    }
+    return id
+}
+
+// listRows runs a filtered SELECT and returns the page selected by opts,
+// together with the total number of matching rows.
+func listRows[T any](ctx context.Context, db *sql.DB, columns, from string, q *queryBuilder, keys sortKeys[T], defaults []SortField, opts ListOptions, scan func(rowScanner) (T, error)) (Page[T], error) {
+    if err := checkOptions(opts); err != nil {
+        return Page[T]{}, err
+    }
+    sorts, err := keys.resolve(opts.Sort, defaults)
+    if err != nil {
+        return Page[T]{}, err
+    }
+
+    page := Page[T]{Items: []T{}}
+    if err := db.QueryRowContext(ctx, "SELECT COUNT(*) "+from+q.clause(), q.args...).Scan(&page.Total); err != nil {
+        return Page[T]{}, err
+    }
+
+    if opts.Cursor != "" {
+        values, err := decodeCursor(sorts, opts.Cursor)
+        if err != nil {
+            return Page[T]{}, err
+        }
+        q.where(keysetCondition(q, sorts, values))
+    }
+    order := make([]string, len(sorts))
+    for i, s := range sorts {
+        order[i] = s.key.column + " ASC"
+        if s.desc {
+            order[i] = s.key.column + " DESC"
+        }
+    }
+    // One extra row tells whether another page follows.
+    query := "SELECT " + columns + " " + from + q.clause() + " ORDER BY " + strings.Join(order, ", ") + " LIMIT " + q.arg(opts.Limit+1)
+    if opts.Offset > 0 {
+        query += " OFFSET " + q.arg(opts.Offset)
+    }
+
+    rows, err := db.QueryContext(ctx, query, q.args...)
+    if err != nil {
+        return Page[T]{}, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        item, err := scan(rows)
+        if err != nil {
+            return Page[T]{}, err
+        }
+        page.Items = append(page.Items, item)
+    }
+    if err := rows.Err(); err != nil {
+        return Page[T]{}, err
+    }
+    if len(page.Items) > opts.Limit {
+        page.Items = page.Items[:opts.Limit]
+        page.NextCursor = encodeCursor(sorts, page.Items[opts.Limit-1])
+    }
+    return page, nil
+}
+
+// keysetCondition selects the rows that sort after the cursor values:
+// (a > $1) OR (a = $1 AND b > $2) ..., with < for descending keys.
+func keysetCondition[T any](q *queryBuilder, sorts []resolvedSort[T], values []interface{}) string {
+    alternatives := make([]string, len(sorts))
+    for i, s := range sorts {
+        parts := make([]string, 0, i+1)
+        for j := 0; j < i; j++ {
+            parts = append(parts, sorts[j].key.column+" = "+q.arg(values[j]))
+        }
+        op := " > "
+        if s.desc {
+            op = " < "
+        }
+        parts = append(parts, s.key.column+op+q.arg(values[i]))
+        alternatives[i] = "(" + strings.Join(parts, " AND ") + ")"
+    }
+    return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// execAffected runs a single-row UPDATE and reports ErrNotFound
+// when no row matched.
+func execAffected(ctx context.Context, db *sql.DB, query string, args ...interface{}) error {
+    return execAffectedWith(ctx, db, translateError, query, args...)
+}
+
+// deleteAffected is execAffected for a DELETE.
+func deleteAffected(ctx context.Context, db *sql.DB, query string, args ...interface{}) error {
+    return execAffectedWith(ctx, db, translateDeleteError, query, args...)
+}
+
+func execAffectedWith(ctx context.Context, db *sql.DB, translate func(error) error, query string, args ...interface{}) error {
+    result, err := db.ExecContext(ctx, query, args...)
+    if err != nil {
+        return translate(err)
+    }
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rowsAffected == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+type queryRower interface {
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// missingOrStale tells why a conditional write to the row id of table
+// matched nothing: ErrStale when the row exists, ErrNotFound otherwise.
+func missingOrStale(ctx context.Context, db queryRower, table string, id int) error {
+    var exists bool
+    if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, id).Scan(&exists); err != nil {
+        return err
+    }
+    if exists {
+        return ErrStale
+    }
+    return ErrNotFound
+}
+
+func count(ctx context.Context, db *sql.DB, table string) (int, error) {
+    var n int
+    err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n)
+    return n, err
+}
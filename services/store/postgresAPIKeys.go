@@ -0,0 +1,80 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+
+    "coffeeApi/services/models"
+
+    "github.com/lib/pq"
+)
+
+type postgresAPIKeys struct {
+    db *sql.DB
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, created_at, last_used_at`
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+    var k models.APIKey
+    var lastUsed sql.NullTime
+    err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.CreatedAt, &lastUsed)
+    if err == sql.ErrNoRows {
+        return k, ErrNotFound
+    }
+    if lastUsed.Valid {
+        k.LastUsedAt = &lastUsed.Time
+    }
+    return k, err
+}
+
+func (s *postgresAPIKeys) Create(ctx context.Context, k *models.APIKey) error {
+    err := s.db.QueryRowContext(ctx, `
+        INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at`,
+        k.UserID, k.Name, k.Prefix, k.Hash, pq.Array(k.Scopes),
+    ).Scan(&k.ID, &k.CreatedAt)
+    return translateError(err)
+}
+
+func (s *postgresAPIKeys) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+    rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY id`, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    keys := []models.APIKey{}
+    for rows.Next() {
+        k, err := scanAPIKey(rows)
+        if err != nil {
+            return nil, err
+        }
+        keys = append(keys, k)
+    }
+    return keys, rows.Err()
+}
+
+func (s *postgresAPIKeys) Revoke(ctx context.Context, userID, id int) error {
+    return deleteAffected(ctx, s.db, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+}
+
+func (s *postgresAPIKeys) RevokeUser(ctx context.Context, userID int) error {
+    _, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, userID)
+    return err
+}
+
+func (s *postgresAPIKeys) Use(ctx context.Context, hash string) (models.APIKey, string, error) {
+    var role string
+    var k models.APIKey
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE api_keys k SET last_used_at = now()
+        FROM users u
+        WHERE k.key_hash = $1 AND u.id = k.user_id
+        RETURNING k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_at, k.last_used_at, u.role`,
+        hash,
+    ).Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.CreatedAt, &k.LastUsedAt, &role)
+    if err == sql.ErrNoRows {
+        return k, "", ErrNotFound
+    }
+    return k, role, err
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+
+    "coffeeApi/services/models"
+)
+
+type postgresCoffees struct {
+    db *sql.DB
+}
+
+const coffeeColumns = `id, name, COALESCE(roastery_id, 0), country, region, farm, variety, process, roast_profile, flavour_notes, description, avg_rating, version, updated_at`
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+func scanCoffee(row rowScanner) (models.Coffee, error) {
+    var c models.Coffee
+    var notes string
+    if err := row.Scan(&c.ID, &c.Name, &c.RoasteryId, &c.Country, &c.Region, &c.Farm, &c.Variety, &c.Process, &c.RoastProfile, &notes, &c.Description, &c.AvgRating, &c.Version, &c.UpdatedAt); err != nil {
+        return c, err
+    }
+    if notes != "" {
+        c.FlavourNotes = strings.Split(notes, ",")
+    }
+    return c, nil
+}
+
+func (s *postgresCoffees) List(ctx context.Context, f CoffeeFilter, opts ListOptions) (Page[models.Coffee], error) {
+    q := &queryBuilder{}
+    q.ilike("name", f.Name)
+    q.equals("roastery_id", f.RoasteryID)
+    q.ilike("country", f.Country)
+    q.ilike("region", f.Region)
+    q.ilike("farm", f.Farm)
+    q.ilike("variety", f.Variety)
+    q.ilike("process", f.Process)
+    q.ilike("roast_profile", f.RoastProfile)
+    q.ilike("flavour_notes", f.Flavour)
+
+    return listRows(ctx, s.db, coffeeColumns, "FROM coffees", q, coffeeSortKeys, defaultSort, opts, scanCoffee)
+}
+
+func (s *postgresCoffees) Get(ctx context.Context, id int) (models.Coffee, error) {
+    c, err := scanCoffee(s.db.QueryRowContext(ctx, `SELECT `+coffeeColumns+` FROM coffees WHERE id = $1`, id))
+    if err == sql.ErrNoRows {
+        return c, ErrNotFound
+    }
+    return c, err
+}
+
+func (s *postgresCoffees) Create(ctx context.Context, c *models.Coffee) error {
+    notes := strings.Join(c.FlavourNotes, ",")
+    err := s.db.QueryRowContext(ctx, `INSERT INTO coffees (name, roastery_id, country, region, farm, variety, process, roast_profile, flavour_notes, description) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id, version, updated_at`,
+        c.Name, nullableID(c.RoasteryId), c.Country, c.Region, c.Farm, c.Variety, c.Process, c.RoastProfile, notes, c.Description).Scan(&c.ID, &c.Version, &c.UpdatedAt)
+    if err != nil {
+        return translateError(err)
+    }
+    c.AvgRating = 0
+    return nil
+}
+
+func (s *postgresCoffees) Update(ctx context.Context, c *models.Coffee) error {
+    notes := strings.Join(c.FlavourNotes, ",")
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE coffees SET name=$1, roastery_id=$2, country=$3, region=$4, farm=$5, variety=$6, process=$7, roast_profile=$8, flavour_notes=$9, description=$10,
+            version = version + 1, updated_at = now()
+        WHERE id=$11 AND ($12 = 0 OR version = $12)
+        RETURNING avg_rating, version, updated_at`,
+        c.Name, nullableID(c.RoasteryId), c.Country, c.Region, c.Farm, c.Variety, c.Process, c.RoastProfile, notes, c.Description, c.ID, c.Version).
+        Scan(&c.AvgRating, &c.Version, &c.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return missingOrStale(ctx, s.db, "coffees", c.ID)
+    }
+    return translateError(err)
+}
+
+func (s *postgresCoffees) Delete(ctx context.Context, id, version int) error {
+    err := deleteAffected(ctx, s.db, `DELETE FROM coffees WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
+    if err == ErrNotFound {
+        return missingOrStale(ctx, s.db, "coffees", id)
+    }
+    return err
+}
+
+func (s *postgresCoffees) Count(ctx context.Context) (int, error) {
+    return count(ctx, s.db, "coffees")
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "strconv"
+    "time"
+)
+
+type postgresGeocodeQueue struct {
+    db *sql.DB
+}
+
+const jobAddressColumn = `COALESCE(address, '') || ', ' || COALESCE(city, '') || ', ' || COALESCE(country, '')`
+
+// geocodeKept holds in the UPDATE of a shop or roastery, with the country,
+// city, address, lat, lon, status and address_pending as $2, $3, $4, $7,
+// $8, $9 and $12, when the update leaves the geocoding status, address and
+// pin as they were. The attempts, the last error and a claimed job's lease
+// are then kept.
+const geocodeKept = `geocode_status = $9 AND address_pending = $12 AND country IS NOT DISTINCT FROM $2 AND city IS NOT DISTINCT FROM $3 AND address IS NOT DISTINCT FROM $4
+    AND lat IS NOT DISTINCT FROM $7 AND lon IS NOT DISTINCT FROM $8`
+
+func (s *postgresGeocodeQueue) Claim(ctx context.Context, n int, lease time.Duration) ([]GeocodeJob, error) {
+    var jobs []GeocodeJob
+    for _, t := range geocodeTables {
+        if len(jobs) >= n {
+            break
+        }
+        // SKIP LOCKED lets several API instances run workers side by side.
+        rows, err := s.db.QueryContext(ctx, `
+            UPDATE `+t.table+` SET geocode_next_attempt = now() + $1 * interval '1 second'
+            WHERE id IN (
+                SELECT id FROM `+t.table+`
+                WHERE (geocode_status = 'pending' OR address_pending) AND (geocode_next_attempt IS NULL OR geocode_next_attempt <= now())
+                ORDER BY geocode_next_attempt NULLS FIRST, id
+                LIMIT $2
+                FOR UPDATE SKIP LOCKED)
+            RETURNING id, `+jobAddressColumn+`, geocode_attempts, address_pending, lat, lon`,
+            lease.Seconds(), n-len(jobs))
+        if err != nil {
+            return nil, err
+        }
+        for rows.Next() {
+            job := GeocodeJob{Kind: t.kind}
+            if err := rows.Scan(&job.ID, &job.Address, &job.Attempts, &job.Reverse, &job.Lat, &job.Lon); err != nil {
+                rows.Close()
+                return nil, err
+            }
+            jobs = append(jobs, job)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+    }
+    return jobs, nil
+}
+
+// finish updates the row of a job that is still pending with the same
+// address, and the same pin for a reverse job; a vanished or edited row is
+// not an error. The version is bumped so ETags read before the worker
+// answered no longer match.
+func (s *postgresGeocodeQueue) finish(ctx context.Context, job GeocodeJob, set string, args ...interface{}) error {
+    table, err := geocodeTable(job.Kind)
+    if err != nil {
+        return err
+    }
+    n := len(args)
+    pending := `geocode_status = 'pending'`
+    args = append(args, job.ID, job.Address)
+    if job.Reverse {
+        pending = `address_pending AND lat = $` + strconv.Itoa(n+3) + ` AND lon = $` + strconv.Itoa(n+4)
+        args = append(args, job.Lat, job.Lon)
+    }
+    _, err = s.db.ExecContext(ctx, `
+        UPDATE `+table+` SET `+set+`, version = version + 1, updated_at = now()
+        WHERE id = $`+strconv.Itoa(n+1)+` AND `+jobAddressColumn+` = $`+strconv.Itoa(n+2)+` AND `+pending,
+        args...)
+    return err
+}
+
+func (s *postgresGeocodeQueue) Resolve(ctx context.Context, job GeocodeJob, lat, lon float64) error {
+    return s.finish(ctx, job, `lat = $1, lon = $2, geocode_status = 'resolved', geocode_error = NULL, geocode_next_attempt = NULL`, lat, lon)
+}
+
+func (s *postgresGeocodeQueue) ResolveAddress(ctx context.Context, job GeocodeJob, address, city, country string) error {
+    return s.finish(ctx, job, `address = COALESCE(NULLIF(address, ''), $1), city = COALESCE(NULLIF(city, ''), $2),
+        country = COALESCE(NULLIF(country, ''), $3), address_pending = false, geocode_error = NULL, geocode_next_attempt = NULL`,
+        address, city, country)
+}
+
+func (s *postgresGeocodeQueue) Retry(ctx context.Context, job GeocodeJob, code string, at time.Time) error {
+    return s.finish(ctx, job, `geocode_error = $1, geocode_attempts = geocode_attempts + 1, geocode_next_attempt = $2`, code, at)
+}
+
+func (s *postgresGeocodeQueue) Fail(ctx context.Context, job GeocodeJob, code string) error {
+    if job.Reverse {
+        return s.finish(ctx, job, `address_pending = false, geocode_error = $1, geocode_attempts = geocode_attempts + 1, geocode_next_attempt = NULL`, code)
+    }
+    return s.finish(ctx, job, `geocode_status = 'failed', geocode_error = $1, geocode_attempts = geocode_attempts + 1, geocode_next_attempt = NULL`, code)
+}
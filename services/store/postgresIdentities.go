@@ -0,0 +1,79 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+
+    "coffeeApi/services/models"
+)
+
+type postgresIdentities struct {
+    db *sql.DB
+}
+
+func (s *postgresIdentities) Find(ctx context.Context, issuer, subject string) (int, error) {
+    var userID int
+    err := s.db.QueryRowContext(ctx, `SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`,
+        issuer, subject).Scan(&userID)
+    if err == sql.ErrNoRows {
+        return 0, ErrNotFound
+    }
+    return userID, err
+}
+
+func (s *postgresIdentities) Link(ctx context.Context, id Identity) error {
+    return linkIdentity(ctx, s.db, id)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func linkIdentity(ctx context.Context, db execer, id Identity) error {
+    _, err := db.ExecContext(ctx, `INSERT INTO user_identities (issuer, subject, user_id, email) VALUES ($1, $2, $3, NULLIF($4, ''))`,
+        id.Issuer, id.Subject, id.UserID, id.Email)
+    return translateError(err)
+}
+
+func (s *postgresIdentities) CreateUser(ctx context.Context, u *models.User, id Identity) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    err = tx.QueryRowContext(ctx,
+        `INSERT INTO users (username, password, email, email_verified, role) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+        u.Username, u.Password, u.Email, u.EmailVerified, u.Role,
+    ).Scan(&u.ID)
+    if err != nil {
+        return translateError(err)
+    }
+    id.UserID = u.ID
+    if err := linkIdentity(ctx, tx, id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (s *postgresIdentities) StartLogin(ctx context.Context, l PendingLogin) error {
+    // Abandoned logins are cleared here rather than by a separate job.
+    if _, err := s.db.ExecContext(ctx, `DELETE FROM oidc_logins WHERE expires_at < now()`); err != nil {
+        return err
+    }
+    _, err := s.db.ExecContext(ctx, `INSERT INTO oidc_logins (state, provider, verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+        l.State, l.Provider, l.Verifier, l.Nonce, l.ExpiresAt)
+    return translateError(err)
+}
+
+func (s *postgresIdentities) FinishLogin(ctx context.Context, state string) (PendingLogin, error) {
+    l := PendingLogin{State: state}
+    err := s.db.QueryRowContext(ctx, `
+        DELETE FROM oidc_logins WHERE state = $1 AND expires_at > now()
+        RETURNING provider, verifier, nonce, expires_at`, state,
+    ).Scan(&l.Provider, &l.Verifier, &l.Nonce, &l.ExpiresAt)
+    if err == sql.ErrNoRows {
+        return l, ErrNotFound
+    }
+    return l, err
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// postgresLoginAttempts compares lock times with the database clock only,
+// so the API and database servers need not agree on the time.
+type postgresLoginAttempts struct {
+    db *sql.DB
+}
+
+func (s *postgresLoginAttempts) Locked(ctx context.Context, keys ...string) (time.Duration, error) {
+    var seconds float64
+    err := s.db.QueryRowContext(ctx, `
+        SELECT COALESCE(EXTRACT(EPOCH FROM max(locked_until) - now()), 0)
+        FROM login_failures WHERE key = ANY($1) AND locked_until > now()`,
+        pq.Array(keys),
+    ).Scan(&seconds)
+    return time.Duration(seconds * float64(time.Second)), err
+}
+
+func (s *postgresLoginAttempts) Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (time.Duration, error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+    var failures int
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO login_failures (key, failures, last_failure_at) VALUES ($1, 1, now())
+        ON CONFLICT (key) DO UPDATE SET
+            failures = CASE WHEN login_failures.last_failure_at < now() - make_interval(secs => $2)
+                THEN 1 ELSE login_failures.failures + 1 END,
+            last_failure_at = now()
+        RETURNING failures`,
+        key, window.Seconds(),
+    ).Scan(&failures)
+    if err != nil {
+        return 0, err
+    }
+    lock := lockFor(failures)
+    if lock > 0 {
+        _, err = tx.ExecContext(ctx, `UPDATE login_failures SET locked_until = now() + make_interval(secs => $2) WHERE key = $1`,
+            key, lock.Seconds())
+        if err != nil {
+            return 0, err
+        }
+    }
+    return lock, tx.Commit()
+}
+
+func (s *postgresLoginAttempts) Reset(ctx context.Context, key string) error {
+    _, err := s.db.ExecContext(ctx, `DELETE FROM login_failures WHERE key = $1`, key)
+    return err
+}
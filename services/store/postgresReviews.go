@@ -0,0 +1,206 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+type postgresReviews struct {
+    db *sql.DB
+}
+
+const reviewColumns = `r.id, COALESCE(r.user_id, 0), COALESCE(r.coffee_id, 0), COALESCE(r.roastery_id, 0), COALESCE(r.coffee_shop_id, 0), r.rating, r.review, r.date_of_creation,
+               u.username AS user_name,
+               c.name AS coffee_name,
+               ro.name AS roastery_name,
+               s.name AS shop_name,
+               r.version, r.updated_at`
+
+const reviewFrom = `
+        FROM reviews r
+        LEFT JOIN users u ON r.user_id = u.id
+        LEFT JOIN coffees c ON r.coffee_id = c.id
+        LEFT JOIN roasteries ro ON r.roastery_id = ro.id
+        LEFT JOIN shops s ON r.coffee_shop_id = s.id`
+
+func scanReview(row rowScanner) (models.ReviewResponse, error) {
+    var rev models.ReviewResponse
+    var userName, coffeeName, roasteryName, shopName sql.NullString
+    if err := row.Scan(
+        &rev.ID, &rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId,
+        &rev.Rating, &rev.Review, &rev.DateOfCreation,
+        &userName, &coffeeName, &roasteryName, &shopName,
+        &rev.Version, &rev.UpdatedAt); err != nil {
+        return rev, err
+    }
+    rev.UserName = nullStringValue(userName, "Anonymous User")
+    rev.CoffeeName = nullStringValue(coffeeName, "")
+    rev.RoasteryName = nullStringValue(roasteryName, "")
+    rev.CoffeeShopName = nullStringValue(shopName, "")
+    rev.TargetType = models.ReviewTargetType(rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId)
+    rev.TargetName = getTargetName(coffeeName, roasteryName, shopName)
+    return rev, nil
+}
+
+func (s *postgresReviews) List(ctx context.Context, f ReviewFilter, opts ListOptions) (Page[models.ReviewResponse], error) {
+    q := &queryBuilder{}
+    q.equals("r.user_id", f.UserID)
+    q.equals("r.coffee_id", f.CoffeeID)
+    q.equals("r.roastery_id", f.RoasteryID)
+    q.equals("r.coffee_shop_id", f.CoffeeShopID)
+    if f.MinRating != nil {
+        q.where("r.rating >= " + q.arg(float32(*f.MinRating)))
+    }
+    if f.MaxRating != nil {
+        q.where("r.rating <= " + q.arg(float32(*f.MaxRating)))
+    }
+    if f.FromDate != nil {
+        q.where("r.date_of_creation >= " + q.arg(*f.FromDate))
+    }
+    if f.ToDate != nil {
+        q.where("r.date_of_creation <= " + q.arg(f.ToDate.Add(24*time.Hour)))
+    }
+    q.ilike("c.country", f.CoffeeCountry)
+    q.ilike("c.process", f.CoffeeProcess)
+    q.ilike("c.roast_profile", f.CoffeeRoastProfile)
+    q.ilike("c.flavour_notes", f.CoffeeFlavour)
+    q.ilike("ro.country", f.RoasteryCountry)
+    q.ilike("ro.city", f.RoasteryCity)
+    q.ilike("s.country", f.ShopCountry)
+    q.ilike("s.city", f.ShopCity)
+
+    return listRows(ctx, s.db, reviewColumns, reviewFrom, q, reviewSortKeys, defaultReviewSort, opts, scanReview)
+}
+
+func (s *postgresReviews) Get(ctx context.Context, id int) (models.ReviewResponse, error) {
+    rev, err := scanReview(s.db.QueryRowContext(ctx, "SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1", id))
+    if err == sql.ErrNoRows {
+        return rev, ErrNotFound
+    }
+    return rev, err
+}
+
+func (s *postgresReviews) Create(ctx context.Context, rev *models.Review) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO reviews (user_id, coffee_id, roastery_id, coffee_shop_id, rating, review, date_of_creation)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, version, updated_at`,
+        nullableID(rev.UserId), nullableID(rev.CoffeeId), nullableID(rev.RoasteryId), nullableID(rev.CoffeeShopId), rev.Rating, rev.Review, rev.DateOfCreation).Scan(&rev.ID, &rev.Version, &rev.UpdatedAt)
+    if err != nil {
+        return translateError(err)
+    }
+    if err := updateAverageRating(ctx, tx, rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (s *postgresReviews) Update(ctx context.Context, rev *models.Review) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    err = tx.QueryRowContext(ctx, `
+        UPDATE reviews SET rating = $1, review = $2, version = version + 1, updated_at = now()
+        WHERE id = $3 AND ($4 = 0 OR version = $4)
+        RETURNING COALESCE(user_id, 0), COALESCE(coffee_id, 0), COALESCE(roastery_id, 0), COALESCE(coffee_shop_id, 0), date_of_creation, version, updated_at`,
+        rev.Rating, rev.Review, rev.ID, rev.Version).
+        Scan(&rev.UserId, &rev.CoffeeId, &rev.RoasteryId, &rev.CoffeeShopId, &rev.DateOfCreation, &rev.Version, &rev.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return missingOrStale(ctx, tx, "reviews", rev.ID)
+    } else if err != nil {
+        return translateError(err)
+    }
+    if err := updateAverageRating(ctx, tx, rev.CoffeeId, rev.RoasteryId, rev.CoffeeShopId); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (s *postgresReviews) Delete(ctx context.Context, id, version int) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    var coffeeId, roasteryId, coffeeShopId int
+    err = tx.QueryRowContext(ctx, `
+        DELETE FROM reviews WHERE id = $1 AND ($2 = 0 OR version = $2)
+        RETURNING COALESCE(coffee_id, 0), COALESCE(roastery_id, 0), COALESCE(coffee_shop_id, 0)`, id, version).
+        Scan(&coffeeId, &roasteryId, &coffeeShopId)
+    if err == sql.ErrNoRows {
+        return missingOrStale(ctx, tx, "reviews", id)
+    } else if err != nil {
+        return translateDeleteError(err)
+    }
+    if err := updateAverageRating(ctx, tx, coffeeId, roasteryId, coffeeShopId); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (s *postgresReviews) Count(ctx context.Context) (int, error) {
+    return count(ctx, s.db, "reviews")
+}
+
+func updateAverageRating(ctx context.Context, tx *sql.Tx, coffeeId, roasteryId, coffeeShopId int) error {
+    if coffeeId != 0 {
+        _, err := tx.ExecContext(ctx, `
+            UPDATE coffees SET avg_rating =
+            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE coffee_id = $1)
+            WHERE id = $1`, coffeeId)
+        if err != nil {
+            return err
+        }
+    }
+
+    if roasteryId != 0 {
+        _, err := tx.ExecContext(ctx, `
+            UPDATE roasteries SET avg_rating =
+            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE roastery_id = $1)
+            WHERE id = $1`, roasteryId)
+        if err != nil {
+            return err
+        }
+    }
+
+    if coffeeShopId != 0 {
+        _, err := tx.ExecContext(ctx, `
+            UPDATE shops SET avg_rating =
+            (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE coffee_shop_id = $1)
+            WHERE id = $1`, coffeeShopId)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func nullStringValue(ns sql.NullString, defaultValue string) string {
+    if ns.Valid {
+        return ns.String
+    }
+    return defaultValue
+}
+
+func getTargetName(coffeeName, roasteryName, shopName sql.NullString) string {
+    if coffeeName.Valid {
+        return coffeeName.String
+    }
+    if roasteryName.Valid {
+        return roasteryName.String
+    }
+    if shopName.Valid {
+        return shopName.String
+    }
+    return "Unknown"
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+
+    "coffeeApi/services/models"
+)
+
+type postgresRoasteries struct {
+    db *sql.DB
+}
+
+const roasteryColumns = `id, name, country, city, address, website, description, avg_rating, lat, lon, geocode_status, COALESCE(geocode_error, ''), address_pending, version, updated_at`
+
+func scanRoastery(row rowScanner) (models.Roastery, error) {
+    var r models.Roastery
+    err := row.Scan(&r.ID, &r.Name, &r.Country, &r.City, &r.Address, &r.Website, &r.Description, &r.AvgRating, &r.Lat, &r.Lon, &r.GeocodeStatus, &r.GeocodeError, &r.AddressPending, &r.Version, &r.UpdatedAt)
+    return r, err
+}
+
+func scanRoasteryWithDistance(row rowScanner) (models.Roastery, error) {
+    var r models.Roastery
+    r.DistanceKm = new(float64)
+    err := row.Scan(&r.ID, &r.Name, &r.Country, &r.City, &r.Address, &r.Website, &r.Description, &r.AvgRating, &r.Lat, &r.Lon, &r.GeocodeStatus, &r.GeocodeError, &r.AddressPending, &r.Version, &r.UpdatedAt, r.DistanceKm)
+    return r, err
+}
+
+func (s *postgresRoasteries) List(ctx context.Context, f RoasteryFilter, opts ListOptions) (Page[models.Roastery], error) {
+    q := &queryBuilder{}
+    q.ilike("name", f.Name)
+    q.ilike("country", f.Country)
+    q.ilike("city", f.City)
+    q.ilike("address", f.Address)
+    q.ilike("website", f.Website)
+    q.ilike("description", f.Description)
+    if f.MinRating != nil {
+        q.where("avg_rating >= " + q.arg(*f.MinRating))
+    }
+    if f.MaxRating != nil {
+        q.where("avg_rating <= " + q.arg(*f.MaxRating))
+    }
+
+    q.equalsText("geocode_status", f.GeocodeStatus)
+
+    defaults, err := f.GeoFilter.defaultSort(opts)
+    if err != nil {
+        return Page[models.Roastery]{}, err
+    }
+    from := f.GeoFilter.apply(q, "roasteries")
+    if f.Near == nil {
+        return listRows(ctx, s.db, roasteryColumns, from, q, roasterySortKeys, defaults, opts, scanRoastery)
+    }
+    return listRows(ctx, s.db, roasteryColumns+", distance_km", from, q, roasterySortKeys, defaults, opts, scanRoasteryWithDistance)
+}
+
+func (s *postgresRoasteries) Get(ctx context.Context, id int) (models.Roastery, error) {
+    r, err := scanRoastery(s.db.QueryRowContext(ctx, `SELECT `+roasteryColumns+` FROM roasteries WHERE id = $1`, id))
+    if err == sql.ErrNoRows {
+        return r, ErrNotFound
+    }
+    return r, err
+}
+
+func (s *postgresRoasteries) Create(ctx context.Context, r *models.Roastery) error {
+    r.GeocodeStatus = orDefault(r.GeocodeStatus, GeocodeResolved)
+    err := s.db.QueryRowContext(ctx, `
+        INSERT INTO roasteries (name, country, city, address, website, description, avg_rating, lat, lon, geocode_status, address_pending)
+        VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8, $9, $10) RETURNING id, version, updated_at`,
+        r.Name, r.Country, r.City, r.Address, r.Website, r.Description, r.Lat, r.Lon, r.GeocodeStatus, r.AddressPending).
+        Scan(&r.ID, &r.Version, &r.UpdatedAt)
+    if err != nil {
+        return translateError(err)
+    }
+    r.AvgRating = 0
+    r.GeocodeError = ""
+    return nil
+}
+
+func (s *postgresRoasteries) Update(ctx context.Context, r *models.Roastery) error {
+    r.GeocodeStatus = orDefault(r.GeocodeStatus, GeocodeResolved)
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE roasteries SET name=$1, country=$2, city=$3, address=$4, website=$5, description=$6, lat=$7, lon=$8,
+            geocode_status=$9, address_pending=$12,
+            geocode_error = CASE WHEN `+geocodeKept+` THEN geocode_error END,
+            geocode_attempts = CASE WHEN `+geocodeKept+` THEN geocode_attempts ELSE 0 END,
+            geocode_next_attempt = CASE WHEN `+geocodeKept+` THEN geocode_next_attempt END,
+            version = version + 1, updated_at = now()
+        WHERE id=$10 AND ($11 = 0 OR version = $11)
+        RETURNING avg_rating, COALESCE(geocode_error, ''), version, updated_at`,
+        r.Name, r.Country, r.City, r.Address, r.Website, r.Description, r.Lat, r.Lon, r.GeocodeStatus, r.ID, r.Version, r.AddressPending).
+        Scan(&r.AvgRating, &r.GeocodeError, &r.Version, &r.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return missingOrStale(ctx, s.db, "roasteries", r.ID)
+    }
+    return translateError(err)
+}
+
+func (s *postgresRoasteries) Delete(ctx context.Context, id, version int) error {
+    err := deleteAffected(ctx, s.db, `DELETE FROM roasteries WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
+    if err == ErrNotFound {
+        return missingOrStale(ctx, s.db, "roasteries", id)
+    }
+    return err
+}
+
+func (s *postgresRoasteries) Count(ctx context.Context) (int, error) {
+    return count(ctx, s.db, "roasteries")
+}
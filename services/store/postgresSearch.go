@@ -0,0 +1,77 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "html"
+    "strings"
+
+    "coffeeApi/services/models"
+)
+
+type postgresSearch struct {
+    db *sql.DB
+}
+
+// Headlines mark matches with control characters instead of <mark>, so
+// that the text around them can be escaped as HTML afterwards. The text
+// is stripped of those characters first.
+const (
+    startSel        = "\x01"
+    stopSel         = "\x02"
+    headlineOptions = "StartSel=" + startSel + ", StopSel=" + stopSel + ", MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+var markSelections = strings.NewReplacer(startSel, "<mark>", stopSel, "</mark>")
+
+// htmlSnippet escapes a headline as HTML and turns its selections into
+// <mark> tags.
+func htmlSnippet(headline string) string {
+    return markSelections.Replace(html.EscapeString(headline))
+}
+
+func (s *postgresSearch) Search(ctx context.Context, q SearchQuery, opts ListOptions) (Page[models.SearchResult], error) {
+    config, sources, err := resolveSearch(q, opts)
+    if err != nil {
+        return Page[models.SearchResult]{}, err
+    }
+
+    // $1 is the query text and $2 the configuration; config is whitelisted
+    // by resolveSearch, so it is safe to use in the column name.
+    parts := make([]string, len(sources))
+    for i, src := range sources {
+        parts[i] = `
+            SELECT '` + src.kind + `' AS type, id, name, ` + src.text + ` AS text,
+                   ts_rank_cd(search_` + config + `, query) AS score
+            FROM ` + src.table + `, websearch_to_tsquery($2::regconfig, $1) query
+            WHERE search_` + config + ` @@ query`
+    }
+    matches := "(" + strings.Join(parts, " UNION ALL ") + ") matches"
+
+    page := Page[models.SearchResult]{Items: []models.SearchResult{}}
+    if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+matches, q.Text, config).Scan(&page.Total); err != nil {
+        return Page[models.SearchResult]{}, err
+    }
+
+    // Headlines are expensive, so they are only built for the rows on the page.
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT type, id, name, score,
+               ts_headline($2::regconfig, translate(text, $5, ''), websearch_to_tsquery($2::regconfig, $1), $6)
+        FROM `+matches+`
+        ORDER BY score DESC, type, id
+        LIMIT $3 OFFSET $4`,
+        q.Text, config, opts.Limit, opts.Offset, startSel+stopSel, headlineOptions)
+    if err != nil {
+        return Page[models.SearchResult]{}, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var r models.SearchResult
+        if err := rows.Scan(&r.Type, &r.ID, &r.Name, &r.Score, &r.Snippet); err != nil {
+            return Page[models.SearchResult]{}, err
+        }
+        r.Snippet = htmlSnippet(r.Snippet)
+        page.Items = append(page.Items, r)
+    }
+    return page, rows.Err()
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "time"
+)
+
+type postgresSessions struct {
+    db *sql.DB
+}
+
+func (s *postgresSessions) Start(ctx context.Context, t RefreshToken) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    if _, err := tx.ExecContext(ctx, `INSERT INTO sessions (id, user_id) VALUES ($1, $2)`, t.SessionID, t.UserID); err != nil {
+        return translateError(err)
+    }
+    if _, err := tx.ExecContext(ctx, `INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES ($1, $2, $3)`,
+        t.Hash, t.SessionID, t.ExpiresAt); err != nil {
+        return translateError(err)
+    }
+    return tx.Commit()
+}
+
+func (s *postgresSessions) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (RefreshToken, error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return RefreshToken{}, err
+    }
+    defer tx.Rollback()
+
+    t := RefreshToken{Hash: newHash, ExpiresAt: expiresAt}
+    var used, revoked bool
+    var expires time.Time
+    // Locking the old token makes concurrent refreshes with it queue up,
+    // so only the first one succeeds.
+    err = tx.QueryRowContext(ctx, `
+        SELECT r.session_id, s.user_id, r.expires_at, r.used_at IS NOT NULL, s.revoked_at IS NOT NULL
+        FROM refresh_tokens r JOIN sessions s ON s.id = r.session_id
+        WHERE r.token_hash = $1
+        FOR UPDATE OF r`, oldHash).
+        Scan(&t.SessionID, &t.UserID, &expires, &used, &revoked)
+    if err == sql.ErrNoRows {
+        return RefreshToken{}, ErrNotFound
+    } else if err != nil {
+        return RefreshToken{}, err
+    }
+    if revoked || expires.Before(time.Now()) {
+        return RefreshToken{}, ErrNotFound
+    }
+    if used {
+        if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1`, t.SessionID); err != nil {
+            return RefreshToken{}, err
+        }
+        if err := tx.Commit(); err != nil {
+            return RefreshToken{}, err
+        }
+        return RefreshToken{}, ErrTokenReused
+    }
+
+    if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE token_hash = $1`, oldHash); err != nil {
+        return RefreshToken{}, err
+    }
+    if _, err := tx.ExecContext(ctx, `INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES ($1, $2, $3)`,
+        t.Hash, t.SessionID, t.ExpiresAt); err != nil {
+        return RefreshToken{}, translateError(err)
+    }
+    return t, tx.Commit()
+}
+
+func (s *postgresSessions) Revoke(ctx context.Context, sessionID string) error {
+    return execAffected(ctx, s.db, `UPDATE sessions SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, sessionID)
+}
+
+func (s *postgresSessions) RevokeUser(ctx context.Context, userID int) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+    return err
+}
+
+func (s *postgresSessions) Active(ctx context.Context, sessionID string) (bool, error) {
+    var active bool
+    err := s.db.QueryRowContext(ctx, `SELECT revoked_at IS NULL FROM sessions WHERE id = $1`, sessionID).Scan(&active)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    return active, err
+}
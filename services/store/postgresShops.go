@@ -0,0 +1,101 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+
+    "coffeeApi/services/models"
+)
+
+type postgresShops struct {
+    db *sql.DB
+}
+
+const shopColumns = `id, name, country, city, address, website, description, avg_rating, lat, lon, geocode_status, COALESCE(geocode_error, ''), address_pending, version, updated_at`
+
+func scanShop(row rowScanner) (models.CoffeeShop, error) {
+    var shop models.CoffeeShop
+    err := row.Scan(&shop.ID, &shop.Name, &shop.Country, &shop.City, &shop.Address, &shop.Website, &shop.Description, &shop.AvgRating, &shop.Lat, &shop.Lon, &shop.GeocodeStatus, &shop.GeocodeError, &shop.AddressPending, &shop.Version, &shop.UpdatedAt)
+    return shop, err
+}
+
+func scanShopWithDistance(row rowScanner) (models.CoffeeShop, error) {
+    var shop models.CoffeeShop
+    shop.DistanceKm = new(float64)
+    err := row.Scan(&shop.ID, &shop.Name, &shop.Country, &shop.City, &shop.Address, &shop.Website, &shop.Description, &shop.AvgRating, &shop.Lat, &shop.Lon, &shop.GeocodeStatus, &shop.GeocodeError, &shop.AddressPending, &shop.Version, &shop.UpdatedAt, shop.DistanceKm)
+    return shop, err
+}
+
+func (s *postgresShops) List(ctx context.Context, f ShopFilter, opts ListOptions) (Page[models.CoffeeShop], error) {
+    q := &queryBuilder{}
+    q.ilike("name", f.Name)
+    q.ilike("country", f.Country)
+    q.ilike("city", f.City)
+    q.ilike("address", f.Address)
+    q.ilike("website", f.Website)
+    q.equalsText("geocode_status", f.GeocodeStatus)
+
+    defaults, err := f.GeoFilter.defaultSort(opts)
+    if err != nil {
+        return Page[models.CoffeeShop]{}, err
+    }
+    from := f.GeoFilter.apply(q, "shops")
+    if f.Near == nil {
+        return listRows(ctx, s.db, shopColumns, from, q, shopSortKeys, defaults, opts, scanShop)
+    }
+    return listRows(ctx, s.db, shopColumns+", distance_km", from, q, shopSortKeys, defaults, opts, scanShopWithDistance)
+}
+
+func (s *postgresShops) Get(ctx context.Context, id int) (models.CoffeeShop, error) {
+    shop, err := scanShop(s.db.QueryRowContext(ctx, `SELECT `+shopColumns+` FROM shops WHERE id = $1`, id))
+    if err == sql.ErrNoRows {
+        return shop, ErrNotFound
+    }
+    return shop, err
+}
+
+func (s *postgresShops) Create(ctx context.Context, shop *models.CoffeeShop) error {
+    shop.GeocodeStatus = orDefault(shop.GeocodeStatus, GeocodeResolved)
+    err := s.db.QueryRowContext(ctx, `
+        INSERT INTO shops (name, country, city, address, website, description, avg_rating, lat, lon, geocode_status, address_pending)
+        VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8, $9, $10) RETURNING id, version, updated_at`,
+        shop.Name, shop.Country, shop.City, shop.Address, shop.Website, shop.Description, shop.Lat, shop.Lon, shop.GeocodeStatus, shop.AddressPending).
+        Scan(&shop.ID, &shop.Version, &shop.UpdatedAt)
+    if err != nil {
+        return translateError(err)
+    }
+    shop.AvgRating = 0
+    shop.GeocodeError = ""
+    return nil
+}
+
+func (s *postgresShops) Update(ctx context.Context, shop *models.CoffeeShop) error {
+    shop.GeocodeStatus = orDefault(shop.GeocodeStatus, GeocodeResolved)
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE shops SET name=$1, country=$2, city=$3, address=$4, website=$5, description=$6, lat=$7, lon=$8,
+            geocode_status=$9, address_pending=$12,
+            geocode_error = CASE WHEN `+geocodeKept+` THEN geocode_error END,
+            geocode_attempts = CASE WHEN `+geocodeKept+` THEN geocode_attempts ELSE 0 END,
+            geocode_next_attempt = CASE WHEN `+geocodeKept+` THEN geocode_next_attempt END,
+            version = version + 1, updated_at = now()
+        WHERE id=$10 AND ($11 = 0 OR version = $11)
+        RETURNING avg_rating, COALESCE(geocode_error, ''), version, updated_at`,
+        shop.Name, shop.Country, shop.City, shop.Address, shop.Website, shop.Description, shop.Lat, shop.Lon, shop.GeocodeStatus, shop.ID, shop.Version, shop.AddressPending).
+        Scan(&shop.AvgRating, &shop.GeocodeError, &shop.Version, &shop.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return missingOrStale(ctx, s.db, "shops", shop.ID)
+    }
+    return translateError(err)
+}
+
+func (s *postgresShops) Delete(ctx context.Context, id, version int) error {
+    err := deleteAffected(ctx, s.db, `DELETE FROM shops WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
+    if err == ErrNotFound {
+        return missingOrStale(ctx, s.db, "shops", id)
+    }
+    return err
+}
+
+func (s *postgresShops) Count(ctx context.Context) (int, error) {
+    return count(ctx, s.db, "shops")
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+
+    "coffeeApi/services/models"
+)
+
+type postgresUsers struct {
+    db *sql.DB
+}
+
+const userColumns = `id, username, password, email, email_verified, role, COALESCE(avatar_url, '')`
+
+func scanUser(row rowScanner) (models.User, error) {
+    var u models.User
+    err := row.Scan(&u.ID, &u.Username, &u.Password, &u.Email, &u.EmailVerified, &u.Role, &u.AvatarURL)
+    if err == sql.ErrNoRows {
+        return u, ErrNotFound
+    }
+    return u, err
+}
+
+func (s *postgresUsers) Get(ctx context.Context, id int) (models.User, error) {
+    return scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *postgresUsers) GetByUsername(ctx context.Context, username string) (models.User, error) {
+    return scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+}
+
+func (s *postgresUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+    return scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE lower(email) = lower($1)`, email))
+}
+
+func (s *postgresUsers) Create(ctx context.Context, u *models.User) error {
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO users (username, password, email, email_verified, role, avatar_url) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING id`,
+        u.Username, u.Password, u.Email, u.EmailVerified, u.Role, u.AvatarURL,
+    ).Scan(&u.ID)
+    return translateError(err)
+}
+
+func (s *postgresUsers) List(ctx context.Context, f UserFilter, opts ListOptions) (Page[models.User], error) {
+    q := &queryBuilder{}
+    q.ilike("username", f.Username)
+    q.ilike("email", f.Email)
+    q.equalsText("role", f.Role)
+    return listRows(ctx, s.db, userColumns, "FROM users", q, userSortKeys, defaultSort, opts, scanUser)
+}
+
+func (s *postgresUsers) Update(ctx context.Context, u *models.User) error {
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE users SET username = $1, email = $2, avatar_url = NULLIF($3, ''),
+            email_verified = email_verified AND lower(email) = lower($2)
+        WHERE id = $4 RETURNING email_verified`,
+        u.Username, u.Email, u.AvatarURL, u.ID,
+    ).Scan(&u.EmailVerified)
+    if err == sql.ErrNoRows {
+        return ErrNotFound
+    }
+    return translateError(err)
+}
+
+func (s *postgresUsers) SetEmailVerified(ctx context.Context, id int) error {
+    return execAffected(ctx, s.db, `UPDATE users SET email_verified = true WHERE id = $1`, id)
+}
+
+func (s *postgresUsers) SetPassword(ctx context.Context, id int, hash string) error {
+    return execAffected(ctx, s.db, `UPDATE users SET password = $1 WHERE id = $2`, hash, id)
+}
+
+func (s *postgresUsers) Delete(ctx context.Context, id int, deleteReviews bool) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    if deleteReviews {
+        rows, err := tx.QueryContext(ctx, `
+            DELETE FROM reviews WHERE user_id = $1
+            RETURNING COALESCE(coffee_id, 0), COALESCE(roastery_id, 0), COALESCE(coffee_shop_id, 0)`, id)
+        if err != nil {
+            return err
+        }
+        var targets [][3]int
+        for rows.Next() {
+            var t [3]int
+            if err := rows.Scan(&t[0], &t[1], &t[2]); err != nil {
+                rows.Close()
+                return err
+            }
+            targets = append(targets, t)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return err
+        }
+        for _, t := range targets {
+            if err := updateAverageRating(ctx, tx, t[0], t[1], t[2]); err != nil {
+                return err
+            }
+        }
+    }
+    // Remaining reviews become anonymous through ON DELETE SET NULL.
+    result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+    if err != nil {
+        return translateDeleteError(err)
+    }
+    if n, err := result.RowsAffected(); err != nil {
+        return err
+    } else if n == 0 {
+        return ErrNotFound
+    }
+    return tx.Commit()
+}
+
+func (s *postgresUsers) SetRole(ctx context.Context, c RoleChange) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    var oldRole string
+    err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, c.UserID).Scan(&oldRole)
+    if err == sql.ErrNoRows {
+        return ErrNotFound
+    } else if err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, c.Role, c.UserID); err != nil {
+        return translateError(err)
+    }
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO role_changes (user_id, old_role, new_role, changed_by, source, actor)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`,
+        c.UserID, oldRole, c.Role, nullableID(c.ChangedBy), c.Source, c.Actor)
+    if err != nil {
+        return translateError(err)
+    }
+    return tx.Commit()
+}
+
+func (s *postgresUsers) Count(ctx context.Context) (int, error) {
+    return count(ctx, s.db, "users")
+}
+
+func (s *postgresUsers) CountByRole(ctx context.Context, role string) (int, error) {
+    var n int
+    err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, role).Scan(&n)
+    return n, err
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/lib/pq"
+)
+
+func TestTranslateForeignKeyViolation(t *testing.T) {
+    // Messages as a server with lc_messages = pl_PL reports them.
+    deleted := &pq.Error{Code: "23503", Constraint: "coffees_roastery_id_fkey", Table: "roasteries",
+        Message: `modyfikacja lub usunięcie na tabeli "roasteries" narusza klucz obcy "coffees_roastery_id_fkey" tabeli "coffees"`}
+    inserted := &pq.Error{Code: "23503", Constraint: "coffees_roastery_id_fkey", Table: "coffees",
+        Message: `wstawianie lub modyfikacja na tabeli "coffees" narusza klucz obcy "coffees_roastery_id_fkey"`}
+    tests := []struct {
+        name      string
+        translate func(error) error
+        err       error
+        kind      ConstraintKind
+        message   string
+    }{
+        {"delete", translateDeleteError, deleted, StillReferenced, "Cannot delete roastery that has associated coffees"},
+        {"insert", translateError, inserted, MissingReference, "Roastery not found"},
+        {"delete of an unnamed constraint", translateDeleteError, &pq.Error{Code: "23503"}, StillReferenced, "Resource is still referenced by other records"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var c *ConstraintError
+            if !errors.As(tt.translate(tt.err), &c) {
+                t.Fatalf("not a ConstraintError: %v", tt.translate(tt.err))
+            }
+            if c.Kind != tt.kind || c.Message != tt.message {
+                t.Errorf("got %v %q, want %v %q", c.Kind, c.Message, tt.kind, tt.message)
+            }
+        })
+    }
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+    "fmt"
+    "slices"
+)
+
+// searchSource describes how one result type is matched: the table whose
+// generated search_<config> columns are queried and the text that snippets
+// are cut from.
+type searchSource struct {
+    kind  string
+    table string
+    text  string
+}
+
+var searchSources = []searchSource{
+    {SearchCoffee, "coffees", "concat_ws(' ', name, flavour_notes, description)"},
+    {SearchRoastery, "roasteries", "concat_ws(' ', name, city, description)"},
+    {SearchShop, "shops", "concat_ws(' ', name, city, description)"},
+}
+
+// resolveSearch validates a query and returns its configuration and the
+// sources to search.
+func resolveSearch(q SearchQuery, opts ListOptions) (string, []searchSource, error) {
+    if err := checkOptions(opts); err != nil {
+        return "", nil, err
+    }
+    if opts.Cursor != "" || len(opts.Sort) > 0 {
+        return "", nil, fmt.Errorf("%w: search results are ordered by relevance and paged by offset", ErrInvalidListOptions)
+    }
+    config := q.Config
+    if config == "" {
+        config = "simple"
+    }
+    if !slices.Contains(SearchConfigs, config) {
+        return "", nil, fmt.Errorf("%w: unknown search configuration %q", ErrInvalidListOptions, config)
+    }
+    if len(q.Types) == 0 {
+        return config, searchSources, nil
+    }
+    var sources []searchSource
+    for _, t := range q.Types {
+        i := slices.IndexFunc(searchSources, func(s searchSource) bool { return s.kind == t })
+        if i < 0 {
+            return "", nil, fmt.Errorf("%w: unknown search type %q", ErrInvalidListOptions, t)
+        }
+        if !slices.Contains(sources, searchSources[i]) {
+            sources = append(sources, searchSources[i])
+        }
+    }
+    return config, sources, nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+    "context"
+    "testing"
+
+    "coffeeApi/services/models"
+)
+
+func TestSearchSnippetEscapesHTML(t *testing.T) {
+    ctx := context.Background()
+    stores := NewMemoryStores()
+    c := models.Coffee{Name: "Kenya", Description: `<img src=x onerror="alert(1)"> juicy & bright`}
+    if err := stores.Coffees.Create(ctx, &c); err != nil {
+        t.Fatal(err)
+    }
+
+    page, err := stores.Search.Search(ctx, SearchQuery{Text: "juicy"}, ListOptions{Limit: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(page.Items) != 1 {
+        t.Fatalf("results = %+v", page.Items)
+    }
+    want := `Kenya &lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>juicy</mark> &amp; bright`
+    if got := page.Items[0].Snippet; got != want {
+        t.Errorf("snippet = %s, want %s", got, want)
+    }
+}
+
+func TestHTMLSnippet(t *testing.T) {
+    got := htmlSnippet("<b>bold</b> " + startSel + "kawa" + stopSel + " & more")
+    want := "&lt;b&gt;bold&lt;/b&gt; <mark>kawa</mark> &amp; more"
+    if got != want {
+        t.Errorf("htmlSnippet = %s, want %s", got, want)
+    }
+}
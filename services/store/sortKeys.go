@@ -0,0 +1,67 @@
+package store
+
+import (
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+var coffeeSortKeys = sortKeys[models.Coffee]{
+    "id":           {"id", func(c models.Coffee) interface{} { return c.ID }},
+    "name":         {"COALESCE(name, '')", func(c models.Coffee) interface{} { return c.Name }},
+    "country":      {"COALESCE(country, '')", func(c models.Coffee) interface{} { return c.Country }},
+    "region":       {"COALESCE(region, '')", func(c models.Coffee) interface{} { return c.Region }},
+    "process":      {"COALESCE(process, '')", func(c models.Coffee) interface{} { return c.Process }},
+    "roastProfile": {"COALESCE(roast_profile, '')", func(c models.Coffee) interface{} { return c.RoastProfile }},
+    "avgRating":    {"COALESCE(avg_rating, 0)", func(c models.Coffee) interface{} { return float64(c.AvgRating) }},
+}
+
+var roasterySortKeys = sortKeys[models.Roastery]{
+    "id":        {"id", func(r models.Roastery) interface{} { return r.ID }},
+    "name":      {"COALESCE(name, '')", func(r models.Roastery) interface{} { return r.Name }},
+    "country":   {"COALESCE(country, '')", func(r models.Roastery) interface{} { return r.Country }},
+    "city":      {"COALESCE(city, '')", func(r models.Roastery) interface{} { return r.City }},
+    "avgRating": {"COALESCE(avg_rating, 0)", func(r models.Roastery) interface{} { return float64(r.AvgRating) }},
+    "distance":  {"distance_km", func(r models.Roastery) interface{} { return distanceValue(r.DistanceKm) }},
+}
+
+var shopSortKeys = sortKeys[models.CoffeeShop]{
+    "id":        {"id", func(s models.CoffeeShop) interface{} { return s.ID }},
+    "name":      {"COALESCE(name, '')", func(s models.CoffeeShop) interface{} { return s.Name }},
+    "country":   {"COALESCE(country, '')", func(s models.CoffeeShop) interface{} { return s.Country }},
+    "city":      {"COALESCE(city, '')", func(s models.CoffeeShop) interface{} { return s.City }},
+    "avgRating": {"COALESCE(avg_rating, 0)", func(s models.CoffeeShop) interface{} { return float64(s.AvgRating) }},
+    "distance":  {"distance_km", func(s models.CoffeeShop) interface{} { return distanceValue(s.DistanceKm) }},
+}
+
+var reviewSortKeys = sortKeys[models.ReviewResponse]{
+    "id":             {"r.id", func(r models.ReviewResponse) interface{} { return r.ID }},
+    "rating":         {"COALESCE(r.rating, 0)", func(r models.ReviewResponse) interface{} { return float64(r.Rating) }},
+    "dateOfCreation": {"r.date_of_creation", func(r models.ReviewResponse) interface{} { return r.DateOfCreation.UTC().Truncate(time.Microsecond) }},
+}
+
+var userSortKeys = sortKeys[models.User]{
+    "id":       {"id", func(u models.User) interface{} { return u.ID }},
+    "username": {"username", func(u models.User) interface{} { return u.Username }},
+    "email":    {"email", func(u models.User) interface{} { return u.Email }},
+    "role":     {"role", func(u models.User) interface{} { return u.Role }},
+}
+
+var searchSortKeys = sortKeys[models.SearchResult]{
+    "id":    {"id", func(r models.SearchResult) interface{} { return r.ID }},
+    "type":  {"type", func(r models.SearchResult) interface{} { return r.Type }},
+    "score": {"score", func(r models.SearchResult) interface{} { return r.Score }},
+}
+
+func distanceValue(d *float64) float64 {
+    if d == nil {
+        return 0
+    }
+    return *d
+}
+
+var (
+    defaultSort       = []SortField{{Field: "id"}}
+    defaultReviewSort = []SortField{{Field: "dateOfCreation", Desc: true}}
+    searchSort        = []SortField{{Field: "score", Desc: true}, {Field: "type"}}
+)
@@ -0,0 +1,361 @@
+package store
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "coffeeApi/services/models"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrStale reports a conditional write to a row that was changed since the
+// caller read it.
+var ErrStale = errors.New("changed since it was read")
+
+type ConstraintKind int
+
+const (
+    // MissingReference: the row points at a parent that does not exist.
+    MissingReference ConstraintKind = iota
+    // StillReferenced: the row cannot be deleted while others point at it.
+    StillReferenced
+    Duplicate
+    Invalid
+)
+
+// ConstraintError is returned by every store implementation when a write is
+// rejected by one of the schema's integrity rules.
+type ConstraintError struct {
+    Kind    ConstraintKind
+    Message string
+}
+
+func (e *ConstraintError) Error() string {
+    return e.Message
+}
+
+// constraintMessages are the client-facing messages for violations of the
+// named constraints; deleteMessages cover rows that are still referenced.
+var constraintMessages = map[string]string{
+    "coffees_roastery_id_fkey":    "Roastery not found",
+    "reviews_user_id_fkey":        "User not found",
+    "reviews_coffee_id_fkey":      "Coffee not found",
+    "reviews_roastery_id_fkey":    "Roastery not found",
+    "reviews_coffee_shop_id_fkey": "Coffee shop not found",
+    "users_username_key":          "Username already taken",
+    "users_email_key":             "Email already registered",
+    "users_role_check":            "Role must be user or admin",
+    "reviews_single_target":       "Review must target exactly one of: coffee, roastery, or coffee shop",
+    "reviews_rating_range":        "Rating must be an integer between 1 and 5",
+    "api_keys_user_id_fkey":       "User not found",
+    "user_identities_pkey":        "Identity already linked to a user",
+}
+
+var deleteMessages = map[string]string{
+    "coffees_roastery_id_fkey": "Cannot delete roastery that has associated coffees",
+}
+
+type CoffeeFilter struct {
+    Name         string
+    RoasteryID   int
+    Country      string
+    Region       string
+    Farm         string
+    Variety      string
+    Process      string
+    RoastProfile string
+    Flavour      string
+}
+
+// Geocoding states of shops and roasteries.
+const (
+    GeocodePending  = "pending"
+    GeocodeResolved = "resolved"
+    GeocodeFailed   = "failed"
+)
+
+type RoasteryFilter struct {
+    Name          string
+    Country       string
+    City          string
+    Address       string
+    Website       string
+    Description   string
+    MinRating     *float64
+    MaxRating     *float64
+    // GeocodeStatus is one of the Geocode* states; empty means any.
+    GeocodeStatus string
+    GeoFilter
+}
+
+type ShopFilter struct {
+    Name          string
+    Country       string
+    City          string
+    Address       string
+    Website       string
+    // GeocodeStatus is one of the Geocode* states; empty means any.
+    GeocodeStatus string
+    GeoFilter
+}
+
+type UserFilter struct {
+    Username string
+    Email    string
+    Role     string
+}
+
+type ReviewFilter struct {
+    UserID       int
+    CoffeeID     int
+    RoasteryID   int
+    CoffeeShopID int
+    MinRating    *float64
+    MaxRating    *float64
+    FromDate     *time.Time
+    ToDate       *time.Time
+
+    CoffeeCountry      string
+    CoffeeProcess      string
+    CoffeeRoastProfile string
+    CoffeeFlavour      string
+    RoasteryCountry    string
+    RoasteryCity       string
+    ShopCountry        string
+    ShopCity           string
+}
+
+// Search result types.
+const (
+    SearchCoffee   = "coffee"
+    SearchRoastery = "roastery"
+    SearchShop     = "shop"
+)
+
+// SearchConfigs lists the text search configurations a query may use.
+var SearchConfigs = []string{"simple", "polish", "english"}
+
+type SearchQuery struct {
+    Text string
+    // Config is one of SearchConfigs; empty means "simple".
+    Config string
+    // Types restricts the results to the given types; empty means all.
+    Types []string
+}
+
+// CoffeeStore, like the roastery, shop and review stores, makes updates and
+// deletes conditional: a non-zero version is the one the row must still
+// have, and ErrStale is returned when it has another. Update sets the new
+// version.
+type CoffeeStore interface {
+    List(ctx context.Context, f CoffeeFilter, opts ListOptions) (Page[models.Coffee], error)
+    Get(ctx context.Context, id int) (models.Coffee, error)
+    Create(ctx context.Context, c *models.Coffee) error
+    Update(ctx context.Context, c *models.Coffee) error
+    Delete(ctx context.Context, id, version int) error
+    Count(ctx context.Context) (int, error)
+}
+
+type RoasteryStore interface {
+    List(ctx context.Context, f RoasteryFilter, opts ListOptions) (Page[models.Roastery], error)
+    Get(ctx context.Context, id int) (models.Roastery, error)
+    Create(ctx context.Context, r *models.Roastery) error
+    // Update keeps the geocoding attempts and error when the geocoding
+    // status and address are unchanged.
+    Update(ctx context.Context, r *models.Roastery) error
+    Delete(ctx context.Context, id, version int) error
+    Count(ctx context.Context) (int, error)
+}
+
+type ShopStore interface {
+    List(ctx context.Context, f ShopFilter, opts ListOptions) (Page[models.CoffeeShop], error)
+    Get(ctx context.Context, id int) (models.CoffeeShop, error)
+    Create(ctx context.Context, s *models.CoffeeShop) error
+    // Update keeps the geocoding attempts and error when the geocoding
+    // status and address are unchanged.
+    Update(ctx context.Context, s *models.CoffeeShop) error
+    Delete(ctx context.Context, id, version int) error
+    Count(ctx context.Context) (int, error)
+}
+
+// ReviewStore keeps the avg_rating of the reviewed coffee, roastery or shop
+// in sync on every write.
+type ReviewStore interface {
+    List(ctx context.Context, f ReviewFilter, opts ListOptions) (Page[models.ReviewResponse], error)
+    Get(ctx context.Context, id int) (models.ReviewResponse, error)
+    Create(ctx context.Context, rev *models.Review) error
+    // Update changes only the rating and text of an existing review.
+    Update(ctx context.Context, rev *models.Review) error
+    Delete(ctx context.Context, id, version int) error
+    Count(ctx context.Context) (int, error)
+}
+
+// SearchStore ranks coffees, roasteries and shops by relevance to a free
+// text query. Results are always ordered by score, so only Limit and Offset
+// of the list options apply.
+type SearchStore interface {
+    Search(ctx context.Context, q SearchQuery, opts ListOptions) (Page[models.SearchResult], error)
+}
+
+// GeocodeJob is a shop or roastery waiting for coordinates, or a map pin
+// waiting for its address when Reverse is set.
+type GeocodeJob struct {
+    // Kind is "shop" or "roastery".
+    Kind     string
+    ID       int
+    Address  string
+    Attempts int
+    Reverse  bool
+    Lat, Lon float64
+}
+
+// GeocodeQueue hands pending shops and roasteries to the geocoding worker.
+// A job only completes while the row is still pending with the same
+// address and, for reverse jobs, the same pin, so results for a row edited
+// in the meantime are dropped.
+type GeocodeQueue interface {
+    // Claim returns up to n jobs that are due and hides them from other
+    // claims for lease.
+    Claim(ctx context.Context, n int, lease time.Duration) ([]GeocodeJob, error)
+    Resolve(ctx context.Context, job GeocodeJob, lat, lon float64) error
+    // ResolveAddress fills in the empty address fields of a reverse job.
+    ResolveAddress(ctx context.Context, job GeocodeJob, address, city, country string) error
+    // Retry records a failed attempt and schedules the next one at at.
+    // code is one of the geocoding error codes, never a provider's message.
+    Retry(ctx context.Context, job GeocodeJob, code string, at time.Time) error
+    // Fail gives up on the job and marks the row as failed, or for a
+    // reverse job leaves the address as the client sent it.
+    Fail(ctx context.Context, job GeocodeJob, code string) error
+}
+
+// RoleChange is an audited change of a user's role.
+type RoleChange struct {
+    UserID int
+    Role   string
+    // ChangedBy is the admin who made the change, 0 for the bootstrap
+    // command.
+    ChangedBy int
+    // Source is "api" or "bootstrap"; Actor names the operating system
+    // user who ran the bootstrap command.
+    Source string
+    Actor  string
+}
+
+type UserStore interface {
+    Get(ctx context.Context, id int) (models.User, error)
+    GetByUsername(ctx context.Context, username string) (models.User, error)
+    // GetByEmail finds a user by email, ignoring case.
+    GetByEmail(ctx context.Context, email string) (models.User, error)
+    Create(ctx context.Context, u *models.User) error
+    List(ctx context.Context, f UserFilter, opts ListOptions) (Page[models.User], error)
+    // Update saves the username, email and avatar of u. Changing the email
+    // marks it unverified, which is reflected in u.EmailVerified.
+    Update(ctx context.Context, u *models.User) error
+    SetPassword(ctx context.Context, id int, hash string) error
+    SetEmailVerified(ctx context.Context, id int) error
+    // SetRole changes the role and records the change in the audit log.
+    SetRole(ctx context.Context, c RoleChange) error
+    // Delete removes the user. Their reviews are deleted when deleteReviews
+    // is set and kept as anonymous reviews otherwise.
+    Delete(ctx context.Context, id int, deleteReviews bool) error
+    Count(ctx context.Context) (int, error)
+    CountByRole(ctx context.Context, role string) (int, error)
+}
+
+// ErrTokenReused reports a refresh token presented a second time, which
+// means it leaked; its whole session is revoked.
+var ErrTokenReused = errors.New("refresh token reused")
+
+// RefreshToken is a stored refresh token; only its hash is kept.
+type RefreshToken struct {
+    Hash      string
+    SessionID string
+    UserID    int
+    ExpiresAt time.Time
+}
+
+// SessionStore keeps login sessions and their rotating refresh tokens.
+type SessionStore interface {
+    // Start opens the session t.SessionID with t as its first token.
+    Start(ctx context.Context, t RefreshToken) error
+    // Rotate exchanges the token with hash oldHash for a new token with
+    // hash newHash in the same session. Unknown, expired and revoked tokens
+    // give ErrNotFound, a token used before gives ErrTokenReused.
+    Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (RefreshToken, error)
+    Revoke(ctx context.Context, sessionID string) error
+    // RevokeUser ends every session of the user.
+    RevokeUser(ctx context.Context, userID int) error
+    Active(ctx context.Context, sessionID string) (bool, error)
+}
+
+// LoginAttemptStore counts consecutive failed logins per key, such as a
+// username or a client address, and how long each key stays locked.
+type LoginAttemptStore interface {
+    // Locked returns how long the longest lock among keys still lasts, or
+    // 0 when none of them is locked.
+    Locked(ctx context.Context, keys ...string) (time.Duration, error)
+    // Fail records a failed login for key and locks it for lockFor(n),
+    // where n counts the failures no more than window apart.
+    Fail(ctx context.Context, key string, window time.Duration, lockFor func(failures int) time.Duration) (time.Duration, error)
+    // Reset forgets the failures of key and lifts its lock.
+    Reset(ctx context.Context, key string) error
+}
+
+type APIKeyStore interface {
+    Create(ctx context.Context, k *models.APIKey) error
+    List(ctx context.Context, userID int) ([]models.APIKey, error)
+    // Revoke deletes key id of the user; keys of other users give
+    // ErrNotFound.
+    Revoke(ctx context.Context, userID, id int) error
+    // RevokeUser deletes every key of the user.
+    RevokeUser(ctx context.Context, userID int) error
+    // Use finds the key with the given hash, records that it was used and
+    // returns it with the current role of its owner.
+    Use(ctx context.Context, hash string) (models.APIKey, string, error)
+}
+
+// Identity links an account at an OpenID Connect provider to a user.
+type Identity struct {
+    Issuer  string
+    Subject string
+    UserID  int
+    Email   string
+}
+
+// PendingLogin is a login started at a provider, kept until the provider
+// redirects back with its state.
+type PendingLogin struct {
+    State     string
+    Provider  string
+    Verifier  string
+    Nonce     string
+    ExpiresAt time.Time
+}
+
+type IdentityStore interface {
+    // Find returns the user linked to the identity, or ErrNotFound.
+    Find(ctx context.Context, issuer, subject string) (int, error)
+    Link(ctx context.Context, id Identity) error
+    // CreateUser creates u together with its first identity.
+    CreateUser(ctx context.Context, u *models.User, id Identity) error
+    StartLogin(ctx context.Context, l PendingLogin) error
+    // FinishLogin removes and returns the pending login with the state.
+    // Unknown and expired states give ErrNotFound.
+    FinishLogin(ctx context.Context, state string) (PendingLogin, error)
+}
+
+type Stores struct {
+    Coffees    CoffeeStore
+    Roasteries RoasteryStore
+    Shops      ShopStore
+    Reviews    ReviewStore
+    Users      UserStore
+    Sessions   SessionStore
+    Logins     LoginAttemptStore
+    APIKeys    APIKeyStore
+    Identities IdentityStore
+    Search     SearchStore
+    Geocoding  GeocodeQueue
+}
@@ -0,0 +1,248 @@
+// Package validation checks structs against the rules in their `validate`
+// tags and reports every violation at once, naming fields by their JSON
+// names.
+//
+// Rules are separated by commas:
+//
+//     required      the value is set: a non-blank string, a non-zero number,
+//                   a non-empty slice or a non-nil pointer
+//     min=N, max=N  bounds on the length of a string (in characters) or
+//                   slice, or on the value of a number
+//     int           a number without a fractional part
+//     oneof=A|B     one of the listed strings, ignoring case; the field is
+//                   set to the listed spelling
+//     url           an absolute http or https URL
+//     exactlyone=G  exactly one of the fields tagged with group G is set
+//
+// Fields that are not set pass every rule except required and exactlyone.
+package validation
+
+import (
+    "fmt"
+    "net/url"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "coffeeApi/services/problem"
+)
+
+// Rules are the parsed rules of one field.
+type Rules struct {
+    Required bool
+    Min, Max *float64
+    Integer  bool
+    OneOf    []string
+    URL      bool
+    Group    string
+}
+
+// ParseRules parses a validate tag. It panics on a malformed tag, which is
+// a programming error.
+func ParseRules(tag string) Rules {
+    var rs Rules
+    for _, rule := range strings.Split(tag, ",") {
+        name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+        switch name {
+        case "required":
+            rs.Required = true
+        case "min", "max":
+            n, err := strconv.ParseFloat(arg, 64)
+            if err != nil {
+                panic(fmt.Sprintf("validation: bad %s rule %q", name, rule))
+            }
+            if name == "min" {
+                rs.Min = &n
+            } else {
+                rs.Max = &n
+            }
+        case "int":
+            rs.Integer = true
+        case "oneof":
+            rs.OneOf = strings.Split(arg, "|")
+        case "url":
+            rs.URL = true
+        case "exactlyone":
+            rs.Group = arg
+        default:
+            panic(fmt.Sprintf("validation: unknown rule %q", rule))
+        }
+    }
+    return rs
+}
+
+// JSONName returns the name of f in JSON, "" when it is not encoded.
+func JSONName(f reflect.StructField) string {
+    if f.PkgPath != "" {
+        return ""
+    }
+    name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+    switch name {
+    case "-":
+        return ""
+    case "":
+        return f.Name
+    }
+    return name
+}
+
+// Struct checks the struct v points to and returns its invalid fields in
+// the order they are declared.
+func Struct(v interface{}) []problem.FieldError {
+    rv := reflect.ValueOf(v).Elem()
+    rt := rv.Type()
+
+    var errs []problem.FieldError
+    groups := map[string][]string{}
+    set := map[string]int{}
+    var groupOrder []string
+    for i := 0; i < rt.NumField(); i++ {
+        f := rt.Field(i)
+        tag := f.Tag.Get("validate")
+        name := JSONName(f)
+        if tag == "" || name == "" {
+            continue
+        }
+        rs := ParseRules(tag)
+        value := rv.Field(i)
+        if value.Kind() == reflect.Ptr && !value.IsNil() {
+            value = value.Elem()
+        }
+        empty := isEmpty(value)
+        if rs.Group != "" {
+            if _, ok := groups[rs.Group]; !ok {
+                groupOrder = append(groupOrder, rs.Group)
+            }
+            groups[rs.Group] = append(groups[rs.Group], name)
+            if !empty {
+                set[rs.Group]++
+            }
+        }
+        if empty {
+            if rs.Required {
+                errs = append(errs, problem.FieldError{Field: name, Code: "required", Message: name + " is required"})
+            }
+            continue
+        }
+        if err := check(name, value, rs); err != nil {
+            errs = append(errs, *err)
+        }
+    }
+
+    for _, group := range groupOrder {
+        if set[group] == 1 {
+            continue
+        }
+        names := groups[group]
+        message := "exactly one of " + strings.Join(names, ", ") + " must be set"
+        for _, name := range names {
+            errs = append(errs, problem.FieldError{Field: name, Code: "exactly_one", Message: message})
+        }
+    }
+    return errs
+}
+
+func isEmpty(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.String:
+        return strings.TrimSpace(v.String()) == ""
+    case reflect.Slice, reflect.Map:
+        return v.Len() == 0
+    case reflect.Ptr, reflect.Interface:
+        return v.IsNil()
+    }
+    return v.IsZero()
+}
+
+// check applies the rules other than required and exactlyone to a set
+// value.
+func check(name string, v reflect.Value, rs Rules) *problem.FieldError {
+    invalid := func(code, format string, args ...interface{}) *problem.FieldError {
+        return &problem.FieldError{Field: name, Code: code, Message: name + " " + fmt.Sprintf(format, args...)}
+    }
+    switch v.Kind() {
+    case reflect.String:
+        s := v.String()
+        if n := float64(utf8.RuneCountInString(s)); rs.Min != nil && n < *rs.Min {
+            return invalid("too_short", "must be at least %g characters", *rs.Min)
+        } else if rs.Max != nil && n > *rs.Max {
+            return invalid("too_long", "must be at most %g characters", *rs.Max)
+        }
+        if rs.OneOf != nil {
+            i := indexFold(rs.OneOf, s)
+            if i < 0 {
+                return invalid("invalid_choice", "must be one of: %s", strings.Join(rs.OneOf, ", "))
+            }
+            if v.CanSet() {
+                v.SetString(rs.OneOf[i])
+            }
+        }
+        if rs.URL && !isURL(s) {
+            return invalid("invalid_url", "must be an absolute http or https URL")
+        }
+    case reflect.Slice:
+        if n := float64(v.Len()); rs.Min != nil && n < *rs.Min {
+            return invalid("too_short", "must have at least %g items", *rs.Min)
+        } else if rs.Max != nil && n > *rs.Max {
+            return invalid("too_long", "must have at most %g items", *rs.Max)
+        }
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Float32, reflect.Float64:
+        var n float64
+        if v.CanInt() {
+            n = float64(v.Int())
+        } else {
+            n = v.Float()
+        }
+        if rs.Integer && n != float64(int64(n)) {
+            return invalid("not_integer", "must be a whole number")
+        }
+        if (rs.Min != nil && n < *rs.Min) || (rs.Max != nil && n > *rs.Max) {
+            switch {
+            case rs.Min != nil && rs.Max != nil:
+                return invalid("out_of_range", "must be between %g and %g", *rs.Min, *rs.Max)
+            case rs.Min != nil:
+                return invalid("out_of_range", "must be at least %g", *rs.Min)
+            default:
+                return invalid("out_of_range", "must be at most %g", *rs.Max)
+            }
+        }
+    }
+    return nil
+}
+
+func indexFold(list []string, s string) int {
+    for i, item := range list {
+        if strings.EqualFold(item, strings.TrimSpace(s)) {
+            return i
+        }
+    }
+    return -1
+}
+
+func isURL(s string) bool {
+    u, err := url.Parse(s)
+    return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Unknown reports the names in keys that are not JSON fields of the struct
+// v points to. Like encoding/json, it matches names ignoring case.
+func Unknown(v interface{}, keys []string) []problem.FieldError {
+    rt := reflect.TypeOf(v).Elem()
+    known := map[string]bool{}
+    for i := 0; i < rt.NumField(); i++ {
+        if name := JSONName(rt.Field(i)); name != "" {
+            known[strings.ToLower(name)] = true
+        }
+    }
+    sort.Strings(keys)
+    var errs []problem.FieldError
+    for _, key := range keys {
+        if !known[strings.ToLower(key)] {
+            errs = append(errs, problem.FieldError{Field: key, Code: "unknown", Message: "Unknown field " + key})
+        }
+    }
+    return errs
+}